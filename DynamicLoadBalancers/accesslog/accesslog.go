@@ -0,0 +1,228 @@
+package AccessLog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//	  ___                         __
+//	 / _ |___________ ___ ___   / /  ___  ___ _
+//	/ __ / __/ __/ -_|_-<(_-<  / /__/ _ \/ _ `/
+//	/_/ |_\__/\__/\__/___/___/ /____/\___/\_, /
+//	                                     /___/
+
+// Output formats.
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+)
+
+// Config controls the access log.
+// An empty File disables it, "-" writes to stdout.
+type Config struct {
+	File       string `json:"file"`
+	Format     string `json:"format"`      // "common", "combined" (default) or "json"
+	MaxSizeMB  int    `json:"max_size_mb"` // rotate once the file reaches this size, 0 disables rotation
+	MaxBackups int    `json:"max_backups"` // rotated files to keep, default 5
+	// SampleSuccess is the fraction of non-error (< 400) requests to log.
+	// 0 or 1 logs every request; errors are always logged.
+	SampleSuccess float64 `json:"sample_success"`
+}
+
+// Entry is one line of the access log.
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	ClientIP  string        `json:"client_ip"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"-"`
+	Backend   string        `json:"backend"`
+	Attempts  int           `json:"attempts"`
+	RequestID string        `json:"request_id"`
+	QueueWait time.Duration `json:"-"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+}
+
+// Logger writes Entries in the configured format.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.WriteCloser
+	format string
+	sample float64
+}
+
+// New opens the access log described by cfg. It returns nil, nil when the
+// access log is disabled; a nil *Logger is safe to use.
+func New(cfg Config) (*Logger, error) {
+	if cfg.File == "" {
+		return nil, nil
+	}
+	format := cfg.Format
+	switch format {
+	case "":
+		format = FormatCombined
+	case FormatCommon, FormatCombined, FormatJSON:
+	default:
+		return nil, fmt.Errorf("accesslog: unknown format %q", cfg.Format)
+	}
+	if cfg.SampleSuccess < 0 || cfg.SampleSuccess > 1 {
+		return nil, fmt.Errorf("accesslog: sample_success must be between 0 and 1")
+	}
+
+	var out io.WriteCloser
+	if cfg.File == "-" {
+		out = nopCloser{os.Stdout}
+	} else {
+		maxBackups := cfg.MaxBackups
+		if maxBackups == 0 {
+			maxBackups = 5
+		}
+		f, err := openRotating(cfg.File, int64(cfg.MaxSizeMB)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	return &Logger{out: out, format: format, sample: cfg.SampleSuccess}, nil
+}
+
+// Close closes the underlying file.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
+
+// Record tracks a request while it is proxied. Retries share the same Record.
+type Record struct {
+	Entry
+	start time.Time
+	rw    *ResponseWriter
+}
+
+type recordKey struct{}
+
+// Begin starts a Record for r and wraps w so status and size can be captured.
+// The returned request carries the Record in its context.
+func Begin(w http.ResponseWriter, r *http.Request) (*Record, http.ResponseWriter, *http.Request) {
+	rec := &Record{
+		Entry: Entry{
+			ClientIP:  clientIP(r),
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		},
+		start: time.Now(),
+		rw:    &ResponseWriter{ResponseWriter: w},
+	}
+	return rec, rec.rw, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec))
+}
+
+// FromContext returns the Record stored in ctx, or nil.
+func FromContext(ctx context.Context) *Record {
+	rec, _ := ctx.Value(recordKey{}).(*Record)
+	return rec
+}
+
+// Attempt notes that the request is being sent to backend.
+func (rec *Record) Attempt(backend string) {
+	if rec == nil {
+		return
+	}
+	rec.Attempts++
+	rec.Backend = backend
+}
+
+// Log completes rec and writes it, subject to sampling.
+func (l *Logger) Log(rec *Record) {
+	if l == nil || rec == nil {
+		return
+	}
+	rec.Time = rec.start
+	rec.Duration = time.Since(rec.start)
+	rec.Status = rec.rw.Status()
+	rec.Bytes = rec.rw.Bytes()
+
+	if rec.Status < 400 && l.sample > 0 && l.sample < 1 && rand.Float64() >= l.sample {
+		return
+	}
+
+	var line []byte
+	switch l.format {
+	case FormatJSON:
+		line = formatJSON(&rec.Entry)
+	default:
+		line = formatApache(&rec.Entry, l.format == FormatCombined)
+	}
+	l.mu.Lock()
+	l.out.Write(line)
+	l.mu.Unlock()
+}
+
+// formatApache renders the Common or Combined log format, followed by the
+// duration in milliseconds, backend, attempt count, request ID and time
+// spent queued in milliseconds.
+func formatApache(e *Entry, combined bool) []byte {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %q %d %s",
+		dash(e.ClientIP), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.Path+" "+e.Proto, e.Status, bytes)
+	if combined {
+		line += fmt.Sprintf(" %q %q", dash(e.Referer), dash(e.UserAgent))
+	}
+	line += fmt.Sprintf(" %d %q %d %s %d\n",
+		e.Duration.Milliseconds(), dash(e.Backend), e.Attempts, dash(e.RequestID), e.QueueWait.Milliseconds())
+	return []byte(line)
+}
+
+func formatJSON(e *Entry) []byte {
+	line, _ := json.Marshal(struct {
+		*Entry
+		Time        string  `json:"time"`
+		DurationMs  float64 `json:"duration_ms"`
+		QueueWaitMs float64 `json:"queue_wait_ms"`
+	}{e, e.Time.Format(time.RFC3339Nano),
+		float64(e.Duration.Microseconds()) / 1000, float64(e.QueueWait.Microseconds()) / 1000})
+	return append(line, '\n')
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
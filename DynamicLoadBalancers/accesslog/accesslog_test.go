@@ -0,0 +1,171 @@
+package AccessLog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// buffer is an io.WriteCloser the tests can read back.
+type buffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *buffer) Close() error { return nil }
+
+func (b *buffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// serve runs one request with status through l.
+func serve(l *Logger, status int) {
+	r := httptest.NewRequest(http.MethodGet, "/path?q=1", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	rec, w, _ := Begin(httptest.NewRecorder(), r)
+	rec.RequestID = "req-1"
+	rec.Attempt("http://backend-0/")
+	w.WriteHeader(status)
+	fmt.Fprint(w, "hello")
+	l.Log(rec)
+}
+
+func TestFormats(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		want   []string
+	}{
+		{FormatCommon, []string{`192.0.2.1 - - [`, `] "GET /path?q=1 HTTP/1.1" 201 5 `, ` "http://backend-0/" 1 req-1 0`}},
+		{FormatCombined, []string{`"GET /path?q=1 HTTP/1.1" 201 5 "-" "test-agent" `}},
+	} {
+		t.Run(c.format, func(t *testing.T) {
+			out := &buffer{}
+			serve(&Logger{out: out, format: c.format}, http.StatusCreated)
+			line := out.lines()[0]
+			for _, want := range c.want {
+				if !strings.Contains(line, want) {
+					t.Errorf("%q does not have %q", line, want)
+				}
+			}
+		})
+	}
+
+	out := &buffer{}
+	serve(&Logger{out: out, format: FormatJSON}, http.StatusCreated)
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(out.lines()[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]interface{}{"status": 201.0, "bytes": 5.0, "backend": "http://backend-0/", "attempts": 1.0, "request_id": "req-1", "user_agent": "test-agent"} {
+		if entry[field] != want {
+			t.Errorf("json %v: got %v, want %v", field, entry[field], want)
+		}
+	}
+	if _, ok := entry["duration_ms"]; !ok {
+		t.Errorf("json has no duration_ms: %v", entry)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	out := &buffer{}
+	l := &Logger{out: out, format: FormatCommon, sample: 0.25}
+	for i := 0; i < 2000; i++ {
+		serve(l, http.StatusOK)
+	}
+	for i := 0; i < 100; i++ {
+		serve(l, http.StatusBadGateway)
+	}
+	ok, failed := 0, 0
+	for _, line := range out.lines() {
+		if strings.Contains(line, `" 200 `) {
+			ok++
+		} else if strings.Contains(line, `" 502 `) {
+			failed++
+		}
+	}
+	if failed != 100 {
+		t.Errorf("logged %d of 100 errors, want every one", failed)
+	}
+	if ok < 400 || ok > 600 {
+		t.Errorf("logged %d of 2000 successes, want about 500", ok)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+	rf, err := openRotating(name, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 10; i++ {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Two lines fit in 100 bytes, so 10 lines make five files of which the
+	// current one and two backups are kept.
+	for _, f := range []string{name, name + ".1", name + ".2"} {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 2*len(line) {
+			t.Errorf("%v has %d bytes, want %d", filepath.Base(f), len(data), 2*len(line))
+		}
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%v.3 kept past max_backups: %v", filepath.Base(name), err)
+	}
+
+	// Reopening appends to what is there.
+	rf, err = openRotating(name, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if rf.size != int64(2*len(line)) {
+		t.Errorf("reopened at %d bytes, want %d", rf.size, 2*len(line))
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"disabled", Config{}, true},
+		{"stdout", Config{File: "-", Format: FormatJSON}, true},
+		{"unknown format", Config{File: "-", Format: "xml"}, false},
+		{"sample above 1", Config{File: "-", SampleSuccess: 1.5}, false},
+		{"sample below 0", Config{File: "-", SampleSuccess: -0.1}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			l, err := New(c.cfg)
+			if (err == nil) != c.ok {
+				t.Fatalf("got %v, want ok %v", err, c.ok)
+			}
+			l.Close()
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package ACL
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//	   ___  _______
+//	  / _ |/ ___/ /
+//	 / __ / /__/ /__
+//	/_/ |_\___/____/
+//
+
+// Config allows or denies clients by address. Entries are CIDRs or single
+// addresses. Deny is checked first; when Allow is set every address it
+// does not cover is denied too.
+type Config struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Internal covers loopback and private ranges. It is the default for the
+// admin API.
+var Internal = Config{Allow: []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}}
+
+// List is a parsed Config.
+type List struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// New parses cfg, or returns nil when it is empty.
+func New(cfg Config) (*List, error) {
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 {
+		return nil, nil
+	}
+	allow, err := ParseNets(cfg.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("acl: allow: %v", err)
+	}
+	deny, err := ParseNets(cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("acl: deny: %v", err)
+	}
+	return &List{allow, deny}, nil
+}
+
+// Check returns nil when ip may pass, otherwise why it may not. A nil List
+// lets everything through.
+func (l *List) Check(ip net.IP) error {
+	if l == nil {
+		return nil
+	}
+	if n := match(l.deny, ip); n != nil {
+		return fmt.Errorf("%v is in deny %v", ip, n)
+	}
+	if len(l.allow) > 0 && match(l.allow, ip) == nil {
+		return fmt.Errorf("%v is not in the allow list", ip)
+	}
+	return nil
+}
+
+// ParseNets parses CIDRs, turning bare addresses into /32 or /128 nets.
+func ParseNets(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR", e)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				e += "/32"
+			} else {
+				e += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func match(nets []*net.IPNet, ip net.IP) *net.IPNet {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return n
+		}
+	}
+	return nil
+}
+
+// ClientIP works out who sent r. The peer address is used unless it is one
+// of trusted; then X-Forwarded-For is walked from the right and the first
+// hop that is not a trusted proxy wins, falling back to X-Real-IP. Peers
+// on Unix sockets count as loopback.
+func ClientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	ip := PeerIP(r)
+	if match(trusted, ip) == nil {
+		return ip
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	if len(hops) == 0 {
+		if real := parseIP(r.Header.Get("X-Real-IP")); real != nil {
+			return real
+		}
+		return ip
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseIP(hops[i])
+		if hop == nil {
+			// Whatever is left of a malformed hop cannot be believed.
+			return ip
+		}
+		ip = hop
+		if match(trusted, ip) == nil {
+			return ip
+		}
+	}
+	return ip
+}
+
+// PeerIP is the address of the connection r came in on.
+func PeerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := parseIP(host); ip != nil {
+		return ip
+	}
+	return net.IPv4(127, 0, 0, 1).To4()
+}
+
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"example.com/loadbalancers/core"
+)
+
+// adminFlags are shared by the commands that talk to a running instance.
+type adminFlags struct {
+	fs       *flag.FlagSet
+	socket   *string
+	json     *bool
+	maxConns *int
+}
+
+func newAdminFlags(name string) adminFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	socket := os.Getenv("LB_ADMIN_SOCKET")
+	if socket == "" {
+		socket = Core.DefaultAdminSocket
+	}
+	return adminFlags{
+		fs:       fs,
+		socket:   fs.String("socket", socket, "admin socket of the running balancer"),
+		json:     fs.Bool("json", false, "print JSON instead of a table"),
+		maxConns: fs.Int("max-conns", 0, "max_conns for backend add, 0 uses the proxy default"),
+	}
+}
+
+// parse accepts flags before and after positional arguments and returns
+// the positionals.
+func (f adminFlags) parse(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := f.fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if f.fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, f.fs.Arg(0))
+		args = f.fs.Args()[1:]
+	}
+}
+
+func status(args []string) error {
+	f := newAdminFlags("status")
+	if _, err := f.parse(args); err != nil {
+		return err
+	}
+	st, err := Core.NewAdminClient(*f.socket).Status()
+	if err != nil {
+		return err
+	}
+	if *f.json {
+		return printJSON(st)
+	}
+	printStatus(st)
+	return nil
+}
+
+func backend(args []string) error {
+	f := newAdminFlags("backend")
+	positional, err := f.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: loadbalancer backend add|remove|drain <url>")
+	}
+	client := Core.NewAdminClient(*f.socket)
+	action, u := positional[0], positional[1]
+	switch action {
+	case "add":
+		err = client.AddBackend(u, *f.maxConns)
+	case "remove":
+		err = client.RemoveBackend(u)
+	case "drain":
+		err = client.DrainBackend(u)
+	default:
+		return fmt.Errorf("unknown backend action %q, want add, remove or drain", action)
+	}
+	if err != nil {
+		return err
+	}
+	if *f.json {
+		return printJSON(map[string]string{"action": action, "url": u, "result": "ok"})
+	}
+	fmt.Printf("%v %v: ok\n", action, u)
+	return nil
+}
+
+func printStatus(st Core.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tSTATE\tACTIVE\tMAX_CONNS")
+	for _, b := range st.Backends {
+		state := "alive"
+		if b.Dead {
+			state = "dead"
+		}
+		if b.Draining {
+			state = "draining"
+		}
+		maxConns := "-"
+		if b.MaxConns > 0 {
+			maxConns = fmt.Sprint(b.MaxConns)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", b.URL, state, b.Active, maxConns)
+	}
+	w.Flush()
+	q := st.Queue
+	fmt.Printf("\nqueue: %d/%d waiting, %d queued, %d rejected, %d timed out\n",
+		q.Depth, q.MaxDepth, q.Queued, q.Rejected, q.TimedOut)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/internal/lbtest"
+)
+
+// startAdmin serves the admin API of a one backend balancer on a socket
+// in a temporary directory and returns the socket's path.
+func startAdmin(t *testing.T) (string, *LbTest.Harness) {
+	t.Helper()
+	h := LbTest.Start(t, 1, Core.Config{}, Core.Options{})
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	l, err := Core.ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: h.Balancer.AdminHandler()}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return path, h
+}
+
+// stdout runs cmd with args and returns what it printed.
+func stdout(t *testing.T, cmd func([]string) error, args ...string) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	cmdErr := cmd(args)
+	os.Stdout = saved
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), cmdErr
+}
+
+// TestAdminCommands runs status and backend against a live admin socket,
+// as tables and as JSON.
+func TestAdminCommands(t *testing.T) {
+	socket, h := startAdmin(t)
+	extra := LbTest.NewBackend(t, "extra")
+
+	out, err := stdout(t, backend, "add", extra.URL, "--socket", socket, "--max-conns=5")
+	if err != nil || out != "add "+extra.URL+": ok\n" {
+		t.Fatalf("backend add: got %q, %v", out, err)
+	}
+	if _, err := stdout(t, backend, "add", extra.URL, "--socket", socket); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Fatalf("backend add again: got %v, want a 409", err)
+	}
+	out, err = stdout(t, backend, "--socket", socket, "--json", "drain", extra.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result map[string]string
+	if err := json.Unmarshal([]byte(out), &result); err != nil || result["action"] != "drain" || result["url"] != extra.URL || result["result"] != "ok" {
+		t.Fatalf("backend drain --json: got %q, %v", out, err)
+	}
+
+	out, err = stdout(t, status, "--socket", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			rows[fields[0]] = strings.Join(fields[1:], " ")
+		}
+	}
+	if rows["URL"] != "STATE ACTIVE MAX_CONNS" || rows[h.Backends[0].URL] != "alive 0 -" || rows[extra.URL] != "draining 0 5" || !strings.HasPrefix(rows["queue:"], "0/") {
+		t.Fatalf("status: got\n%v", out)
+	}
+	out, err = stdout(t, status, "--json", "--socket", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st Core.Status
+	if err := json.Unmarshal([]byte(out), &st); err != nil || len(st.Backends) != 2 || !st.Backends[1].Draining {
+		t.Fatalf("status --json: got %q, %v", out, err)
+	}
+
+	if _, err := stdout(t, backend, "remove", extra.URL, "--socket", socket); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdout(t, backend, "remove", extra.URL, "--socket", socket); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("backend remove again: got %v, want a 404", err)
+	}
+
+	for _, args := range [][]string{
+		{"add"},
+		{"rename", extra.URL},
+		{"add", extra.URL, "--no-such-flag"},
+	} {
+		if _, err := stdout(t, backend, append(args, "--socket", socket)...); err == nil {
+			t.Errorf("backend %v: no error", args)
+		}
+	}
+	t.Setenv("LB_ADMIN_SOCKET", filepath.Join(t.TempDir(), "none.sock"))
+	if _, err := stdout(t, status); err == nil {
+		t.Error("status reached a socket $LB_ADMIN_SOCKET does not name")
+	}
+}
@@ -0,0 +1,274 @@
+package Auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+//	   ___       __  __
+//	  / _ |__ __/ /_/ /
+//	 / __ / // / __/ _ \
+//	/_/ |_\_,_/\__/_//_/
+//
+
+// Authentication methods.
+const (
+	APIKey = "api_key"
+	Basic  = "basic"
+	JWT    = "jwt"
+)
+
+// Config is the auth policy of a route. A request is let through when any
+// of Methods accepts it.
+type Config struct {
+	Methods []string `json:"methods"` // "api_key", "basic", "jwt"; empty disables auth
+
+	APIKeysFile  string `json:"api_keys_file"`  // one "key name" per line, # comments
+	APIKeyHeader string `json:"api_key_header"` // default X-API-Key
+
+	HtpasswdFile string `json:"htpasswd_file"` // bcrypt, apr1 or {SHA} entries
+	Realm        string `json:"realm"`         // default "loadbalancer"
+
+	JWT JWTConfig `json:"jwt"`
+
+	// ForwardIdentity sets X-Auth-Method, X-Auth-Subject and, for JWTs,
+	// X-Auth-Issuer and X-Auth-Scope on the upstream request. Headers with
+	// the X-Auth- prefix sent by the client are always removed.
+	ForwardIdentity bool `json:"forward_identity"`
+}
+
+// IdentityPrefix starts every identity header.
+const IdentityPrefix = "X-Auth-"
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	Method  string
+	Subject string
+	Issuer  string
+	Scope   string
+}
+
+// Error is an authentication failure. Status is 401 when credentials are
+// missing or wrong and 403 when they are valid but not allowed.
+type Error struct {
+	Status int
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+func unauthorized(format string, a ...interface{}) *Error {
+	return &Error{http.StatusUnauthorized, fmt.Sprintf(format, a...)}
+}
+
+func forbidden(format string, a ...interface{}) *Error {
+	return &Error{http.StatusForbidden, fmt.Sprintf(format, a...)}
+}
+
+// errNoCredentials means the method found nothing of its own to check.
+var errNoCredentials = errors.New("no credentials")
+
+// Policy checks requests against one route's Config.
+type Policy struct {
+	methods      []string
+	apiKeys      map[string]string // key -> name
+	apiKeyHeader string
+	htpasswd     map[string]string // user -> hash
+	realm        string
+	jwt          *jwtVerifier
+	forward      bool
+}
+
+// New loads the files cfg names and returns its Policy, or nil when auth
+// is disabled.
+func New(cfg Config) (*Policy, error) {
+	if len(cfg.Methods) == 0 {
+		return nil, nil
+	}
+	p := &Policy{
+		methods:      cfg.Methods,
+		apiKeyHeader: cfg.APIKeyHeader,
+		realm:        cfg.Realm,
+		forward:      cfg.ForwardIdentity,
+	}
+	if p.apiKeyHeader == "" {
+		p.apiKeyHeader = "X-API-Key"
+	}
+	if p.realm == "" {
+		p.realm = "loadbalancer"
+	}
+	for _, m := range cfg.Methods {
+		if m != APIKey && m != Basic && m != JWT {
+			return nil, fmt.Errorf("auth: unknown method %q", m)
+		}
+	}
+	var err error
+	for _, m := range cfg.Methods {
+		switch m {
+		case APIKey:
+			if p.apiKeys, err = loadAPIKeys(cfg.APIKeysFile); err != nil {
+				return nil, err
+			}
+		case Basic:
+			if p.htpasswd, err = loadHtpasswd(cfg.HtpasswdFile); err != nil {
+				return nil, err
+			}
+		case JWT:
+			if p.jwt, err = newJWTVerifier(cfg.JWT); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// Check authenticates r, removes client-supplied identity headers and,
+// with ForwardIdentity, adds the verified ones. A nil Policy lets every
+// request through.
+func (p *Policy) Check(r *http.Request) (*Identity, *Error) {
+	if p == nil {
+		return nil, nil
+	}
+	StripIdentity(r.Header)
+
+	var failure *Error
+	for _, m := range p.methods {
+		var id *Identity
+		var err error
+		switch m {
+		case APIKey:
+			id, err = p.checkAPIKey(r)
+		case Basic:
+			id, err = p.checkBasic(r)
+		case JWT:
+			id, err = p.jwt.check(r)
+		}
+		if err == errNoCredentials {
+			continue
+		}
+		if err != nil {
+			// Keep the most specific failure: a forbidden token beats a
+			// wrong password on another method.
+			e, ok := err.(*Error)
+			if !ok {
+				e = unauthorized("%v: %v", m, err)
+			}
+			if failure == nil || e.Status == http.StatusForbidden {
+				failure = e
+			}
+			continue
+		}
+		if p.forward {
+			r.Header.Set(IdentityPrefix+"Method", id.Method)
+			r.Header.Set(IdentityPrefix+"Subject", id.Subject)
+			if id.Issuer != "" {
+				r.Header.Set(IdentityPrefix+"Issuer", id.Issuer)
+			}
+			if id.Scope != "" {
+				r.Header.Set(IdentityPrefix+"Scope", id.Scope)
+			}
+		}
+		return id, nil
+	}
+	if failure == nil {
+		failure = unauthorized("no credentials")
+	}
+	return nil, failure
+}
+
+// StripIdentity removes every identity header from h. The balancer calls
+// it on each request, with or without a policy, so a client can never pose
+// as a verified identity to a backend.
+func StripIdentity(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(name, IdentityPrefix) {
+			h.Del(name)
+		}
+	}
+}
+
+// Challenge sets WWW-Authenticate for a 401 answer.
+func (p *Policy) Challenge(w http.ResponseWriter) {
+	for _, m := range p.methods {
+		switch m {
+		case Basic:
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", p.realm))
+		case JWT:
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", p.realm))
+		}
+	}
+}
+
+func (p *Policy) checkAPIKey(r *http.Request) (*Identity, error) {
+	key := r.Header.Get(p.apiKeyHeader)
+	if key == "" {
+		return nil, errNoCredentials
+	}
+	for k, name := range p.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return &Identity{Method: APIKey, Subject: name}, nil
+		}
+	}
+	return nil, unauthorized("api_key: unknown key")
+}
+
+func (p *Policy) checkBasic(r *http.Request) (*Identity, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, errNoCredentials
+	}
+	hash, known := p.htpasswd[user]
+	if !known || !checkPassword(hash, pass) {
+		return nil, unauthorized("basic: bad user or password for %q", user)
+	}
+	return &Identity{Method: Basic, Subject: user}, nil
+}
+
+// loadAPIKeys reads "key [name]" lines. The name defaults to the line
+// number so keys never show up in headers or logs.
+func loadAPIKeys(path string) (map[string]string, error) {
+	keys := map[string]string{}
+	err := readLines(path, func(n int, line string) error {
+		fields := strings.Fields(line)
+		name := fmt.Sprintf("key-%d", n)
+		if len(fields) > 1 {
+			name = fields[1]
+		}
+		keys[fields[0]] = name
+		return nil
+	})
+	if err == nil && len(keys) == 0 {
+		err = fmt.Errorf("auth: %v: no keys", path)
+	}
+	return keys, err
+}
+
+// readLines calls fn for every non-blank, non-comment line of path.
+func readLines(path string, fn func(n int, line string) error) error {
+	if path == "" {
+		return fmt.Errorf("auth: file not set")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("auth: %v", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			return fmt.Errorf("auth: %v:%d: %v", path, n, err)
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,124 @@
+package Auth
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//	   ___           _
+//	  / _ )___ ____ (_)___
+//	 / _  / _ `(_-</ / __/
+//	/____/\_,_/___/_/\__/
+//
+
+// loadHtpasswd reads "user:hash" lines as written by htpasswd -B, -m or -s.
+func loadHtpasswd(path string) (map[string]string, error) {
+	users := map[string]string{}
+	err := readLines(path, func(n int, line string) error {
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("want user:hash")
+		}
+		if !knownHash(hash) {
+			return fmt.Errorf("%v: unsupported hash, use bcrypt, apr1 or {SHA}", user)
+		}
+		users[user] = hash
+		return nil
+	})
+	if err == nil && len(users) == 0 {
+		err = fmt.Errorf("auth: %v: no users", path)
+	}
+	return users, err
+}
+
+func knownHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPassword reports whether pass matches an htpasswd hash.
+func checkPassword(hash, pass string) bool {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		want := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(want)) == 1
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt := strings.TrimPrefix(hash, "$apr1$")
+		if i := strings.IndexByte(salt, '$'); i >= 0 {
+			salt = salt[:i]
+		}
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(apr1(pass, salt))) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+}
+
+// apr1 is Apache's MD5-based crypt.
+func apr1(pass, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	const magic = "$apr1$"
+	alt := md5.Sum([]byte(pass + salt + pass))
+	h := md5.New()
+	h.Write([]byte(pass + magic + salt))
+	for i := len(pass); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		h.Write(alt[:n])
+	}
+	for i := len(pass); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write([]byte{pass[0]})
+		}
+	}
+	sum := h.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 == 1 {
+			h.Write([]byte(pass))
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write([]byte(pass))
+		}
+		if i&1 == 1 {
+			h.Write(sum)
+		} else {
+			h.Write([]byte(pass))
+		}
+		sum = h.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out []byte
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, idx := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(sum[idx[0]])<<16|uint(sum[idx[1]])<<8|uint(sum[idx[2]]), 4)
+	}
+	encode(uint(sum[11]), 2)
+	return magic + salt + "$" + string(out)
+}
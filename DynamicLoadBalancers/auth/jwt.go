@@ -0,0 +1,282 @@
+package Auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//	     _____      __________
+//	 __ / / | /| / /_  __/ __/
+//	/ // /| |/ |/ / / / _\ \
+//	\___/ |__/|__/ /_/ /___/
+//
+
+// JWTConfig validates bearer tokens signed with HS256 or RS256.
+type JWTConfig struct {
+	Secret     string            `json:"secret"`       // HS256 shared secret
+	SecretFile string            `json:"secret_file"`  // or read it from a file
+	JWKSFile   string            `json:"jwks_file"`    // local JWKS with RSA and oct keys
+	Issuer     string            `json:"issuer"`       // required iss when set
+	Audience   string            `json:"audience"`     // required in aud when set
+	Claims     map[string]string `json:"claims"`       // claim must equal, or contain when it is a list
+	Leeway     string            `json:"leeway"`       // clock skew allowed on exp and nbf, default 30s
+	AllowNoExp bool              `json:"allow_no_exp"` // accept tokens without exp, which never expire
+}
+
+type jwtVerifier struct {
+	secret   []byte
+	rsaKeys  map[string]*rsa.PublicKey // kid -> key
+	hmacKeys map[string][]byte
+	issuer   string
+	audience string
+	claims   map[string]string
+	leeway   time.Duration
+	noExp    bool
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func newJWTVerifier(cfg JWTConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{
+		secret:   []byte(cfg.Secret),
+		rsaKeys:  map[string]*rsa.PublicKey{},
+		hmacKeys: map[string][]byte{},
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		claims:   cfg.Claims,
+		leeway:   30 * time.Second,
+		noExp:    cfg.AllowNoExp,
+	}
+	if cfg.Leeway != "" {
+		d, err := time.ParseDuration(cfg.Leeway)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("auth: jwt.leeway: bad duration %q", cfg.Leeway)
+		}
+		v.leeway = d
+	}
+	if cfg.SecretFile != "" {
+		b, err := ioutil.ReadFile(cfg.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %v", err)
+		}
+		v.secret = []byte(strings.TrimSpace(string(b)))
+	}
+	if cfg.JWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, fmt.Errorf("auth: %v: %v", cfg.JWKSFile, err)
+		}
+	}
+	if len(v.secret) == 0 && len(v.rsaKeys) == 0 && len(v.hmacKeys) == 0 {
+		return nil, fmt.Errorf("auth: jwt needs a secret or a jwks_file")
+	}
+	return v, nil
+}
+
+func (v *jwtVerifier) loadJWKS(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return err
+	}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+				return fmt.Errorf("key %v: bad RSA modulus or exponent", i)
+			}
+			v.rsaKeys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("key %v: bad oct key", i)
+			}
+			v.hmacKeys[k.Kid] = secret
+		default:
+			return fmt.Errorf("key %v: unsupported kty %q", i, k.Kty)
+		}
+	}
+	if len(v.rsaKeys) == 0 && len(v.hmacKeys) == 0 {
+		return fmt.Errorf("no signing keys")
+	}
+	return nil
+}
+
+func (v *jwtVerifier) check(r *http.Request) (*Identity, error) {
+	authz := r.Header.Get("Authorization")
+	if len(authz) < 7 || !strings.EqualFold(authz[:7], "Bearer ") {
+		return nil, errNoCredentials
+	}
+	claims, err := v.verify(strings.TrimSpace(authz[7:]))
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{Method: JWT}
+	id.Subject, _ = claims["sub"].(string)
+	id.Issuer, _ = claims["iss"].(string)
+	switch scope := claims["scope"].(type) {
+	case string:
+		id.Scope = scope
+	case []interface{}:
+		id.Scope = strings.Join(claimStrings(scope), " ")
+	}
+	return id, nil
+}
+
+// verify checks the signature and registered claims of token and returns
+// its claims.
+func (v *jwtVerifier) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, unauthorized("jwt: malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, unauthorized("jwt: bad header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, unauthorized("jwt: bad signature encoding")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// The algorithm comes from the token but each key only verifies its own
+	// kind, so "none" or an RSA key used as an HMAC secret never pass.
+	switch header.Alg {
+	case "HS256":
+		secret := v.secret
+		if k, ok := v.hmacKeys[header.Kid]; ok {
+			secret = k
+		}
+		if len(secret) == 0 {
+			return nil, unauthorized("jwt: no HS256 key for kid %q", header.Kid)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, unauthorized("jwt: bad signature")
+		}
+	case "RS256":
+		key, ok := v.rsaKeys[header.Kid]
+		if !ok {
+			return nil, unauthorized("jwt: no RS256 key for kid %q", header.Kid)
+		}
+		sum := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) != nil {
+			return nil, unauthorized("jwt: bad signature")
+		}
+	default:
+		return nil, unauthorized("jwt: unsupported alg %q", header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, unauthorized("jwt: bad claims: %v", err)
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok && !v.noExp {
+		return nil, unauthorized("jwt: no exp")
+	}
+	if ok && now.After(unixTime(exp).Add(v.leeway)) {
+		return nil, unauthorized("jwt: expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(unixTime(nbf)) {
+		return nil, unauthorized("jwt: not valid yet")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, forbidden("jwt: issuer %v not allowed", claims["iss"])
+	}
+	if v.audience != "" && !claimHas("aud", claims["aud"], v.audience) {
+		return nil, forbidden("jwt: audience %v not allowed", claims["aud"])
+	}
+	for name, want := range v.claims {
+		if !claimHas(name, claims[name], want) {
+			return nil, forbidden("jwt: claim %v does not allow %q", name, want)
+		}
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(int64(sec), 0)
+}
+
+// claimHas reports whether the claim called name is want, or lists it.
+// Only scope is a space-separated list when it is a string.
+func claimHas(name string, claim interface{}, want string) bool {
+	switch c := claim.(type) {
+	case string:
+		if c == want {
+			return true
+		}
+		if name != "scope" {
+			return false
+		}
+		for _, s := range strings.Fields(c) {
+			if s == want {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, s := range claimStrings(c) {
+			if s == want {
+				return true
+			}
+		}
+	case bool, float64:
+		return fmt.Sprint(c) == want
+	}
+	return false
+}
+
+func claimStrings(list []interface{}) []string {
+	var out []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package Compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+//	  _____
+//	 / ___/__  __ _  ___  _______ ___ ___
+//	/ /__/ _ \/  ' \/ _ \/ __/ -_|_-<(_-<
+//	\___/\___/_/_/_/ .__/_/  \__/___/___/
+//	              /_/
+
+// Supported content codings.
+const (
+	Brotli = "br"
+	Gzip   = "gzip"
+)
+
+// Config enables response compression on a route.
+type Config struct {
+	Enabled      bool     `json:"enabled"`
+	Encodings    []string `json:"encodings"`     // server preference, default ["br", "gzip"]
+	MinSize      int      `json:"min_size"`      // bytes, default 1024
+	ContentTypes []string `json:"content_types"` // allowlist, "text/*" style wildcards allowed
+	Level        int      `json:"level"`         // 0 uses each encoder's default
+}
+
+var defaultContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+json",
+	"image/svg+xml",
+}
+
+// Compressor negotiates an encoding per request and compresses eligible
+// responses on the fly.
+type Compressor struct {
+	encodings    []string
+	minSize      int
+	contentTypes []string
+	level        int
+	gzipPool     sync.Pool
+}
+
+// New builds a Compressor, or returns nil when cfg is disabled.
+func New(cfg Config) (*Compressor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	c := &Compressor{
+		encodings:    cfg.Encodings,
+		minSize:      cfg.MinSize,
+		contentTypes: cfg.ContentTypes,
+		level:        cfg.Level,
+	}
+	if len(c.encodings) == 0 {
+		c.encodings = []string{Brotli, Gzip}
+	}
+	for _, e := range c.encodings {
+		if e != Brotli && e != Gzip {
+			return nil, fmt.Errorf("compress: unsupported encoding %q", e)
+		}
+	}
+	if c.minSize == 0 {
+		c.minSize = 1024
+	}
+	if len(c.contentTypes) == 0 {
+		c.contentTypes = defaultContentTypes
+	}
+	if c.level == 0 {
+		c.level = gzip.DefaultCompression
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, c.level); err != nil {
+		return nil, fmt.Errorf("compress: %v", err)
+	}
+	return c, nil
+}
+
+// Wrap returns a writer that compresses the response when the client accepts
+// one of the configured encodings, and a func that must be called once the
+// handler is done to flush the encoder.
+func (c *Compressor) Wrap(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	if c == nil {
+		return w, func() {}
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	encoding := negotiate(r.Header.Get("Accept-Encoding"), c.encodings)
+	if encoding == "" || r.Method == http.MethodHead {
+		return w, func() {}
+	}
+	cw := &responseWriter{ResponseWriter: w, c: c, encoding: encoding}
+	return cw, cw.finish
+}
+
+// negotiate picks the best offered encoding by the client's q-values, ties
+// going to the server's preference order.
+func negotiate(header string, offered []string) string {
+	if header == "" {
+		return ""
+	}
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		weight := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					weight = v
+				}
+			}
+		}
+		q[name] = weight
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range offered {
+		weight, ok := q[enc]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// allowedType reports whether contentType matches the allowlist.
+func (c *Compressor) allowedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.contentTypes {
+		if t == mediaType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compressor) newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == Brotli {
+		level := brotli.DefaultCompression
+		if c.level >= brotli.BestSpeed && c.level <= brotli.BestCompression {
+			level = c.level
+		}
+		return brotli.NewWriterLevel(w, level)
+	}
+	if gz, ok := c.gzipPool.Get().(*gzip.Writer); ok {
+		gz.Reset(w)
+		return gz
+	}
+	gz, _ := gzip.NewWriterLevel(w, c.level)
+	return gz
+}
+
+func (c *Compressor) releaseEncoder(enc io.WriteCloser) {
+	if gz, ok := enc.(*gzip.Writer); ok {
+		c.gzipPool.Put(gz)
+	}
+}
@@ -0,0 +1,146 @@
+package Compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiate(t *testing.T) {
+	both := []string{Brotli, Gzip}
+	for _, c := range []struct {
+		header  string
+		offered []string
+		want    string
+	}{
+		{"", both, ""},
+		{"gzip", both, Gzip},
+		{"gzip, br", both, Brotli},
+		{"gzip, br", []string{Gzip, Brotli}, Gzip},
+		{"br;q=0.5, gzip", both, Gzip},
+		{"br;q=0, gzip;q=0", both, ""},
+		{"*", both, Brotli},
+		{"*;q=0.1, gzip;q=0.2", both, Gzip},
+		{"deflate, identity", both, ""},
+		{" GZIP ; q=0.8 ", both, Gzip},
+	} {
+		if got := negotiate(c.header, c.offered); got != c.want {
+			t.Errorf("negotiate(%q, %v) = %q, want %q", c.header, c.offered, got, c.want)
+		}
+	}
+}
+
+// respond serves body with header through a Compressor built from cfg and
+// returns the recorded response.
+func respond(t *testing.T, cfg Config, method, acceptEncoding string, header http.Header, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	cfg.Enabled = true
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	w, finish := c.Wrap(rec, r)
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.Write([]byte(body))
+	finish()
+	return rec
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var out []byte
+	var err error
+	switch encoding {
+	case Gzip:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(body)); err == nil {
+			out, err = ioutil.ReadAll(zr)
+		}
+	case Brotli:
+		out, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	default:
+		out = body
+	}
+	if err != nil {
+		t.Fatalf("decoding %v: %v", encoding, err)
+	}
+	return string(out)
+}
+
+func TestWrap(t *testing.T) {
+	large := strings.Repeat("compress me please ", 100)
+	text := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+	for _, c := range []struct {
+		name           string
+		cfg            Config
+		method, accept string
+		header         http.Header
+		body           string
+		want           string // Content-Encoding
+	}{
+		{"gzip", Config{}, http.MethodGet, "gzip", text, large, Gzip},
+		{"brotli preferred", Config{}, http.MethodGet, "gzip, br", text, large, Brotli},
+		{"not accepted", Config{}, http.MethodGet, "", text, large, ""},
+		{"below min size", Config{}, http.MethodGet, "gzip", text, "short", ""},
+		{"custom min size", Config{MinSize: 4}, http.MethodGet, "gzip", text, "short", Gzip},
+		{"type not allowed", Config{}, http.MethodGet, "gzip", http.Header{"Content-Type": {"image/png"}}, large, ""},
+		{"wildcard type", Config{ContentTypes: []string{"application/*"}}, http.MethodGet, "gzip", http.Header{"Content-Type": {"application/vnd.api+json"}}, large, Gzip},
+		{"sniffed type", Config{}, http.MethodGet, "gzip", nil, large, Gzip},
+		{"already encoded", Config{}, http.MethodGet, "gzip", http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"zstd"}}, large, "zstd"},
+		{"no-transform", Config{}, http.MethodGet, "gzip", http.Header{"Content-Type": {"text/plain"}, "Cache-Control": {"no-transform"}}, large, ""},
+		{"head", Config{}, http.MethodHead, "gzip", text, large, ""},
+		{"gzip only", Config{Encodings: []string{Gzip}}, http.MethodGet, "br", text, large, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rec := respond(t, c.cfg, c.method, c.accept, c.header, c.body)
+			got := rec.Header().Get("Content-Encoding")
+			if got != c.want {
+				t.Fatalf("Content-Encoding %q, want %q", got, c.want)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary %q, want Accept-Encoding", rec.Header().Get("Vary"))
+			}
+			if c.method == http.MethodHead || got == "zstd" {
+				return
+			}
+			if body := decode(t, got, rec.Body.Bytes()); body != c.body {
+				t.Errorf("body of %d bytes came back as %d", len(c.body), len(body))
+			}
+		})
+	}
+}
+
+func TestWrapETag(t *testing.T) {
+	header := http.Header{"Content-Type": {"text/plain"}, "Etag": {`"v1"`}, "Content-Length": {"1900"}}
+	rec := respond(t, Config{}, http.MethodGet, "gzip", header, strings.Repeat("x", 1900))
+	if rec.Header().Get("ETag") != `W/"v1"` || rec.Header().Get("Content-Length") != "" {
+		t.Fatalf("compressed response kept ETag %q and Content-Length %q", rec.Header().Get("ETag"), rec.Header().Get("Content-Length"))
+	}
+}
+
+func TestNew(t *testing.T) {
+	if c, err := New(Config{}); c != nil || err != nil {
+		t.Fatalf("disabled: got %v, %v", c, err)
+	}
+	for _, cfg := range []Config{
+		{Enabled: true, Encodings: []string{"deflate"}},
+		{Enabled: true, Level: 42},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%+v: accepted", cfg)
+		}
+	}
+}
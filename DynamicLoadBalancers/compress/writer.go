@@ -0,0 +1,133 @@
+package Compress
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// responseWriter holds back the status line until it knows whether the
+// body is worth compressing: the type must be allowed, nothing may already
+// be encoded, and the body must reach MinSize.
+type responseWriter struct {
+	http.ResponseWriter
+	c        *Compressor
+	encoding string
+
+	status  int
+	decided bool
+	enc     io.WriteCloser
+	buf     []byte
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = code
+	// Decide now when the headers alone settle it.
+	h := w.Header()
+	if !w.eligible() {
+		w.decide(false)
+		return
+	}
+	if cl := h.Get("Content-Length"); cl != "" && h.Get("Content-Type") != "" {
+		n, err := strconv.Atoi(cl)
+		w.decide(err == nil && n >= w.c.minSize)
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.c.minSize {
+		w.decide(true)
+	}
+	return len(b), nil
+}
+
+// Flush decides on whatever has been buffered so streamed responses are not
+// held back, then flushes the encoder and the connection. A flush before any
+// body was written is ignored so the decision can still wait for the body.
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		if len(w.buf) == 0 {
+			return
+		}
+		w.decide(len(w.buf) >= w.c.minSize)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// eligible checks everything except size.
+func (w *responseWriter) eligible() bool {
+	h := w.Header()
+	switch {
+	case w.status < 200, w.status == http.StatusNoContent,
+		w.status == http.StatusNotModified, w.status == http.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "" && h.Get("Content-Encoding") != "identity":
+		return false
+	case strings.Contains(h.Get("Cache-Control"), "no-transform"):
+		return false
+	case h.Get("Content-Type") != "" && !w.c.allowedType(h.Get("Content-Type")):
+		return false
+	}
+	return true
+}
+
+func (w *responseWriter) decide(compress bool) {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if compress && w.eligible() {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = w.c.newEncoder(w.encoding, w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		if w.enc != nil {
+			w.enc.Write(w.buf)
+		} else {
+			w.ResponseWriter.Write(w.buf)
+		}
+		w.buf = nil
+	}
+}
+
+// finish writes out anything still buffered and closes the encoder.
+func (w *responseWriter) finish() {
+	if !w.decided && w.status != 0 {
+		w.decide(false)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		w.c.releaseEncoder(w.enc)
+		w.enc = nil
+	}
+}
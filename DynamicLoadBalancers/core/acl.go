@@ -0,0 +1,152 @@
+package Core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"example.com/loadbalancers/accesslog"
+	"example.com/loadbalancers/acl"
+	"example.com/loadbalancers/auth"
+	"example.com/loadbalancers/compress"
+)
+
+//	   ___  _______
+//	  / _ |/ ___/ /
+//	 / __ / /__/ /__
+//	/_/ |_\___/____/
+//
+
+// policy is the part of the config applied to each request: routes with
+// their compression, auth and ACLs, plus the listener and admin ACLs. It
+// is swapped as a whole on reload.
+type policy struct {
+	routes    []Route
+	trusted   []*net.IPNet
+	listeners map[string]*ACL.List
+	admin     *ACL.List
+}
+
+func newPolicy(cfg Config) (*policy, error) {
+	p := &policy{listeners: map[string]*ACL.List{}}
+	var err error
+	p.routes = append([]Route(nil), cfg.Routes...)
+	for i := range p.routes {
+		route := &p.routes[i]
+		if route.compressor, err = Compress.New(route.Compression); err != nil {
+			return nil, err
+		}
+		if route.auth, err = Auth.New(route.Auth); err != nil {
+			return nil, err
+		}
+		if route.acl, err = ACL.New(route.ACL); err != nil {
+			return nil, err
+		}
+	}
+	if p.trusted, err = ACL.ParseNets(cfg.Proxy.TrustedProxies); err != nil {
+		return nil, err
+	}
+	for entry, c := range cfg.Proxy.ListenACL {
+		if p.listeners[entry], err = ACL.New(c); err != nil {
+			return nil, err
+		}
+	}
+	// A deny-only admin ACL narrows the internal ranges, it does not
+	// open the admin API to everyone else.
+	admin := cfg.Proxy.AdminACL
+	if len(admin.Allow) == 0 {
+		admin.Allow = ACL.Internal.Allow
+	}
+	if p.admin, err = ACL.New(admin); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (b *Balancer) policy() *policy {
+	return b.pol.Load().(*policy)
+}
+
+// Reload applies the routes, ACLs and trusted proxies of cfg. The old ones
+// stay in force when cfg has errors. Other settings need a restart or an
+// upgrade.
+func (b *Balancer) Reload(cfg Config) error {
+	p, err := newPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	b.pol.Store(p)
+	return nil
+}
+
+// checkACL applies the listener and route ACLs to r, answering it with a
+// 403 when either refuses. It records the client address it settled on.
+func (b *Balancer) checkACL(w http.ResponseWriter, r *http.Request, p *policy, route *Route, rec *AccessLog.Record) bool {
+	ip := ACL.ClientIP(r, p.trusted)
+	rec.ClientIP = ip.String()
+	entry, _ := r.Context().Value(listenerKey{}).(string)
+	err := p.listeners[entry].Check(ip)
+	if err == nil && route != nil {
+		err = route.acl.Check(ip)
+	}
+	if err == nil {
+		return true
+	}
+	Logf(LogWarning, "ACL denied %v %v on %v (request %v): %v", r.Method, r.URL.Path, entry, rec.RequestID, err)
+	httpError(w, r, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return false
+}
+
+// adminACL only lets TCP callers covered by the admin ACL reach h.
+// Forwarded headers are never believed here, and the admin socket is
+// guarded by its file permissions instead.
+func (b *Balancer) adminACL(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ip := ACL.PeerIP(r)
+		if err := b.policy().admin.Check(ip); err != nil {
+			Logf(LogWarning, "ACL denied admin %v %v: %v", r.Method, r.URL.Path, err)
+			writeAdmin(w, http.StatusForbidden, adminError{"forbidden"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// listenerKey carries the proxy.listen entry a request came in on.
+type listenerKey struct{}
+
+// taggedListener marks its connections with the entry it serves.
+type taggedListener struct {
+	net.Listener
+	entry string
+}
+
+type taggedConn struct {
+	net.Conn
+	entry string
+}
+
+func (l taggedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return taggedConn{c, l.entry}, nil
+}
+
+// listenerContext is an http.Server ConnContext that puts the listener
+// entry of c in the request context.
+func listenerContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if tc, ok := c.(taggedConn); ok {
+		ctx = context.WithValue(ctx, listenerKey{}, tc.entry)
+	}
+	return ctx
+}
@@ -0,0 +1,117 @@
+package Core_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/loadbalancers/acl"
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/internal/lbtest"
+)
+
+// aclCase is one request with a forwarded client address.
+type aclCase struct {
+	path   string
+	xff    string
+	status int
+}
+
+func checkACLCases(t *testing.T, h *LbTest.Harness, stage string, cases []aclCase) {
+	t.Helper()
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, h.Proxy.URL+c.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.xff != "" {
+			req.Header.Set("X-Forwarded-For", c.xff)
+		}
+		resp, err := h.Client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%v: %v from %q: got %v, want %v", stage, c.path, c.xff, resp.StatusCode, c.status)
+		}
+	}
+}
+
+// TestACL checks route ACLs against the client address, that forwarded
+// headers only count from trusted proxies and that Reload swaps the rules.
+func TestACL(t *testing.T) {
+	cfg := Core.Config{
+		Proxy: Core.Proxy{TrustedProxies: []string{"127.0.0.1"}},
+		Routes: []Core.Route{
+			{Path: "/", ACL: ACL.Config{Deny: []string{"203.0.113.0/24"}}},
+			{Path: "/internal", ACL: ACL.Config{Allow: []string{"10.0.0.0/8"}}},
+		},
+	}
+	h := LbTest.Start(t, 1, cfg, Core.Options{})
+
+	checkACLCases(t, h, "trusted", []aclCase{
+		{"/", "", http.StatusOK},
+		{"/", "203.0.113.7", http.StatusForbidden},
+		{"/", "198.51.100.1", http.StatusOK},
+		{"/internal", "10.1.2.3", http.StatusOK},
+		{"/internal", "8.8.8.8", http.StatusForbidden},
+		{"/internal", "10.1.2.3, 8.8.8.8", http.StatusForbidden},
+		{"/internal", "8.8.8.8, 10.1.2.3", http.StatusOK},
+		{"/internal", "not-an-ip", http.StatusForbidden},
+	})
+
+	// Without trusted proxies the headers are ignored: the peer is loopback.
+	cfg.Proxy.TrustedProxies = nil
+	cfg.Routes[1].ACL = ACL.Config{Allow: []string{"10.0.0.0/8", "127.0.0.1"}, Deny: []string{"127.0.0.1"}}
+	if err := h.Balancer.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkACLCases(t, h, "reloaded", []aclCase{
+		{"/", "203.0.113.7", http.StatusOK},
+		{"/internal", "10.1.2.3", http.StatusForbidden},
+	})
+
+	bad := cfg
+	bad.Routes = []Core.Route{{Path: "/", ACL: ACL.Config{Allow: []string{"10.0.0.0/33"}}}}
+	if err := h.Balancer.Reload(bad); err == nil {
+		t.Fatal("reload accepted a bad CIDR")
+	}
+	checkACLCases(t, h, "after bad reload", []aclCase{{"/internal", "", http.StatusForbidden}})
+}
+
+// TestAdminACL checks the admin API only answers callers its ACL allows,
+// ignoring forwarded headers. Loopback is in the internal ranges it
+// defaults to.
+func TestAdminACL(t *testing.T) {
+	h := LbTest.Start(t, 1, Core.Config{}, Core.Options{})
+	admin := httptest.NewServer(h.Balancer.AdminHandler())
+	defer admin.Close()
+
+	for _, c := range []struct {
+		name   string
+		acl    ACL.Config
+		status int
+	}{
+		{"default", ACL.Config{}, http.StatusOK},
+		{"allow elsewhere", ACL.Config{Allow: []string{"10.0.0.0/8"}}, http.StatusForbidden},
+		{"deny elsewhere", ACL.Config{Deny: []string{"10.0.0.0/8"}}, http.StatusOK},
+		{"deny loopback", ACL.Config{Deny: []string{"127.0.0.0/8"}}, http.StatusForbidden},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if err := h.Balancer.Reload(Core.Config{Proxy: Core.Proxy{AdminACL: c.acl}}); err != nil {
+				t.Fatal(err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, admin.URL+"/status", nil)
+			req.Header.Set("X-Forwarded-For", "10.0.0.1")
+			resp, err := h.Client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.status {
+				t.Fatalf("got %v, want %v", resp.StatusCode, c.status)
+			}
+		})
+	}
+}
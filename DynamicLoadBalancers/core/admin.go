@@ -0,0 +1,231 @@
+package Core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"example.com/loadbalancers/queue"
+)
+
+//	   ___     __      _
+//	  / _ |___/ /_ _  (_)__
+//	 / __ / _  /  ' \/ / _ \
+//	/_/ |_\_,_/_/_/_/_/_//_/
+//
+
+// DefaultAdminSocket is where the admin API listens unless
+// proxy.admin_socket says otherwise: in $XDG_RUNTIME_DIR, or else in a
+// directory of the user's own under the temp dir, so other users can
+// neither call the API nor put a socket of theirs in its place.
+var DefaultAdminSocket = filepath.Join(adminDir(), "loadbalancer.sock")
+
+func adminDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("loadbalancer-%d", os.Getuid()))
+}
+
+// privateDir creates dir with mode 0700 when it is missing, and refuses
+// it when it is not a directory only the current user can get into.
+func privateDir(dir string) error {
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() || fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%v is not a directory private to this user", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%v belongs to uid %v", dir, st.Uid)
+	}
+	return nil
+}
+
+// Status is the admin API's view of a running balancer.
+type Status struct {
+	Backends []BackendStatus `json:"backends"`
+	Queue    Queue.Stats     `json:"queue"`
+}
+
+// BackendRequest names a backend in admin API calls.
+type BackendRequest struct {
+	URL      string `json:"url"`
+	MaxConns int    `json:"max_conns,omitempty"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// AdminHandler serves the admin API:
+//
+//	GET    /status            pool and queue snapshot
+//	POST   /backends          add {"url", "max_conns"}
+//	DELETE /backends?url=...  remove
+//	POST   /backends/drain    drain {"url"}
+//
+// Callers outside proxy.admin_acl get a 403.
+func (b *Balancer) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeAdmin(w, http.StatusMethodNotAllowed, adminError{"method not allowed"})
+			return
+		}
+		writeAdmin(w, http.StatusOK, Status{b.Backends(), b.QueueStats()})
+	})
+	mux.HandleFunc("/backends", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req BackendRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeAdmin(w, http.StatusBadRequest, adminError{err.Error()})
+				return
+			}
+			err := b.AddBackend(req.URL, req.MaxConns)
+			if err == nil {
+				Logf(LogInfo, "Backend added by admin : %v", req.URL)
+			}
+			writeAdminResult(w, http.StatusCreated, err)
+		case http.MethodDelete:
+			u := r.URL.Query().Get("url")
+			err := b.RemoveBackend(u)
+			if err == nil {
+				Logf(LogInfo, "Backend removed by admin : %v", u)
+			}
+			writeAdminResult(w, http.StatusOK, err)
+		default:
+			writeAdmin(w, http.StatusMethodNotAllowed, adminError{"method not allowed"})
+		}
+	})
+	mux.HandleFunc("/backends/drain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAdmin(w, http.StatusMethodNotAllowed, adminError{"method not allowed"})
+			return
+		}
+		var req BackendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdmin(w, http.StatusBadRequest, adminError{err.Error()})
+			return
+		}
+		err := b.DrainBackend(req.URL)
+		if err == nil {
+			Logf(LogInfo, "Backend draining by admin : %v", req.URL)
+		}
+		writeAdminResult(w, http.StatusOK, err)
+	})
+	return b.adminACL(mux)
+}
+
+// writeAdminResult answers a pool change with the new status, or the error.
+func writeAdminResult(w http.ResponseWriter, code int, err error) {
+	switch {
+	case err == nil:
+		writeAdmin(w, code, struct{}{})
+	case errors.Is(err, ErrBackendExists):
+		writeAdmin(w, http.StatusConflict, adminError{err.Error()})
+	case errors.Is(err, ErrBackendUnknown):
+		writeAdmin(w, http.StatusNotFound, adminError{err.Error()})
+	default:
+		writeAdmin(w, http.StatusBadRequest, adminError{err.Error()})
+	}
+}
+
+func writeAdmin(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ListenUnix listens on a Unix socket at path, replacing a stale socket
+// file left by a process that is gone.
+func ListenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%v is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// AdminClient calls the admin API of a running balancer.
+type AdminClient struct {
+	client *http.Client
+}
+
+// NewAdminClient returns a client for the admin socket at path.
+func NewAdminClient(path string) *AdminClient {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	return &AdminClient{client: &http.Client{
+		Transport: &http.Transport{DialContext: dial},
+		Timeout:   10 * time.Second,
+	}}
+}
+
+// Status fetches the pool and queue snapshot.
+func (c *AdminClient) Status() (Status, error) {
+	var status Status
+	err := c.do(http.MethodGet, "/status", nil, &status)
+	return status, err
+}
+
+// AddBackend adds rawURL to the pool.
+func (c *AdminClient) AddBackend(rawURL string, maxConns int) error {
+	return c.do(http.MethodPost, "/backends", BackendRequest{rawURL, maxConns}, nil)
+}
+
+// RemoveBackend removes rawURL from the pool.
+func (c *AdminClient) RemoveBackend(rawURL string) error {
+	return c.do(http.MethodDelete, "/backends?url="+url.QueryEscape(rawURL), nil, nil)
+}
+
+// DrainBackend drains rawURL.
+func (c *AdminClient) DrainBackend(rawURL string) error {
+	return c.do(http.MethodPost, "/backends/drain", BackendRequest{URL: rawURL}, nil)
+}
+
+func (c *AdminClient) do(method, path string, body, out interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, "http://admin"+path, &buf)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e adminError
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("admin: %v: %v", resp.Status, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,149 @@
+package Core_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/internal/lbtest"
+)
+
+// adminCall sends one request to the admin API and returns its status and
+// body.
+func adminCall(t *testing.T, h *LbTest.Harness, admin *httptest.Server, method, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, admin.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%v %v: Content-Type %q", method, path, ct)
+	}
+	return resp.StatusCode, string(b)
+}
+
+// TestAdminHandler walks a backend through add, drain and remove over
+// HTTP, with the errors for duplicates, unknown backends, bad bodies and
+// wrong methods.
+func TestAdminHandler(t *testing.T) {
+	h := LbTest.Start(t, 1, Core.Config{}, Core.Options{})
+	admin := httptest.NewServer(h.Balancer.AdminHandler())
+	defer admin.Close()
+	extra := LbTest.NewBackend(t, "extra")
+	add := `{"url":"` + extra.URL + `","max_conns":3}`
+	drain := `{"url":"` + extra.URL + `"}`
+	remove := "/backends?url=" + url.QueryEscape(extra.URL)
+
+	for _, c := range []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"add", http.MethodPost, "/backends", add, http.StatusCreated},
+		{"add again", http.MethodPost, "/backends", add, http.StatusConflict},
+		{"add bad url", http.MethodPost, "/backends", `{"url":"::nope"}`, http.StatusBadRequest},
+		{"add bad json", http.MethodPost, "/backends", `{"url":`, http.StatusBadRequest},
+		{"drain", http.MethodPost, "/backends/drain", drain, http.StatusOK},
+		{"drain unknown", http.MethodPost, "/backends/drain", `{"url":"http://127.0.0.1:1"}`, http.StatusNotFound},
+		{"drain bad json", http.MethodPost, "/backends/drain", `nope`, http.StatusBadRequest},
+		{"drain by get", http.MethodGet, "/backends/drain", "", http.StatusMethodNotAllowed},
+		{"backends by get", http.MethodGet, "/backends", "", http.StatusMethodNotAllowed},
+		{"status by post", http.MethodPost, "/status", "", http.StatusMethodNotAllowed},
+	} {
+		if status, body := adminCall(t, h, admin, c.method, c.path, c.body); status != c.status {
+			t.Fatalf("%v: got %v %s, want %v", c.name, status, body, c.status)
+		}
+	}
+
+	status, body := adminCall(t, h, admin, http.MethodGet, "/status", "")
+	if status != http.StatusOK {
+		t.Fatalf("status: got %v %s", status, body)
+	}
+	var st Core.Status
+	if err := json.Unmarshal([]byte(body), &st); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Backends) != 2 || st.Backends[0].URL != h.Backends[0].URL {
+		t.Fatalf("status: got %+v, want the configured backend and the added one", st.Backends)
+	}
+	if b := st.Backends[1]; b.URL != extra.URL || !b.Draining || b.MaxConns != 3 {
+		t.Fatalf("added backend: got %+v, want it draining with max_conns 3", b)
+	}
+
+	if status, body := adminCall(t, h, admin, http.MethodDelete, remove, ""); status != http.StatusOK {
+		t.Fatalf("remove: got %v %s", status, body)
+	}
+	if status, body := adminCall(t, h, admin, http.MethodDelete, remove, ""); status != http.StatusNotFound {
+		t.Fatalf("remove again: got %v %s, want 404", status, body)
+	}
+	if got := h.Balancer.Backends(); len(got) != 1 || got[0].URL != h.Backends[0].URL {
+		t.Fatalf("after remove: got %+v", got)
+	}
+}
+
+// TestAdminClient drives the admin API over a Unix socket the way the
+// status and backend commands do.
+func TestAdminClient(t *testing.T) {
+	h := LbTest.Start(t, 1, Core.Config{}, Core.Options{})
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	l, err := Core.ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the socket file on close, as a killed process would
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	srv := &http.Server{Handler: h.Balancer.AdminHandler()}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	if _, err := Core.ListenUnix(path); err == nil {
+		t.Fatal("listened on a socket in use")
+	}
+
+	client := Core.NewAdminClient(path)
+	extra := LbTest.NewBackend(t, "extra")
+	if err := client.AddBackend(extra.URL, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddBackend(extra.URL, 0); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Fatalf("add again: got %v, want a 409", err)
+	}
+	if err := client.DrainBackend(extra.URL); err != nil {
+		t.Fatal(err)
+	}
+	st, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Backends) != 2 || st.Backends[1].URL != extra.URL || !st.Backends[1].Draining {
+		t.Fatalf("status: got %+v", st.Backends)
+	}
+	if err := client.RemoveBackend(extra.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveBackend(extra.URL); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("remove again: got %v, want a 404", err)
+	}
+
+	// A socket left by a process that is gone is replaced
+	srv.Close()
+	if l, err = Core.ListenUnix(path); err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	l.Close()
+}
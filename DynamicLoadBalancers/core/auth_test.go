@@ -0,0 +1,184 @@
+package Core_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"example.com/loadbalancers/auth"
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/internal/lbtest"
+)
+
+// authCase is one request against the protected route.
+type authCase struct {
+	name    string
+	header  map[string]string
+	basic   []string
+	status  int
+	subject string // expected forwarded X-Auth-Subject
+}
+
+// TestAuth puts API key, Basic and JWT auth on /private and checks good
+// credentials pass with the identity forwarded, bad ones get 401 or 403,
+// spoofed identity headers never reach the backend and routes without a
+// policy stay open.
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("hs256-shared-secret")
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "rsa-1", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	files := map[string]string{
+		"keys":     "# key name\nk-123 ci-bot\nk-456\n",
+		"htpasswd": "ann:" + string(bcryptHash) + "\nbob:$apr1$r31bLOGf$H7rHTDSBcoguTHd46lKxx.\ncat:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n",
+		"jwks":     string(jwks),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := Core.Config{Routes: []Core.Route{{
+		Path: "/private",
+		Auth: Auth.Config{
+			Methods:      []string{Auth.APIKey, Auth.Basic, Auth.JWT},
+			APIKeysFile:  filepath.Join(dir, "keys"),
+			HtpasswdFile: filepath.Join(dir, "htpasswd"),
+			JWT: Auth.JWTConfig{
+				Secret:   string(secret),
+				JWKSFile: filepath.Join(dir, "jwks"),
+				Issuer:   "https://issuer.test",
+				Audience: "lb",
+				Claims:   map[string]string{"scope": "read", "role": "admin"},
+			},
+			ForwardIdentity: true,
+		},
+	}, {
+		Path: "/lenient",
+		Auth: Auth.Config{
+			Methods: []string{Auth.JWT},
+			JWT:     Auth.JWTConfig{Secret: string(secret), AllowNoExp: true},
+		},
+	}}}
+	h := LbTest.Start(t, 1, cfg, Core.Options{})
+
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "user-1", "iss": "https://issuer.test", "aud": []string{"lb", "other"}, "scope": "read write", "role": "admin", "exp": now + 60}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	bearer := func(alg, kid string, key interface{}, c map[string]interface{}) map[string]string {
+		token, err := LbTest.SignJWT(alg, kid, key, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+	otherKey := []byte("not-the-secret")
+
+	cases := []authCase{
+		{name: "no credentials", status: http.StatusUnauthorized},
+		{name: "api key", header: map[string]string{"X-API-Key": "k-123"}, status: http.StatusOK, subject: "ci-bot"},
+		{name: "unnamed api key", header: map[string]string{"X-API-Key": "k-456"}, status: http.StatusOK, subject: "key-3"},
+		{name: "unknown api key", header: map[string]string{"X-API-Key": "k-789"}, status: http.StatusUnauthorized},
+		{name: "basic bcrypt", basic: []string{"ann", "bcrypt-pass"}, status: http.StatusOK, subject: "ann"},
+		{name: "basic apr1", basic: []string{"bob", "secret"}, status: http.StatusOK, subject: "bob"},
+		{name: "basic sha", basic: []string{"cat", "password"}, status: http.StatusOK, subject: "cat"},
+		{name: "basic wrong password", basic: []string{"ann", "nope"}, status: http.StatusUnauthorized},
+		{name: "jwt rs256", header: bearer("RS256", "rsa-1", rsaKey, claims(nil)), status: http.StatusOK, subject: "user-1"},
+		{name: "jwt hs256", header: bearer("HS256", "", secret, claims(nil)), status: http.StatusOK, subject: "user-1"},
+		{name: "jwt wrong secret", header: bearer("HS256", "", otherKey, claims(nil)), status: http.StatusUnauthorized},
+		{name: "jwt unknown kid", header: bearer("RS256", "rsa-2", rsaKey, claims(nil)), status: http.StatusUnauthorized},
+		{name: "jwt alg none", header: bearer("none", "", nil, claims(nil)), status: http.StatusUnauthorized},
+		{name: "jwt expired", header: bearer("HS256", "", secret, claims(map[string]interface{}{"exp": now - 3600})), status: http.StatusUnauthorized},
+		{name: "jwt without exp", header: bearer("HS256", "", secret, claims(map[string]interface{}{"exp": nil})), status: http.StatusUnauthorized},
+		{name: "jwt not yet valid", header: bearer("HS256", "", secret, claims(map[string]interface{}{"nbf": now + 3600})), status: http.StatusUnauthorized},
+		{name: "jwt wrong issuer", header: bearer("HS256", "", secret, claims(map[string]interface{}{"iss": "evil"})), status: http.StatusForbidden},
+		{name: "jwt wrong audience", header: bearer("HS256", "", secret, claims(map[string]interface{}{"aud": "other"})), status: http.StatusForbidden},
+		{name: "jwt missing scope", header: bearer("HS256", "", secret, claims(map[string]interface{}{"scope": "write"})), status: http.StatusForbidden},
+		{name: "jwt role is not a list", header: bearer("HS256", "", secret, claims(map[string]interface{}{"role": "user admin"})), status: http.StatusForbidden},
+		{name: "jwt role listed", header: bearer("HS256", "", secret, claims(map[string]interface{}{"role": []string{"user", "admin"}})), status: http.StatusOK, subject: "user-1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.header = withSpoof(c.header)
+			checkAuthCase(t, h, "/private/x", c)
+		})
+	}
+	// The open route neither asks for credentials nor lets spoofed
+	// identity through.
+	t.Run("open route", func(t *testing.T) {
+		checkAuthCase(t, h, "/public", authCase{name: "open route", header: withSpoof(nil), status: http.StatusOK})
+	})
+	// allow_no_exp accepts tokens that never expire.
+	t.Run("jwt without exp allowed", func(t *testing.T) {
+		c := authCase{header: bearer("HS256", "", secret, map[string]interface{}{"sub": "user-2"}), status: http.StatusOK}
+		checkAuthCase(t, h, "/lenient", c)
+	})
+}
+
+func withSpoof(header map[string]string) map[string]string {
+	out := map[string]string{Auth.IdentityPrefix + "Subject": "admin", Auth.IdentityPrefix + "Role": "root"}
+	for k, v := range header {
+		out[k] = v
+	}
+	return out
+}
+
+func checkAuthCase(t *testing.T, h *LbTest.Harness, path string, c authCase) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, h.Proxy.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range c.header {
+		req.Header.Set(k, v)
+	}
+	if c.basic != nil {
+		req.SetBasicAuth(c.basic[0], c.basic[1])
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != c.status {
+		t.Fatalf("got %v, want %v", resp.StatusCode, c.status)
+	}
+	if c.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatal("401 without WWW-Authenticate")
+	}
+	if c.status != http.StatusOK {
+		return
+	}
+	if got := resp.Header.Get("Echo-" + Auth.IdentityPrefix + "Subject"); got != c.subject {
+		t.Errorf("backend saw subject %q, want %q", got, c.subject)
+	}
+	if got := resp.Header.Get("Echo-" + Auth.IdentityPrefix + "Role"); got != "" {
+		t.Errorf("spoofed role %q reached the backend", got)
+	}
+}
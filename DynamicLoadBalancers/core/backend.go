@@ -0,0 +1,143 @@
+package Core
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+)
+
+// Backend states.
+const (
+	StateAlive int32 = iota
+	StateDead
+	StateDraining // takes no new requests; health checks leave it alone
+)
+
+// Backend is servers which load balancer is transferred.
+// The pool, health checks and in-flight requests all share one *Backend per
+// URL, so state lives in atomic fields rather than behind a lock.
+type Backend struct {
+	URL      string `json:"url"`
+	MaxConns int    `json:"max_conns"` // concurrent requests allowed, 0 is unlimited; fixed once pooled
+	state    int32
+	active   int32
+	target   *url.URL // URL parsed once when pooled
+	network  string   // "tcp" or "unix", dialed by the health check
+	address  string   // host:port or socket path
+	// transport dials the socket of a unix:// backend; nil uses the
+	// default transport.
+	transport http.RoundTripper
+}
+
+// newBackend parses rawURL and returns a live Backend for it. A
+// unix:///path/to.sock URL sends plain HTTP over that socket, and
+// h2c://host:port speaks HTTP/2 without TLS, as gRPC servers do.
+func newBackend(rawURL string, maxConns int) (*Backend, error) {
+	u, err := parseBackendURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	backend := &Backend{URL: rawURL, MaxConns: maxConns, target: u, network: "tcp", address: u.Host}
+	switch u.Scheme {
+	case "h2c":
+		backend.target = &url.URL{Scheme: "http", Host: u.Host, Path: u.Path}
+		backend.transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	case "unix":
+		path := u.Path
+		backend.target = &url.URL{Scheme: "http", Host: "localhost"}
+		backend.network, backend.address = "unix", path
+		backend.transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+			MaxIdleConnsPerHost: 16,
+		}
+	}
+	return backend, nil
+}
+
+// parseBackendURL accepts absolute http, https and h2c URLs, and unix://
+// URLs naming a socket path.
+func parseBackendURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "h2c":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%q: missing host", rawURL)
+		}
+	case "unix":
+		if u.Host != "" || u.Path == "" {
+			return nil, fmt.Errorf("%q: want unix:///path/to.sock", rawURL)
+		}
+	default:
+		return nil, fmt.Errorf("%q: scheme must be http, https, h2c or unix", rawURL)
+	}
+	return u, nil
+}
+
+// SetDead marks the backend dead or alive. A draining backend stays
+// draining.
+func (backend *Backend) SetDead(b bool) {
+	state := StateAlive
+	if b {
+		state = StateDead
+	}
+	for {
+		old := atomic.LoadInt32(&backend.state)
+		if old == StateDraining || atomic.CompareAndSwapInt32(&backend.state, old, state) {
+			return
+		}
+	}
+}
+
+// Drain takes the backend out of rotation for good while requests already
+// sent to it finish.
+func (backend *Backend) Drain() {
+	atomic.StoreInt32(&backend.state, StateDraining)
+}
+
+// State returns StateAlive, StateDead or StateDraining.
+func (backend *Backend) State() int32 {
+	return atomic.LoadInt32(&backend.state)
+}
+
+// GetIsDead reports whether the backend is out of rotation.
+func (backend *Backend) GetIsDead() bool {
+	return atomic.LoadInt32(&backend.state) == StateDead
+}
+
+// Active returns the number of requests in flight to the backend.
+func (backend *Backend) Active() int {
+	return int(atomic.LoadInt32(&backend.active))
+}
+
+// acquire takes a connection slot, reporting false when MaxConns is reached.
+func (backend *Backend) acquire() bool {
+	n := atomic.AddInt32(&backend.active, 1)
+	if backend.MaxConns > 0 && int(n) > backend.MaxConns {
+		atomic.AddInt32(&backend.active, -1)
+		return false
+	}
+	return true
+}
+
+// release gives back a slot taken by acquire.
+func (backend *Backend) release() {
+	atomic.AddInt32(&backend.active, -1)
+}
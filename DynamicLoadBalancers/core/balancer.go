@@ -0,0 +1,494 @@
+package Core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/loadbalancers/accesslog"
+	"example.com/loadbalancers/auth"
+	"example.com/loadbalancers/discovery"
+	"example.com/loadbalancers/queue"
+	"example.com/loadbalancers/tracing"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+//	   ___       __
+//	  / _ )___ _/ /__ ____  _______ ____
+//	 / _  / _ `/ / _ `/ _ \/ __/ -_) __/
+//	/____/\_,_/_/\_,_/_//_/\__/\__/_/
+//
+
+// Options selects strategy behaviour.
+type Options struct {
+	// Failover marks a backend dead when proxying to it fails and retries
+	// the request on the next live backend.
+	Failover bool
+	// HealthCheck is how often Run dials every backend, 0 for never.
+	HealthCheck time.Duration
+}
+
+// BackendStatus is a snapshot of one backend.
+type BackendStatus struct {
+	URL      string `json:"url"`
+	Dead     bool   `json:"dead"`
+	Draining bool   `json:"draining"`
+	Active   int    `json:"active"`
+	MaxConns int    `json:"max_conns"`
+}
+
+// Errors returned by the pool changes behind the admin API.
+var (
+	ErrBackendExists  = errors.New("backend already in the pool")
+	ErrBackendUnknown = errors.New("backend not in the pool")
+)
+
+// Balancer is a round robin reverse proxy over a pool of backends.
+type Balancer struct {
+	cfg  Config
+	opts Options
+
+	mu       sync.Mutex
+	idx      int
+	backends []*Backend
+
+	tracer    *Tracing.Tracer
+	accessLog *AccessLog.Logger
+	queue     *Queue.Queue
+	pol       atomic.Value // *policy
+}
+
+// New builds a Balancer from cfg.
+func New(cfg Config, opts Options) (*Balancer, error) {
+	b := &Balancer{cfg: cfg, opts: opts}
+	var err error
+
+	b.tracer, err = Tracing.New(cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	b.accessLog, err = AccessLog.New(cfg.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+	b.queue, err = Queue.New(cfg.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Reload(cfg); err != nil {
+		return nil, err
+	}
+
+	// Copy the configured backends so two balancers built from one Config
+	// never share state.
+	b.cfg.Backends = nil
+	urls := []string{}
+	for _, backend := range cfg.Backends {
+		if backend == nil {
+			continue
+		}
+		maxConns := backend.MaxConns
+		if maxConns == 0 {
+			maxConns = cfg.Proxy.MaxConns
+		}
+		pooled, err := newBackend(backend.URL, maxConns)
+		if err != nil {
+			return nil, err
+		}
+		b.cfg.Backends = append(b.cfg.Backends, pooled)
+		urls = append(urls, backend.URL)
+	}
+	b.SetBackends(urls)
+	return b, nil
+}
+
+// Close flushes spans and closes the access log.
+func (b *Balancer) Close() {
+	b.tracer.Shutdown()
+	b.accessLog.Close()
+}
+
+// Backends returns a snapshot of the pool.
+func (b *Balancer) Backends() []BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := make([]BackendStatus, len(b.backends))
+	for i, backend := range b.backends {
+		state := backend.State()
+		status[i] = BackendStatus{backend.URL, state == StateDead, state == StateDraining, backend.Active(), backend.MaxConns}
+	}
+	return status
+}
+
+// QueueStats returns the request queue counters.
+func (b *Balancer) QueueStats() Queue.Stats {
+	return b.queue.Stats()
+}
+
+// SetBackends swaps in a new backend list. A URL that is already pooled
+// keeps its *Backend, and with it its health state and in-flight count; a
+// new URL gets the configured Backend if there is one, or a fresh one with
+// the proxy's default MaxConns. URLs that do not parse are logged and left
+// out.
+func (b *Balancer) SetBackends(urls []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	known := map[string]*Backend{}
+	for _, backend := range b.cfg.Backends {
+		known[backend.URL] = backend
+	}
+	for _, backend := range b.backends {
+		known[backend.URL] = backend
+	}
+	backends := make([]*Backend, 0, len(urls))
+	for _, u := range urls {
+		backend, ok := known[u]
+		if !ok {
+			var err error
+			if backend, err = newBackend(u, b.cfg.Proxy.MaxConns); err != nil {
+				Logf(LogError, "Skipping backend: %v", err)
+				continue
+			}
+			known[u] = backend
+		}
+		backends = append(backends, backend)
+	}
+	b.backends = backends
+	b.dispatch()
+}
+
+// AddBackend appends rawURL to the pool. maxConns 0 uses the proxy default.
+// A discovery update replaces the whole pool, admin changes included.
+func (b *Balancer) AddBackend(rawURL string, maxConns int) error {
+	if maxConns == 0 {
+		maxConns = b.cfg.Proxy.MaxConns
+	}
+	backend, err := newBackend(rawURL, maxConns)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.find(rawURL) != nil {
+		return ErrBackendExists
+	}
+	b.backends = append(b.backends, backend)
+	b.dispatch()
+	return nil
+}
+
+// RemoveBackend drops rawURL from the pool. Requests already sent to it
+// finish normally.
+func (b *Balancer) RemoveBackend(rawURL string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	backends := make([]*Backend, 0, len(b.backends))
+	for _, backend := range b.backends {
+		if backend.URL != rawURL {
+			backends = append(backends, backend)
+		}
+	}
+	if len(backends) == len(b.backends) {
+		return ErrBackendUnknown
+	}
+	b.backends = backends
+	return nil
+}
+
+// DrainBackend stops sending new requests to rawURL but keeps it listed,
+// so its active count can be watched down to zero before removing it.
+func (b *Balancer) DrainBackend(rawURL string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	backend := b.find(rawURL)
+	if backend == nil {
+		return ErrBackendUnknown
+	}
+	backend.Drain()
+	return nil
+}
+
+// find returns the pooled backend for rawURL, or nil. Callers hold mu.
+func (b *Balancer) find(rawURL string) *Backend {
+	for _, backend := range b.backends {
+		if backend.URL == rawURL {
+			return backend
+		}
+	}
+	return nil
+}
+
+// WatchBackends keeps the pool in sync with the discovery providers until
+// ctx is done.
+func (b *Balancer) WatchBackends(ctx context.Context) {
+	if len(b.cfg.Discovery) == 0 {
+		return
+	}
+	static := make([]string, len(b.cfg.Backends))
+	for i, backend := range b.cfg.Backends {
+		static[i] = backend.URL
+	}
+	provider, err := Discovery.New(static, b.cfg.Discovery)
+	if err != nil {
+		Log(LogError, err.Error())
+		return
+	}
+	for urls := range provider.Watch(ctx) {
+		b.SetBackends(urls)
+		Logf(LogInfo, "Backends updated : %v", urls)
+	}
+}
+
+// HealthCheck dials every backend each interval and marks it dead or alive,
+// until ctx is done.
+func (b *Balancer) HealthCheck(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			b.checkBackends(interval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Balancer) checkBackends(timeout time.Duration) {
+	b.mu.Lock()
+	backends := append([]*Backend(nil), b.backends...)
+	b.mu.Unlock()
+
+	for _, backend := range backends {
+		alive := isAlive(backend.network, backend.address, timeout)
+		backend.SetDead(!alive)
+		msg := "ok"
+		if !alive {
+			msg = "dead"
+		}
+		Logf(LogInfo, "%v checked %v by healthcheck", backend.URL, msg)
+	}
+	// Revived backends take queued requests first.
+	b.mu.Lock()
+	b.dispatch()
+	b.mu.Unlock()
+}
+
+// isAlive checks if the backend accepts connections.
+func isAlive(network, address string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		Logf(LogError, "Unreachable to %v, error: %v", address, err.Error())
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Handler is the balancer as served on the listeners: with proxy.h2c set
+// it also accepts HTTP/2 without TLS.
+func (b *Balancer) Handler() http.Handler {
+	if !b.cfg.Proxy.H2C {
+		return b
+	}
+	return h2c.NewHandler(b, &http2.Server{})
+}
+
+// ServeHTTP traces, logs and compresses the request, then proxies it.
+func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	span, r := b.tracer.StartRequest(r)
+	defer span.Finish()
+	rec, w, r := AccessLog.Begin(w, r)
+	rec.RequestID = span.RequestID
+	defer b.accessLog.Log(rec)
+	Auth.StripIdentity(r.Header)
+	p := b.policy()
+	route := matchRoute(p.routes, r.URL.Path)
+	if !b.checkACL(w, r, p, route, rec) {
+		return
+	}
+	if route != nil {
+		if !b.authenticate(w, r, route, rec) {
+			return
+		}
+		var finish func()
+		w, finish = route.compressor.Wrap(w, r)
+		defer finish()
+	}
+	b.proxy(w, r, span, rec)
+}
+
+// authenticate applies the route's auth policy, answering r itself when it
+// is refused.
+func (b *Balancer) authenticate(w http.ResponseWriter, r *http.Request, route *Route, rec *AccessLog.Record) bool {
+	_, err := route.auth.Check(r)
+	if err == nil {
+		return true
+	}
+	Logf(LogWarning, "Auth refused %v %v from %v (request %v): %v", r.Method, r.URL.Path, rec.ClientIP, rec.RequestID, err.Reason)
+	if err.Status == http.StatusUnauthorized {
+		route.auth.Challenge(w)
+	}
+	httpError(w, r, http.StatusText(err.Status), err.Status)
+	return false
+}
+
+// pick takes a slot on the next live backend with spare capacity, round
+// robin. live is false when no backend is alive. Callers hold mu.
+func (b *Balancer) pick() (backend *Backend, live bool) {
+	maxLen := len(b.backends)
+	for n := 0; n < maxLen; n++ {
+		candidate := b.backends[(b.idx+n)%maxLen]
+		if candidate.State() != StateAlive {
+			continue
+		}
+		live = true
+		if candidate.acquire() {
+			b.idx += n + 1
+			return candidate, true
+		}
+	}
+	return nil, live
+}
+
+// next returns a backend with a free slot, waiting in the queue while every
+// live backend is at max_conns. It writes a 503 and returns nil on failure.
+func (b *Balancer) next(w http.ResponseWriter, r *http.Request, span *Tracing.Span, rec *AccessLog.Record) *Backend {
+	var backend *Backend
+	var ticket *Queue.Ticket
+	var err error
+	b.mu.Lock()
+	live := true // a non-empty queue means live backends were full
+	if b.queue.Len() == 0 {
+		backend, live = b.pick()
+	}
+	if backend == nil && live {
+		ticket, err = b.queue.Join()
+	}
+	b.mu.Unlock()
+	if backend != nil {
+		return backend
+	}
+	if !live {
+		httpError(w, r, "no backends available", http.StatusServiceUnavailable)
+		return nil
+	}
+	if err != nil {
+		Logf(LogWarning, "Queue full, rejecting request_id=%v", span.RequestID)
+		httpError(w, r, "all backends busy", http.StatusServiceUnavailable)
+		return nil
+	}
+	Logf(LogInfo, "Request queued, depth %v request_id=%v", b.queue.Len(), span.RequestID)
+	slot, waited, err := ticket.Wait(r.Context())
+	rec.QueueWait += waited
+	if err != nil {
+		Logf(LogWarning, "Gave up after %v in queue request_id=%v", waited, span.RequestID)
+		httpError(w, r, "all backends busy", http.StatusServiceUnavailable)
+		return nil
+	}
+	return slot.(*Backend)
+}
+
+// dispatch hands free slots to queued requests, oldest first, so a request
+// arriving later never overtakes one that waits. It runs whenever capacity
+// may have appeared: a slot released, a backend added or revived. Callers
+// hold mu.
+func (b *Balancer) dispatch() {
+	for b.queue.Len() > 0 {
+		backend, _ := b.pick()
+		if backend == nil {
+			return
+		}
+		if !b.queue.Hand(backend) {
+			backend.release()
+			return
+		}
+	}
+}
+
+// proxy sends the request to the next backend. With Failover, a failed
+// backend is marked dead and the request moves on to the next one.
+func (b *Balancer) proxy(w http.ResponseWriter, r *http.Request, span *Tracing.Span, rec *AccessLog.Record) {
+	backend := b.next(w, r, span, rec)
+	if backend == nil {
+		return
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			backend.release()
+			b.dispatch()
+			b.mu.Unlock()
+		})
+	}
+	defer release()
+
+	rec.Attempt(backend.URL)
+	upstream := span.StartChild("upstream " + backend.address)
+	upstream.SetAttr("backend", backend.URL)
+	upstream.Inject(r.Header)
+
+	reverseProxy := httputil.NewSingleHostReverseProxy(backend.target)
+	if backend.transport != nil {
+		reverseProxy.Transport = backend.transport
+	}
+	if isGRPC(r) {
+		// Stream every message as it arrives.
+		reverseProxy.FlushInterval = -1
+	}
+	reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, e error) {
+		upstream.SetError(e)
+		upstream.Finish()
+		if errors.Is(e, context.Canceled) || r.Context().Err() != nil {
+			// The client gave up, the backend is not to blame.
+			Logf(LogWarning, "Client left before %v answered request_id=%v", backend.URL, span.RequestID)
+			httpError(w, r, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		if !b.opts.Failover {
+			Logf(LogError, "%v failed: %v request_id=%v", backend.URL, e, span.RequestID)
+			httpError(w, r, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		Logf(LogError, "%v is dead. request_id=%v", backend.URL, span.RequestID)
+		backend.SetDead(true)
+		release()
+		if !canRetry(r) {
+			Logf(LogError, "%v %v cannot be sent again request_id=%v", r.Method, r.URL.Path, span.RequestID)
+			httpError(w, r, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				httpError(w, r, "bad gateway", http.StatusBadGateway)
+				return
+			}
+			r.Body = body
+		}
+		b.proxy(w, r, span, rec)
+	}
+	reverseProxy.ServeHTTP(w, r)
+	upstream.Finish()
+	Log(LogInfo, fmt.Sprintf("Requests Loaded to : %v request_id=%v", backend.URL, span.RequestID))
+}
+
+// canRetry reports whether r may be sent to another backend after one
+// failed: its method must be idempotent and its body empty, or buffered so
+// GetBody can replay it.
+func canRetry(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
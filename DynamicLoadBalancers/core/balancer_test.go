@@ -0,0 +1,254 @@
+package Core_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/internal/lbtest"
+	"example.com/loadbalancers/queue"
+)
+
+var strategies = []struct {
+	name string
+	opts Core.Options
+}{
+	{"round robin", Core.Options{}},
+	{"failover", Core.Options{Failover: true}},
+}
+
+func TestDistribution(t *testing.T) {
+	for _, s := range strategies {
+		t.Run(s.name, func(t *testing.T) {
+			const n = 3
+			h := LbTest.Start(t, n, Core.Config{}, s.opts)
+
+			res := h.Fire(n*50, 8)
+			if res.Errors > 0 || res.Codes[http.StatusOK] != n*50 {
+				t.Fatalf("got %v", res)
+			}
+			names := []string{}
+			for _, f := range h.Backends {
+				names = append(names, f.Name)
+			}
+			LbTest.CheckEven(t, h.Hits(), names, 0.1)
+		})
+	}
+}
+
+func TestFailover(t *testing.T) {
+	const n = 3
+	h := LbTest.Start(t, n, Core.Config{}, Core.Options{Failover: true})
+
+	crashed := h.Backends[0]
+	crashed.Crash()
+	res := h.Fire(n*20, 4)
+	if res.Errors > 0 || res.Codes[http.StatusOK] != n*20 {
+		t.Fatalf("clients saw failures: %v", res)
+	}
+	if !h.Dead(crashed) {
+		t.Fatalf("%v still in rotation", crashed.Name)
+	}
+	names := []string{}
+	for _, f := range h.Backends[1:] {
+		names = append(names, f.Name)
+	}
+	LbTest.CheckEven(t, h.Hits(), names, 0.25)
+}
+
+func TestHealthTransitions(t *testing.T) {
+	for _, s := range strategies {
+		t.Run(s.name, func(t *testing.T) {
+			const n = 3
+			h := LbTest.Start(t, n, Core.Config{}, s.opts)
+			h.StartHealthCheck(50 * time.Millisecond)
+
+			f := h.Backends[0]
+			f.Crash()
+			LbTest.WaitFor(t, 2*time.Second, f.Name+" marked dead", func() bool { return h.Dead(f) })
+			h.ResetHits()
+			res := h.Fire(n*10, 4)
+			if res.Errors > 0 || res.Codes[http.StatusOK] != n*10 {
+				t.Errorf("clients saw failures with %v dead: %v", f.Name, res)
+			}
+			if f.Hits() != 0 {
+				t.Errorf("dead %v still got %v requests", f.Name, f.Hits())
+			}
+
+			if err := f.Restart(); err != nil {
+				t.Fatal(err)
+			}
+			LbTest.WaitFor(t, 2*time.Second, f.Name+" revived", func() bool { return !h.Dead(f) })
+			h.ResetHits()
+			h.Fire(n*10, 4)
+			if f.Hits() == 0 {
+				t.Errorf("revived %v got no requests", f.Name)
+			}
+		})
+	}
+}
+
+// A mark from the health check survives the pool being swapped.
+func TestHealthSurvivesSetBackends(t *testing.T) {
+	h := LbTest.Start(t, 3, Core.Config{}, Core.Options{})
+	h.StartHealthCheck(50 * time.Millisecond)
+
+	f := h.Backends[0]
+	f.Crash()
+	LbTest.WaitFor(t, 2*time.Second, f.Name+" marked dead", func() bool { return h.Dead(f) })
+	urls := []string{}
+	for _, b := range h.Backends {
+		urls = append(urls, b.URL)
+	}
+	h.Balancer.SetBackends(urls)
+	if !h.Dead(f) {
+		t.Fatalf("%v revived by SetBackends", f.Name)
+	}
+	if res := h.Fire(60, 4); res.Errors > 0 || res.Codes[http.StatusOK] != 60 {
+		t.Fatalf("clients saw failures: %v", res)
+	}
+}
+
+// A client giving up is not the backend's fault: it stays in rotation.
+func TestClientCancelKeepsBackend(t *testing.T) {
+	h := LbTest.Start(t, 1, Core.Config{}, Core.Options{Failover: true})
+	f := h.Backends[0]
+	f.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, h.Proxy.URL+"/", nil)
+	if resp, err := h.Client.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("request outlived its context")
+	}
+	LbTest.WaitFor(t, 2*time.Second, "request finished", func() bool { return h.Balancer.Backends()[0].Active == 0 })
+	if h.Dead(f) {
+		t.Fatalf("%v marked dead by a client that left", f.Name)
+	}
+}
+
+// Only requests that can be sent again are retried on another backend.
+func TestFailoverRetries(t *testing.T) {
+	for _, c := range []struct {
+		method, body string
+		status       int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodDelete, "", http.StatusOK},
+		{http.MethodPut, "payload", http.StatusBadGateway},
+		{http.MethodPost, "", http.StatusBadGateway},
+		{http.MethodPost, "payload", http.StatusBadGateway},
+	} {
+		t.Run(c.method+" "+c.body, func(t *testing.T) {
+			h := LbTest.Start(t, 2, Core.Config{}, Core.Options{Failover: true})
+			crashed := h.Backends[0]
+			crashed.Crash()
+
+			var body io.Reader
+			if c.body != "" {
+				body = strings.NewReader(c.body)
+			}
+			req, _ := http.NewRequest(c.method, h.Proxy.URL+"/", body)
+			resp, err := h.Client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.status {
+				t.Fatalf("got %v, want %v", resp.StatusCode, c.status)
+			}
+			if !h.Dead(crashed) {
+				t.Fatalf("%v still in rotation", crashed.Name)
+			}
+			if c.status != http.StatusOK && h.Backends[1].Hits() != 0 {
+				t.Fatalf("the request was sent again")
+			}
+		})
+	}
+}
+
+// Requests beyond max_conns wait in the queue and all get through without
+// any backend going over its limit.
+func TestQueueUnderLoad(t *testing.T) {
+	cfg := Core.Config{
+		Proxy: Core.Proxy{MaxConns: 2},
+		Queue: Queue.Config{MaxDepth: 100, Timeout: "10s"},
+	}
+	h := LbTest.Start(t, 2, cfg, Core.Options{})
+	for _, f := range h.Backends {
+		f.SetLatency(20 * time.Millisecond)
+	}
+
+	res := h.Fire(80, 20)
+	if res.Errors > 0 || res.Codes[http.StatusOK] != 80 {
+		t.Fatalf("got %v", res)
+	}
+	for _, f := range h.Backends {
+		if p := f.PeakConcurrency(); p > 2 {
+			t.Errorf("%v served %v requests at once, max_conns is 2", f.Name, p)
+		}
+	}
+	if s := h.Balancer.QueueStats(); s.Queued == 0 || s.TimedOut != 0 || s.Depth != 0 {
+		t.Errorf("got %+v", s)
+	}
+}
+
+// A queued request takes capacity as soon as it appears, before the busy
+// backend frees up.
+func TestQueueNewCapacity(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		grow func(t *testing.T, h *LbTest.Harness, spare *LbTest.FakeBackend)
+	}{
+		{"added", func(t *testing.T, h *LbTest.Harness, spare *LbTest.FakeBackend) {
+			if err := h.Balancer.AddBackend(spare.URL, 1); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"revived", func(t *testing.T, h *LbTest.Harness, spare *LbTest.FakeBackend) {
+			if err := spare.Restart(); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := Core.Config{
+				Proxy: Core.Proxy{MaxConns: 1},
+				Queue: Queue.Config{MaxDepth: 10, Timeout: "10s"},
+			}
+			h := LbTest.Start(t, 2, cfg, Core.Options{})
+			busy, spare := h.Backends[0], h.Backends[1]
+			if c.name == "added" {
+				h.Balancer.RemoveBackend(spare.URL)
+			} else {
+				spare.Crash()
+				h.StartHealthCheck(20 * time.Millisecond)
+				LbTest.WaitFor(t, 2*time.Second, spare.Name+" marked dead", func() bool { return h.Dead(spare) })
+			}
+			busy.SetLatency(2 * time.Second)
+
+			done := make(chan time.Duration, 2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					start := time.Now()
+					h.Get("/")
+					done <- time.Since(start)
+				}()
+			}
+			LbTest.WaitFor(t, time.Second, "a request queued", func() bool { return h.Balancer.QueueStats().Depth == 1 })
+			c.grow(t, h, spare)
+
+			if d := <-done; d > time.Second {
+				t.Fatalf("queued request waited %v for the busy backend", d)
+			}
+			if spare.Hits() != 1 {
+				t.Fatalf("%v got %v requests", spare.Name, spare.Hits())
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package Core
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/loadbalancers/accesslog"
+	"example.com/loadbalancers/acl"
+	"example.com/loadbalancers/auth"
+	"example.com/loadbalancers/compress"
+	"example.com/loadbalancers/discovery"
+	"example.com/loadbalancers/queue"
+	"example.com/loadbalancers/tracing"
+)
+
+//	   _____          ____
+//	  / ___/__  ___  / _(_)__ _
+//	 / /__/ _ \/ _ \/ _/ / _ `/
+//	 \___/\___/_//_/_//_/\_, /
+//	                    /___/
+
+// Config is the balancer configuration shared by every strategy.
+type Config struct {
+	Proxy     Proxy              `json:"proxy"`
+	Backends  []*Backend         `json:"backends"`
+	Routes    []Route            `json:"routes"`
+	Discovery []Discovery.Config `json:"discovery"`
+	Queue     Queue.Config       `json:"queue"`
+	Tracing   Tracing.Config     `json:"tracing"`
+	AccessLog AccessLog.Config   `json:"access_log"`
+
+	path string // the file Load read it from, for reloads
+}
+
+// Proxy is a reverse proxy, and means load balancer.
+type Proxy struct {
+	Port        string `json:"port"`
+	MaxConns    int    `json:"max_conns"`    // default max_conns for backends that do not set one
+	AdminSocket string `json:"admin_socket"` // Unix socket for the admin API, "none" disables it
+
+	// Listen replaces Port with one or more listeners: "host:port",
+	// "unix:/path/to.sock", "systemd" for every socket passed by systemd
+	// socket activation, or "systemd:name" for the one named in
+	// FileDescriptorName=.
+	Listen     []string `json:"listen"`
+	SocketMode string   `json:"socket_mode"` // octal permissions for unix: listeners, e.g. "0660"
+
+	// TLSCert and TLSKey serve HTTPS, with HTTP/2 negotiated by ALPN. H2C
+	// accepts HTTP/2 without TLS (prior knowledge or Upgrade: h2c).
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	H2C     bool   `json:"h2c"`
+
+	// TrustedProxies are the addresses whose X-Forwarded-For and X-Real-IP
+	// headers are believed when working out the client address for ACLs.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// ListenACL restricts clients per listener, keyed by proxy.listen
+	// entry (":"+port when listen is not set).
+	ListenACL map[string]ACL.Config `json:"listen_acl"`
+
+	// AdminListen also serves the admin API on a TCP address. AdminACL
+	// guards it and the admin socket. Without allow entries it allows
+	// internal ranges, minus any deny entries.
+	AdminListen string     `json:"admin_listen"`
+	AdminACL    ACL.Config `json:"admin_acl"`
+}
+
+// Entries returns what the proxy listens on: Listen when set, otherwise
+// ":"+Port.
+func (p Proxy) Entries() []string {
+	if len(p.Listen) == 0 {
+		return []string{":" + p.Port}
+	}
+	return p.Listen
+}
+
+// Route applies per-path settings. The longest matching Path wins.
+type Route struct {
+	Path        string          `json:"path"`
+	Compression Compress.Config `json:"compression"`
+	Auth        Auth.Config     `json:"auth"`
+	ACL         ACL.Config      `json:"acl"`
+	compressor  *Compress.Compressor
+	auth        *Auth.Policy
+	acl         *ACL.List
+}
+
+// ConfigError lists every problem found in a config.
+type ConfigError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%v: %d config error(s):\n  %v", e.Path, len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+// SetDefaults fills in settings left empty.
+func (cfg *Config) SetDefaults() {
+	if cfg.Proxy.Port == "" {
+		cfg.Proxy.Port = "8080"
+	}
+	if cfg.Proxy.AdminSocket == "" {
+		cfg.Proxy.AdminSocket = DefaultAdminSocket
+	}
+	for i := range cfg.Routes {
+		if cfg.Routes[i].Path == "" {
+			cfg.Routes[i].Path = "/"
+		}
+	}
+}
+
+// Validate checks the whole config and returns a *ConfigError naming every
+// problem, or nil.
+func (cfg *Config) Validate() error {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if port, err := strconv.Atoi(cfg.Proxy.Port); err != nil || port < 1 || port > 65535 {
+		add("proxy.port: %q is not a port number (1-65535)", cfg.Proxy.Port)
+	}
+	for i, l := range cfg.Proxy.Listen {
+		if err := checkListen(l); err != nil {
+			add("proxy.listen[%d]: %v", i, err)
+		}
+	}
+	if cfg.Proxy.SocketMode != "" {
+		if _, err := strconv.ParseUint(cfg.Proxy.SocketMode, 8, 32); err != nil {
+			add("proxy.socket_mode: %q is not an octal mode", cfg.Proxy.SocketMode)
+		}
+	}
+	if (cfg.Proxy.TLSCert == "") != (cfg.Proxy.TLSKey == "") {
+		add("proxy.tls_cert, proxy.tls_key: set both or neither")
+	} else if cfg.Proxy.TLSCert != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.Proxy.TLSCert, cfg.Proxy.TLSKey); err != nil {
+			add("proxy.tls_cert: %v", err)
+		}
+	}
+	if cfg.Proxy.MaxConns < 0 {
+		add("proxy.max_conns: must not be negative")
+	}
+	if _, err := ACL.ParseNets(cfg.Proxy.TrustedProxies); err != nil {
+		add("proxy.trusted_proxies: %v", err)
+	}
+	entries := cfg.Proxy.Entries()
+	for entry, acl := range cfg.Proxy.ListenACL {
+		found := false
+		for _, e := range entries {
+			found = found || e == entry
+		}
+		if !found {
+			add("proxy.listen_acl: %q is not a proxy.listen entry", entry)
+		}
+		if _, err := ACL.New(acl); err != nil {
+			add("proxy.listen_acl[%q]: %v", entry, err)
+		}
+	}
+	if cfg.Proxy.AdminListen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Proxy.AdminListen); err != nil {
+			add("proxy.admin_listen: %v", err)
+		}
+	}
+	if _, err := ACL.New(cfg.Proxy.AdminACL); err != nil {
+		add("proxy.admin_acl: %v", err)
+	}
+
+	if len(cfg.Backends) == 0 && len(cfg.Discovery) == 0 {
+		add("backends: the pool is empty and no discovery provider is configured")
+	}
+	seen := map[string]bool{}
+	for i, backend := range cfg.Backends {
+		if backend == nil {
+			add("backends[%d]: empty entry", i)
+			continue
+		}
+		if _, err := parseBackendURL(backend.URL); err != nil {
+			add("backends[%d].url: %v", i, err)
+		}
+		if seen[backend.URL] {
+			add("backends[%d].url: %q is listed twice", i, backend.URL)
+		}
+		seen[backend.URL] = true
+		if backend.MaxConns < 0 {
+			add("backends[%d].max_conns: must not be negative", i)
+		}
+	}
+
+	for i, route := range cfg.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			add("routes[%d].path: %q must start with /", i, route.Path)
+		}
+		if _, err := Auth.New(route.Auth); err != nil {
+			add("routes[%d]: %v", i, err)
+		}
+		if _, err := ACL.New(route.ACL); err != nil {
+			add("routes[%d]: %v", i, err)
+		}
+	}
+
+	for i, d := range cfg.Discovery {
+		switch d.Provider {
+		case "", "static":
+			for j, u := range d.URLs {
+				if _, err := parseBackendURL(u); err != nil {
+					add("discovery[%d].urls[%d]: %v", i, j, err)
+				}
+			}
+		case "dns":
+			if d.Name == "" {
+				add("discovery[%d].name: required by the dns provider", i)
+			}
+		case "dir":
+			if d.Dir == "" {
+				add("discovery[%d].dir: required by the dir provider", i)
+			}
+		default:
+			add("discovery[%d].provider: unknown provider %q", i, d.Provider)
+		}
+		if d.Interval != "" {
+			if _, err := time.ParseDuration(d.Interval); err != nil {
+				add("discovery[%d].interval: %v", i, err)
+			}
+		}
+	}
+
+	if cfg.Queue.MaxDepth < 0 {
+		add("queue.max_depth: must not be negative")
+	}
+	if cfg.Queue.Timeout != "" {
+		if _, err := time.ParseDuration(cfg.Queue.Timeout); err != nil {
+			add("queue.timeout: %v", err)
+		}
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "", "otlp", "file":
+	default:
+		add("tracing.exporter: unknown exporter %q", cfg.Tracing.Exporter)
+	}
+	switch cfg.AccessLog.Format {
+	case "", "common", "combined", "json":
+	default:
+		add("access_log.format: unknown format %q", cfg.AccessLog.Format)
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// matchRoute returns the route whose Path is the longest prefix of path, or nil.
+func matchRoute(routes []Route, path string) *Route {
+	var best *Route
+	for i := range routes {
+		route := &routes[i]
+		if strings.HasPrefix(path, route.Path) && (best == nil || len(route.Path) > len(best.Path)) {
+			best = route
+		}
+	}
+	return best
+}
@@ -0,0 +1,230 @@
+package Core
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/loadbalancers/acl"
+	"example.com/loadbalancers/discovery"
+)
+
+// writeConfig writes content to name in a new temporary directory.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFormats(t *testing.T) {
+	want := Config{
+		Proxy:    Proxy{Port: "9090", MaxConns: 4, Listen: []string{":9090", "unix:/tmp/lb.sock"}},
+		Backends: []*Backend{{URL: "http://a:1/"}, {URL: "http://b:2/", MaxConns: 2}},
+		Routes:   []Route{{Path: "/api"}},
+	}
+	for _, c := range []struct{ name, content string }{
+		{"lb.json", `{
+			"proxy": {"port": "9090", "max_conns": 4, "listen": [":9090", "unix:/tmp/lb.sock"]},
+			"backends": [{"url": "http://a:1/"}, {"url": "http://b:2/", "max_conns": 2}],
+			"routes": [{"path": "/api"}]
+		}`},
+		{"lb.yaml", `
+proxy:
+  port: "9090"
+  max_conns: 4
+  listen: [":9090", "unix:/tmp/lb.sock"]
+backends:
+  - url: http://a:1/
+  - url: http://b:2/
+    max_conns: 2
+routes:
+  - path: /api
+`},
+		{"lb.toml", `
+routes = [{ path = "/api" }]
+
+[proxy]
+port = "9090"
+max_conns = 4
+listen = [":9090", "unix:/tmp/lb.sock"]
+
+[[backends]]
+url = "http://a:1/"
+
+[[backends]]
+url = "http://b:2/"
+max_conns = 2
+`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := LoadConfig(writeConfig(t, c.name, c.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for _, c := range []struct{ name, content, want string }{
+		{"unknown.json", `{"proxy": {"prot": "80"}}`, "unknown field"},
+		{"unknown.yaml", "proxy:\n  prot: \"80\"\n", "unknown field"},
+		{"unknown.toml", "[proxy]\nprot = \"80\"\n", "unknown field"},
+		{"bad.yaml", "proxy: [", "yaml"},
+		{"trailing.json", `{} {}`, "after the config"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, c.name, c.content))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("got %v, want an error about %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	path := writeConfig(t, "lb.json", `{"proxy": {"port": "9090"}, "backends": [{"url": "http://a:1/"}]}`)
+	t.Setenv(EnvPort, "7070")
+	t.Setenv(EnvMaxConns, "3")
+	t.Setenv(EnvBackends, " http://x:1/ ,, http://y:2/")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{}
+	for _, b := range cfg.Backends {
+		urls = append(urls, b.URL)
+	}
+	if cfg.Proxy.Port != "7070" || cfg.Proxy.MaxConns != 3 || strings.Join(urls, " ") != "http://x:1/ http://y:2/" {
+		t.Fatalf("got port %v, max_conns %v, backends %v", cfg.Proxy.Port, cfg.Proxy.MaxConns, urls)
+	}
+	if cfg.Proxy.AdminSocket != DefaultAdminSocket {
+		t.Errorf("defaults not applied: admin_socket %q", cfg.Proxy.AdminSocket)
+	}
+
+	t.Setenv(EnvMaxConns, "many")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), EnvMaxConns) {
+		t.Fatalf("bad $%v: got %v", EnvMaxConns, err)
+	}
+	t.Setenv(EnvMaxConns, "")
+	t.Setenv(EnvPort, "0")
+	_, err = Load(path)
+	if cerr, ok := err.(*ConfigError); !ok || cerr.Path != path {
+		t.Fatalf("port from the environment not validated: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := Config{Backends: []*Backend{{URL: "http://a:1/"}}}
+		cfg.SetDefaults()
+		return cfg
+	}
+	cfg := valid()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	for _, c := range []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{"port", func(cfg *Config) { cfg.Proxy.Port = "70000" }, []string{"proxy.port"}},
+		{"empty pool", func(cfg *Config) { cfg.Backends = nil }, []string{"backends: the pool is empty"}},
+		{"backends", func(cfg *Config) {
+			cfg.Backends = []*Backend{{URL: "ftp://a/"}, {URL: "http://b/"}, {URL: "http://b/", MaxConns: -1}, nil}
+		}, []string{"backends[0].url", "backends[2].url: \"http://b/\" is listed twice", "backends[2].max_conns", "backends[3]: empty entry"}},
+		{"listen", func(cfg *Config) {
+			cfg.Proxy.Listen = []string{":8080"}
+			cfg.Proxy.ListenACL = map[string]ACL.Config{":9999": {}}
+		}, []string{"proxy.listen_acl: \":9999\" is not a proxy.listen entry"}},
+		{"tls", func(cfg *Config) { cfg.Proxy.TLSCert = "cert.pem" }, []string{"set both or neither"}},
+		{"routes", func(cfg *Config) { cfg.Routes = []Route{{Path: "api"}} }, []string{"routes[0].path"}},
+		{"discovery", func(cfg *Config) {
+			cfg.Discovery = []Discovery.Config{{Provider: "dns"}, {Provider: "zk"}, {Provider: "dir", Interval: "soon"}}
+		}, []string{"discovery[0].name", "discovery[1].provider", "discovery[2].dir", "discovery[2].interval"}},
+		{"queue", func(cfg *Config) { cfg.Queue.MaxDepth, cfg.Queue.Timeout = -1, "later" }, []string{"queue.max_depth", "queue.timeout"}},
+		{"formats", func(cfg *Config) { cfg.Tracing.Exporter, cfg.AccessLog.Format = "zipkin", "xml" }, []string{"tracing.exporter", "access_log.format"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := valid()
+			c.change(&cfg)
+			err := cfg.Validate()
+			cerr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("got %v, want a *ConfigError", err)
+			}
+			if len(cerr.Problems) != len(c.want) {
+				t.Errorf("got %d problems, want %d: %v", len(cerr.Problems), len(c.want), cerr)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(cerr.Error(), want) {
+					t.Errorf("%v does not mention %q", cerr, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEntries(t *testing.T) {
+	if got := (Proxy{Port: "8080"}).Entries(); !reflect.DeepEqual(got, []string{":8080"}) {
+		t.Errorf("port only: got %v", got)
+	}
+	listen := []string{"127.0.0.1:9000", "unix:/tmp/lb.sock"}
+	if got := (Proxy{Port: "8080", Listen: listen}).Entries(); !reflect.DeepEqual(got, listen) {
+		t.Errorf("listen: got %v, want %v", got, listen)
+	}
+}
+
+// A deny-only admin ACL keeps the internal allow list.
+func TestAdminACLDenyOnly(t *testing.T) {
+	p, err := newPolicy(Config{Proxy: Proxy{AdminACL: ACL.Config{Deny: []string{"10.0.0.0/8"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, allowed := range map[string]bool{
+		"127.0.0.1":   true,
+		"192.168.1.2": true,
+		"10.1.2.3":    false,
+		"203.0.113.9": false,
+	} {
+		if err := p.admin.Check(net.ParseIP(ip)); (err == nil) != allowed {
+			t.Errorf("%v: got %v, want allowed %v", ip, err, allowed)
+		}
+	}
+}
+
+// The default admin socket's directory is made private, and one that
+// others can get into is refused.
+func TestPrivateDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "admin")
+	if err := privateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Fatalf("got %v %v, want a 0700 directory", fi.Mode(), err)
+	}
+	if err := privateDir(dir); err != nil {
+		t.Fatalf("existing private dir: %v", err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := privateDir(dir); err == nil {
+		t.Fatal("accepted a directory others can read")
+	}
+	file := writeConfig(t, "socket-dir", "")
+	if err := privateDir(file); err == nil {
+		t.Fatal("accepted a file")
+	}
+}
@@ -0,0 +1,72 @@
+package Core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//	   _______  ___  _____
+//	  / ___/ _ \/ _ \/ ___/
+//	 / (_ / , _/ ___/ /__
+//	 \___/_/|_/_/   \___/
+//
+
+// gRPC status codes used for errors raised by the balancer itself.
+const (
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcPermissionDenied = 7
+	grpcResourceExhaust  = 8
+	grpcUnavailable      = 14
+	grpcUnauthenticated  = 16
+)
+
+// isGRPC reports whether r is a gRPC call.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// httpError answers r with msg and code. gRPC clients cannot read an HTTP
+// error body, so they get a trailers-only response with the matching
+// grpc-status instead.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if !isGRPC(r) {
+		http.Error(w, msg, code)
+		return
+	}
+	status := grpcUnknown
+	switch code {
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		status = grpcUnavailable
+	case http.StatusGatewayTimeout:
+		status = grpcDeadlineExceeded
+	case http.StatusForbidden:
+		status = grpcPermissionDenied
+	case http.StatusUnauthorized:
+		status = grpcUnauthenticated
+	case http.StatusTooManyRequests:
+		status = grpcResourceExhaust
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(status))
+	h.Set("Grpc-Message", encodeGRPCMessage(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes msg for the grpc-message header the
+// way the gRPC spec and grpc-go do: every byte outside printable ASCII,
+// and "%" itself, becomes %XX.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,19 @@
+package Core
+
+import "testing"
+
+// grpc-message is percent-encoded byte by byte, as grpc-go decodes it.
+func TestEncodeGRPCMessage(t *testing.T) {
+	for msg, want := range map[string]string{
+		"":                      "",
+		"no backends available": "no backends available",
+		"100% busy":             "100%25 busy",
+		"line\nbreak\r\x00":     "line%0Abreak%0D%00",
+		"\x7f~":                 "%7F~",
+		"café ✓":                "caf%C3%A9 %E2%9C%93",
+	} {
+		if got := encodeGRPCMessage(msg); got != want {
+			t.Errorf("%q: got %q, want %q", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package Core_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/internal/lbtest"
+)
+
+// TestGRPC runs streaming gRPC-style calls through the balancer over h2c
+// and over TLS. Calls multiplexed on one client connection must still be
+// spread over every backend, echoes must stream both ways, trailers must
+// arrive, and a balancer error must reach the client as a grpc-status.
+func TestGRPC(t *testing.T) {
+	const n = 3
+	cfg := Core.Config{Proxy: Core.Proxy{H2C: true}}
+	backends := []*LbTest.GRPCBackend{}
+	for i := 0; i < n; i++ {
+		g := LbTest.NewGRPCBackend(t, fmt.Sprintf("grpc-%d", i))
+		backends = append(backends, g)
+		cfg.Backends = append(cfg.Backends, &Core.Backend{URL: g.URL})
+	}
+	balancer, err := Core.New(cfg, Core.Options{Failover: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balancer.Close()
+
+	plain := httptest.NewServer(balancer.Handler())
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(balancer.Handler())
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+
+	msgs := []string{"one", "two", "three"}
+	for _, c := range []struct {
+		name   string
+		client *http.Client
+		url    string
+	}{
+		{"h2c", LbTest.H2CClient(), plain.URL},
+		{"tls", secure.Client(), secure.URL},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			seen := map[string]int{}
+			for i := 0; i < n*4; i++ {
+				res, err := LbTest.GRPCCall(c.client, c.url+"/echo.Echo/Stream", msgs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Status != "0" || strings.Join(res.Replies, ",") != strings.Join(msgs, ",") {
+					t.Fatalf("got %+v", res)
+				}
+				seen[res.Backend]++
+			}
+			for _, g := range backends {
+				if seen[g.Name] != 4 {
+					t.Fatalf("calls per backend %v, want 4 each", seen)
+				}
+			}
+		})
+	}
+
+	for _, g := range backends {
+		g.Close()
+	}
+	res, err := LbTest.GRPCCall(LbTest.H2CClient(), plain.URL+"/echo.Echo/Stream", msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != "14" {
+		t.Fatalf("every backend down: got status %q (%v), want 14", res.Status, res.Message)
+	}
+}
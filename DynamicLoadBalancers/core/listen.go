@@ -0,0 +1,168 @@
+package Core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//	   __   _     __
+//	  / /  (_)__ / /____ ___
+//	 / /__/ (_-</ __/ -_) _ \
+//	/____/_/___/\__/\__/_//_/
+//
+
+// listenFdsStart is the first file descriptor passed by socket activation.
+const listenFdsStart = 3
+
+// Listener is an open listener and the proxy.listen entry it serves.
+type Listener struct {
+	net.Listener
+	Entry string
+}
+
+// Listeners opens every listener p asks for: p.Listen when set, otherwise
+// a TCP listener on p.Port. Sockets handed over by a binary upgrade are
+// reused instead of opened again.
+func Listeners(p Proxy) ([]Listener, error) {
+	entries := p.Entries()
+	var listeners []Listener
+	for _, entry := range entries {
+		ls, err := listenEntry(entry, p.SocketMode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		for _, l := range ls {
+			listeners = append(listeners, Listener{l, entry})
+		}
+	}
+	return listeners, nil
+}
+
+// listenEntry opens the listeners for one proxy.listen entry.
+func listenEntry(entry, mode string) ([]net.Listener, error) {
+	if ls := takeUpgradeListeners(entry); len(ls) > 0 {
+		return ls, nil
+	}
+	switch {
+	case entry == "systemd" || strings.HasPrefix(entry, "systemd:"):
+		return systemdListeners(strings.TrimPrefix(strings.TrimPrefix(entry, "systemd"), ":"))
+	case strings.HasPrefix(entry, "unix:"):
+		l, err := listenUnixMode(strings.TrimPrefix(entry, "unix:"), mode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+	l, err := net.Listen("tcp", entry)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{l}, nil
+}
+
+// checkListen validates one proxy.listen entry.
+func checkListen(addr string) error {
+	switch {
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		return nil
+	case strings.HasPrefix(addr, "unix:"):
+		if strings.TrimPrefix(addr, "unix:") == "" {
+			return fmt.Errorf("%q: missing socket path", addr)
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("%q: bad port", addr)
+	}
+	return nil
+}
+
+// listenUnixMode is ListenUnix followed by a chmod when mode is set.
+func listenUnixMode(path, mode string) (net.Listener, error) {
+	l, err := ListenUnix(path)
+	if err != nil || mode == "" {
+		return l, err
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err == nil {
+		err = os.Chmod(path, os.FileMode(perm))
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+type activationFile struct {
+	name string
+	file *os.File
+}
+
+var (
+	activationOnce  sync.Once
+	activationFiles []activationFile
+)
+
+// inheritedFiles returns the sockets passed by systemd through LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES. The variables are cleared so children do
+// not inherit them.
+func inheritedFiles() []activationFile {
+	activationOnce.Do(func() {
+		defer os.Unsetenv("LISTEN_PID")
+		defer os.Unsetenv("LISTEN_FDS")
+		defer os.Unsetenv("LISTEN_FDNAMES")
+		if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+			return
+		}
+		n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || n <= 0 {
+			return
+		}
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < n; i++ {
+			name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+			if i < len(names) && names[i] != "" {
+				name = names[i]
+			}
+			activationFiles = append(activationFiles, activationFile{name, os.NewFile(uintptr(listenFdsStart+i), name)})
+		}
+	})
+	return activationFiles
+}
+
+// systemdListeners turns the inherited sockets into listeners, only those
+// called name when it is set. Each socket can be used once.
+func systemdListeners(name string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for i, f := range inheritedFiles() {
+		if f.file == nil || (name != "" && f.name != name) {
+			continue
+		}
+		l, err := net.FileListener(f.file)
+		if err != nil {
+			return nil, fmt.Errorf("socket activation fd %v: %v", listenFdsStart+i, err)
+		}
+		f.file.Close()
+		activationFiles[i].file = nil
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("socket activation: no socket named %q", name)
+		}
+		return nil, fmt.Errorf("socket activation: no sockets passed (LISTEN_FDS)")
+	}
+	return listeners, nil
+}
@@ -0,0 +1,132 @@
+package Core
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+//	   __                __
+//	  / /  ___  ___ ____/ /
+//	 / /__/ _ \/ _ `/ _  /
+//	/____/\___/\_,_/\_,_/
+//
+
+// DefaultConfigPath is used when neither --config nor $LB_CONFIG is set.
+const DefaultConfigPath = "./config.json"
+
+// Environment variables that override the config file.
+const (
+	EnvConfig   = "LB_CONFIG"    // config file path
+	EnvPort     = "LB_PORT"      // proxy.port
+	EnvBackends = "LB_BACKENDS"  // comma separated backend URLs, replaces backends
+	EnvMaxConns = "LB_MAX_CONNS" // proxy.max_conns
+)
+
+// LoadArgs loads the config named by --config in args, falling back to
+// $LB_CONFIG and then ./config.json.
+func LoadArgs(args []string) (Config, error) {
+	fs := flag.NewFlagSet("loadbalancer", flag.ContinueOnError)
+	path := ConfigFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return Load(*path)
+}
+
+// ConfigFlag registers --config on fs.
+func ConfigFlag(fs *flag.FlagSet) *string {
+	def := os.Getenv(EnvConfig)
+	if def == "" {
+		def = DefaultConfigPath
+	}
+	return fs.String("config", def, "config file (.json, .yaml, .yml or .toml), or $"+EnvConfig)
+}
+
+// Load reads the config file at path, applies environment overrides and
+// defaults, and validates the result.
+func Load(path string) (Config, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	cfg.SetDefaults()
+	cfg.path = path
+	if err := cfg.Validate(); err != nil {
+		err.(*ConfigError).Path = path
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// LoadConfig reads a config file. The format follows the extension: .yaml
+// and .yml are YAML, .toml is TOML, anything else is JSON. Every format
+// uses the JSON field names, and unknown fields are an error.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("%v: %v", path, err)
+	}
+	if doc != nil {
+		if data, err = json.Marshal(doc); err != nil {
+			return cfg, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%v: %v", path, err)
+	}
+	if dec.More() {
+		return cfg, fmt.Errorf("%v: unexpected data after the config", path)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the file with LB_* environment variables.
+func (cfg *Config) applyEnv() error {
+	if port := os.Getenv(EnvPort); port != "" {
+		cfg.Proxy.Port = port
+	}
+	if v := os.Getenv(EnvMaxConns); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("$%v: %v", EnvMaxConns, err)
+		}
+		cfg.Proxy.MaxConns = n
+	}
+	if v := os.Getenv(EnvBackends); v != "" {
+		cfg.Backends = nil
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				cfg.Backends = append(cfg.Backends, &Backend{URL: u})
+			}
+		}
+	}
+	return nil
+}
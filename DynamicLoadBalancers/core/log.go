@@ -0,0 +1,80 @@
+package Core
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Logging Structure
+// ----------------------->
+const (
+	LogInfo    = "INFO"
+	LogWarning = "WARNING"
+	LogError   = "ERROR"
+)
+
+type logEntry struct {
+	time     time.Time
+	severity string
+	message  string
+}
+
+var logCh = make(chan logEntry, 50) // regular channel
+var doneCh = make(chan struct{})    // signal only channel
+var stoppedCh = make(chan struct{}) // closed once Logger has drained logCh
+var running int32                   // set while Logger is draining logCh
+
+// Logger prints queued log entries until StopLogger is called.
+func Logger() {
+	atomic.StoreInt32(&running, 1)
+	defer close(stoppedCh)
+	for {
+		select {
+		case entry := <-logCh:
+			printEntry(entry)
+		case <-doneCh:
+			atomic.StoreInt32(&running, 0)
+			for {
+				select {
+				case entry := <-logCh:
+					printEntry(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func printEntry(entry logEntry) {
+	fmt.Printf("%v : [%v] %v\n", entry.time.Format("2006-01-02"), entry.severity, entry.message)
+}
+
+// StopLogger prints whatever is still queued and ends Logger.
+func StopLogger() {
+	close(doneCh)
+	<-stoppedCh
+}
+
+// Log queues a message for Logger. Without a running Logger, e.g. when the
+// core is embedded in tests, messages that do not fit the buffer are dropped
+// rather than blocking.
+func Log(severity, message string) {
+	entry := logEntry{time.Now(), severity, message}
+	if atomic.LoadInt32(&running) == 1 {
+		logCh <- entry
+		return
+	}
+	select {
+	case logCh <- entry:
+	default:
+	}
+}
+
+// Logf is Log with formatting.
+func Logf(severity, format string, args ...interface{}) {
+	Log(severity, fmt.Sprintf(format, args...))
+}
+
+// <-----------------------
@@ -0,0 +1,198 @@
+package Core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//	   ___
+//	  / _ \__ _____
+//	 / , _/ // / _ \
+//	/_/|_|\_,_/_//_/
+//
+
+// shutdownTimeout bounds how long Run waits for in-flight requests, and
+// freshTimeout how much of it goes to connections that have not sent a
+// request yet.
+const (
+	shutdownTimeout = 10 * time.Second
+	freshTimeout    = 5 * time.Second
+)
+
+// Run serves cfg until SIGINT or SIGTERM: the proxy on its listeners, the
+// admin API on proxy.admin_socket, discovery, and the health check when
+// opts.HealthCheck is set. SIGHUP reloads routes and ACLs from the config
+// file. SIGUSR2 upgrades to a new binary without closing the listeners,
+// see upgrade.
+func Run(cfg Config, opts Options) error {
+	balancer, err := New(cfg, opts)
+	if err != nil {
+		return err
+	}
+	defer balancer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go balancer.WatchBackends(ctx)
+	if opts.HealthCheck > 0 {
+		go balancer.HealthCheck(ctx, opts.HealthCheck)
+	}
+
+	var listeners []Listener
+	admin := &http.Server{Handler: balancer.AdminHandler()}
+	defer admin.Close()
+	if cfg.Proxy.AdminSocket != "" && cfg.Proxy.AdminSocket != "none" {
+		entry := "admin:" + cfg.Proxy.AdminSocket
+		l, err := adminListener(entry, "unix", cfg.Proxy.AdminSocket)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, Listener{l, entry})
+		go admin.Serve(l)
+		Log(LogInfo, "Admin API up : unix:"+cfg.Proxy.AdminSocket)
+	}
+	if cfg.Proxy.AdminListen != "" {
+		entry := "admin:" + cfg.Proxy.AdminListen
+		l, err := adminListener(entry, "tcp", cfg.Proxy.AdminListen)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, Listener{l, entry})
+		go admin.Serve(l)
+		Log(LogInfo, "Admin API up : tcp://"+l.Addr().String())
+	}
+
+	proxyListeners, err := Listeners(cfg.Proxy)
+	if err != nil {
+		return err
+	}
+	listeners = append(listeners, proxyListeners...)
+	fresh := &freshConns{conns: map[net.Conn]bool{}}
+	s := &http.Server{Handler: balancer.Handler(), ConnState: fresh.track, ConnContext: listenerContext}
+	tlsCert, tlsKey := cfg.Proxy.TLSCert, cfg.Proxy.TLSKey
+	errCh := make(chan error, len(proxyListeners))
+	for _, l := range proxyListeners {
+		tagged := taggedListener{l.Listener, l.Entry}
+		if tlsCert != "" {
+			go func(l net.Listener) { errCh <- s.ServeTLS(l, tlsCert, tlsKey) }(tagged)
+		} else {
+			go func(l net.Listener) { errCh <- s.Serve(l) }(tagged)
+		}
+		Logf(LogInfo, "Server up : %v://%v tls=%v h2c=%v", l.Addr().Network(), l.Addr(), tlsCert != "", cfg.Proxy.H2C)
+	}
+	upgradeServing()
+
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	defer signal.Stop(usr2)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+wait:
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			Log(LogInfo, "Shutting down")
+			break wait
+		case <-hup:
+			reload(balancer, cfg.path)
+		case <-usr2:
+			Log(LogInfo, "Upgrade requested")
+			if err := upgrade(listeners); err != nil {
+				Logf(LogError, "Upgrade failed, still serving: %v", err)
+				continue
+			}
+			Log(LogInfo, "Upgrade done, draining")
+			keepSockets(listeners)
+			break wait
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// Shutdown drops connections whose first request arrives after it
+	// starts, so stop accepting and let those requests in first.
+	for _, l := range proxyListeners {
+		l.Close()
+	}
+	freshCtx, cancelFresh := context.WithTimeout(shutdownCtx, freshTimeout)
+	defer cancelFresh()
+	fresh.wait(freshCtx)
+	return s.Shutdown(shutdownCtx)
+}
+
+// freshConns counts connections that are accepted but have not sent a
+// request yet.
+type freshConns struct {
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func (f *freshConns) track(c net.Conn, state http.ConnState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if state == http.StateNew {
+		f.conns[c] = true
+	} else {
+		delete(f.conns, c)
+	}
+}
+
+// wait returns once no fresh connection is left, or ctx is done.
+func (f *freshConns) wait(ctx context.Context) {
+	for {
+		f.mu.Lock()
+		n := len(f.conns)
+		f.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// adminListener reuses the admin socket handed over by an upgrade, or
+// opens it.
+func adminListener(entry, network, addr string) (net.Listener, error) {
+	if ls := takeUpgradeListeners(entry); len(ls) > 0 {
+		return ls[0], nil
+	}
+	if network != "unix" {
+		return net.Listen(network, addr)
+	}
+	if addr == DefaultAdminSocket {
+		if err := privateDir(filepath.Dir(addr)); err != nil {
+			return nil, err
+		}
+	}
+	return ListenUnix(addr)
+}
+
+// reload reads the config at path again and applies what Reload can.
+func reload(balancer *Balancer, path string) {
+	if path == "" {
+		Log(LogWarning, "Reload: config was not loaded from a file")
+		return
+	}
+	cfg, err := Load(path)
+	if err == nil {
+		err = balancer.Reload(cfg)
+	}
+	if err != nil {
+		Logf(LogError, "Reload failed, keeping the old config: %v", err)
+		return
+	}
+	Log(LogInfo, "Config reloaded : "+path)
+}
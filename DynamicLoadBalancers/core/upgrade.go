@@ -0,0 +1,188 @@
+package Core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//	  __  __                    __
+//	 / / / /__  ___ ________ ____/ /__
+//	/ /_/ / _ \/ _ `/ __/ _ `/ _  / -_)
+//	\____/ .__/\_, /_/  \_,_/\_,_/\__/
+//	    /_/   /___/
+
+// On SIGUSR2 Run starts the current executable again with the same
+// arguments and hands it every listening socket. The child serves on them
+// and reports back through a pipe; only then does the parent stop
+// accepting and drain, so the ports are never unbound. If the child fails
+// to come up the parent carries on serving.
+
+// Environment passed to the upgraded process.
+const (
+	envUpgradeReady     = "LB_UPGRADE_READY"     // fd of the readiness pipe
+	envUpgradeListeners = "LB_UPGRADE_LISTENERS" // JSON list of the entries of the fds after it
+)
+
+// upgradeTimeout bounds how long the parent waits for the child.
+const upgradeTimeout = 30 * time.Second
+
+var (
+	upgradeOnce      sync.Once
+	upgradeReady     *os.File
+	upgradeListeners = map[string][]net.Listener{}
+)
+
+// inheritUpgrade picks up the sockets passed by the parent, once.
+func inheritUpgrade() {
+	upgradeOnce.Do(func() {
+		defer os.Unsetenv(envUpgradeReady)
+		defer os.Unsetenv(envUpgradeListeners)
+		fd, err := strconv.Atoi(os.Getenv(envUpgradeReady))
+		if err != nil {
+			return
+		}
+		upgradeReady = os.NewFile(uintptr(fd), "upgrade-ready")
+		var entries []string
+		if err := json.Unmarshal([]byte(os.Getenv(envUpgradeListeners)), &entries); err != nil {
+			Logf(LogError, "Upgrade: bad %v: %v", envUpgradeListeners, err)
+			return
+		}
+		for i, entry := range entries {
+			f := os.NewFile(uintptr(fd+1+i), entry)
+			l, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				Logf(LogError, "Upgrade: fd %v (%v): %v", fd+1+i, entry, err)
+				continue
+			}
+			upgradeListeners[entry] = append(upgradeListeners[entry], l)
+		}
+	})
+}
+
+// takeUpgradeListeners returns, once, the sockets the parent served entry
+// on.
+func takeUpgradeListeners(entry string) []net.Listener {
+	inheritUpgrade()
+	ls := upgradeListeners[entry]
+	delete(upgradeListeners, entry)
+	if !strings.HasPrefix(entry, "systemd") {
+		// Sockets this process created itself are removed on close again.
+		for _, l := range ls {
+			if ul, ok := l.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(true)
+			}
+		}
+	}
+	return ls
+}
+
+// upgradeServing tells the parent this process is accepting, and closes
+// sockets it handed over that the new config no longer uses.
+func upgradeServing() {
+	inheritUpgrade()
+	for entry, ls := range upgradeListeners {
+		Logf(LogWarning, "Upgrade: %v is not in the config any more, closing it", entry)
+		for _, l := range ls {
+			l.Close()
+		}
+		delete(upgradeListeners, entry)
+	}
+	if upgradeReady != nil {
+		upgradeReady.Write([]byte("ok"))
+		upgradeReady.Close()
+		upgradeReady = nil
+	}
+}
+
+// upgrade execs a new copy of this binary with listeners and waits until
+// it is serving.
+func upgrade(listeners []Listener) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	// The raw descriptors go to ForkExec: os/exec would call File.Fd,
+	// which puts the shared sockets in blocking mode under this process's
+	// accept loops.
+	fds := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd(), readyW.Fd()}
+	entries := []string{}
+	for _, l := range listeners {
+		sc, ok := l.Listener.(syscall.Conn)
+		if !ok {
+			readyW.Close()
+			return fmt.Errorf("cannot hand over %v", l.Entry)
+		}
+		rc, err := sc.SyscallConn()
+		if err == nil {
+			err = rc.Control(func(fd uintptr) { fds = append(fds, fd) })
+		}
+		if err != nil {
+			readyW.Close()
+			return err
+		}
+		entries = append(entries, l.Entry)
+	}
+	list, err := json.Marshal(entries)
+	if err != nil {
+		readyW.Close()
+		return err
+	}
+
+	env := append(os.Environ(),
+		envUpgradeReady+"=3",
+		envUpgradeListeners+"="+string(list),
+	)
+	pid, err := syscall.ForkExec(exe, os.Args, &syscall.ProcAttr{Env: env, Files: fds})
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+	child, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	Logf(LogInfo, "Upgrade: started pid %v, waiting for it to serve", pid)
+
+	// ReadAll returns once the child writes and closes the pipe, or exits.
+	ready := make(chan bool, 1)
+	go func() {
+		msg, _ := ioutil.ReadAll(readyR)
+		ready <- string(msg) == "ok"
+	}()
+	select {
+	case ok := <-ready:
+		if ok {
+			go child.Wait()
+			return nil
+		}
+	case <-time.After(upgradeTimeout):
+	}
+	child.Kill()
+	child.Wait()
+	return fmt.Errorf("pid %v did not come up", pid)
+}
+
+// keepSockets stops Close from unlinking Unix socket files the upgraded
+// process is now serving on.
+func keepSockets(listeners []Listener) {
+	for _, l := range listeners {
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package Discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DirProvider reads one JSON file per backend from a directory, e.g.
+// backends.d/api-1.json containing {"url": "http://10.0.0.5:8081/"}, and
+// polls it for added, changed and removed files.
+type DirProvider struct {
+	Dir      string
+	Pattern  string
+	Interval time.Duration
+}
+
+type backendFile struct {
+	URL string `json:"url"`
+}
+
+// Watch scans the directory every Interval and reports the list when any
+// matching file was added, removed or modified.
+func (p *DirProvider) Watch(ctx context.Context) <-chan []string {
+	ch := make(chan []string)
+	go func() {
+		defer close(ch)
+		var lastSig string
+		first := true
+		for {
+			sig, err := p.signature()
+			if err == nil && (first || sig != lastSig) {
+				urls, err := p.Scan()
+				if err == nil {
+					first, lastSig = false, sig
+					select {
+					case ch <- urls:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			select {
+			case <-time.After(p.Interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func (p *DirProvider) files() ([]string, error) {
+	pattern := p.Pattern
+	if pattern == "" {
+		pattern = "*.json"
+	}
+	files, err := filepath.Glob(filepath.Join(p.Dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// signature summarises names, sizes and modification times of the files.
+func (p *DirProvider) signature() (string, error) {
+	if _, err := os.Stat(p.Dir); err != nil {
+		return "", err
+	}
+	files, err := p.files()
+	if err != nil {
+		return "", err
+	}
+	sig := ""
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		sig += fmt.Sprintf("%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return sig, nil
+}
+
+// Scan reads every backend file once. Files that fail to parse are skipped.
+func (p *DirProvider) Scan() ([]string, error) {
+	files, err := p.files()
+	if err != nil {
+		return nil, err
+	}
+	urls := []string{}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var b backendFile
+		if err := json.Unmarshal(data, &b); err != nil || b.URL == "" {
+			continue
+		}
+		urls = append(urls, b.URL)
+	}
+	return urls, nil
+}
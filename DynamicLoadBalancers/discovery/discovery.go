@@ -0,0 +1,166 @@
+package Discovery
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//	   ___  _
+//	  / _ \(_)__ _______ _  _____ ______ __
+//	 / // / (_-</ __/ _ \ |/ / -_) __/ // /
+//	/____/_/___/\__/\___/___/\__/_/  \_, /
+//	                                /___/
+
+// Provider reports backend URLs.
+type Provider interface {
+	// Watch sends the full list of backend URLs every time it changes,
+	// starting with the current list, until ctx is done.
+	Watch(ctx context.Context) <-chan []string
+}
+
+// Config describes one discovery provider in config.json.
+type Config struct {
+	Provider string `json:"provider"` // "static", "dns" or "dir"
+
+	// static
+	URLs []string `json:"urls"`
+
+	// dns
+	Name   string `json:"name"`   // SRV name (_http._tcp.example.com) or host name for A records
+	Record string `json:"record"` // "srv" (default) or "a"
+	Port   string `json:"port"`   // port used with A records
+	Scheme string `json:"scheme"` // default "http"
+	Server string `json:"server"` // DNS server host:port, default is the first resolv.conf nameserver
+
+	// dir
+	Dir     string `json:"dir"`
+	Pattern string `json:"pattern"` // glob inside Dir, default "*.json"
+
+	Interval string `json:"interval"` // dir poll interval / dns retry interval, default 5s
+}
+
+// New builds a Provider that merges the static backend list with every
+// configured discovery provider.
+func New(static []string, cfgs []Config) (Provider, error) {
+	providers := []Provider{Static(static)}
+	for _, c := range cfgs {
+		interval := 5 * time.Second
+		if c.Interval != "" {
+			d, err := time.ParseDuration(c.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("discovery: bad interval %q: %v", c.Interval, err)
+			}
+			interval = d
+		}
+		switch c.Provider {
+		case "static", "":
+			providers = append(providers, Static(c.URLs))
+		case "dns":
+			p, err := NewDNS(c, interval)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, p)
+		case "dir":
+			if c.Dir == "" {
+				return nil, fmt.Errorf("discovery: dir provider needs a dir")
+			}
+			providers = append(providers, &DirProvider{Dir: c.Dir, Pattern: c.Pattern, Interval: interval})
+		default:
+			return nil, fmt.Errorf("discovery: unknown provider %q", c.Provider)
+		}
+	}
+	return Merge(providers...), nil
+}
+
+// Static is a fixed list of backend URLs.
+type Static []string
+
+// Watch sends the list once.
+func (s Static) Watch(ctx context.Context) <-chan []string {
+	ch := make(chan []string, 1)
+	ch <- append([]string(nil), s...)
+	close(ch)
+	return ch
+}
+
+type merged []Provider
+
+// Merge combines providers into one that reports the union of their lists,
+// in provider order. Providers that have not reported yet contribute nothing.
+func Merge(providers ...Provider) Provider {
+	return merged(providers)
+}
+
+type update struct {
+	idx  int
+	urls []string
+}
+
+func (m merged) Watch(ctx context.Context) <-chan []string {
+	out := make(chan []string)
+	updates := make(chan update)
+	for i, p := range m {
+		go func(i int, ch <-chan []string) {
+			for urls := range ch {
+				select {
+				case updates <- update{i, urls}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i, p.Watch(ctx))
+	}
+
+	go func() {
+		defer close(out)
+		lists := make([][]string, len(m))
+		var last []string
+		for {
+			select {
+			case u := <-updates:
+				lists[u.idx] = u.urls
+				urls := union(lists)
+				if last != nil && equal(urls, last) {
+					continue
+				}
+				last = urls
+				select {
+				case out <- urls:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func union(lists [][]string) []string {
+	set := map[string]bool{}
+	urls := []string{}
+	for _, l := range lists {
+		for _, u := range l {
+			if !set[u] {
+				set[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package Discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fake reports the lists sent on its channel.
+type fake chan []string
+
+func (f fake) Watch(ctx context.Context) <-chan []string {
+	return f
+}
+
+func TestStatic(t *testing.T) {
+	ch := Static{"http://a/", "http://b/"}.Watch(context.Background())
+	if urls := <-ch; !reflect.DeepEqual(urls, []string{"http://a/", "http://b/"}) {
+		t.Fatalf("got %v", urls)
+	}
+	if _, open := <-ch; open {
+		t.Fatal("static list sent twice")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	one, two := make(fake), make(fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := Merge(Static{"http://s/"}, one, two).Watch(ctx)
+
+	want := [][]string{{"http://s/"}, {"http://s/", "http://a/"}, {"http://s/", "http://a/", "http://b/"}, {"http://s/", "http://b/", "http://a/"}}
+	for i, send := range []func(){
+		func() {},
+		func() { one <- []string{"http://a/"} },
+		func() { two <- []string{"http://b/", "http://a/"} },
+		// An unchanged union is not sent again.
+		func() { two <- []string{"http://b/", "http://a/"}; one <- []string{"http://s/"} },
+	} {
+		go send()
+		urls := next(t, ch, time.Second)
+		if !reflect.DeepEqual(urls, want[i]) {
+			t.Fatalf("update %d: got %v, want %v", i, urls, want[i])
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("api-1.json", `{"url": "http://10.0.0.1:8081/"}`)
+	write("api-2.json", `{"url": "http://10.0.0.2:8081/"}`)
+	write("broken.json", `{"url": `)
+	write("notes.txt", `{"url": "http://ignored/"}`)
+
+	p := &DirProvider{Dir: dir, Interval: 20 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := p.Watch(ctx)
+	if urls, want := next(t, ch, time.Second), []string{"http://10.0.0.1:8081/", "http://10.0.0.2:8081/"}; !reflect.DeepEqual(urls, want) {
+		t.Fatalf("got %v, want %v", urls, want)
+	}
+
+	write("api-3.json", `{"url": "http://10.0.0.3:8081/"}`)
+	if err := os.Remove(filepath.Join(dir, "api-1.json")); err != nil {
+		t.Fatal(err)
+	}
+	if urls, want := next(t, ch, time.Second), []string{"http://10.0.0.2:8081/", "http://10.0.0.3:8081/"}; !reflect.DeepEqual(urls, want) {
+		t.Fatalf("after changes: got %v, want %v", urls, want)
+	}
+
+	p.Pattern = "*.txt"
+	if urls, err := p.Scan(); err != nil || !reflect.DeepEqual(urls, []string{"http://ignored/"}) {
+		t.Fatalf("pattern: got %v, %v", urls, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, cfgs := range [][]Config{
+		{{Provider: "zookeeper"}},
+		{{Provider: "dir"}},
+		{{Provider: "static", Interval: "often"}},
+		{{Provider: "dns"}},
+	} {
+		if _, err := New(nil, cfgs); err == nil {
+			t.Errorf("%+v: accepted", cfgs)
+		}
+	}
+}
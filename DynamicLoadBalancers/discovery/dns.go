@@ -0,0 +1,257 @@
+package Discovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// TTL bounds, so a zero TTL does not spin and a huge one does not go stale.
+const (
+	minRefresh = time.Second
+	maxRefresh = 5 * time.Minute
+)
+
+// DNSProvider resolves SRV or A records and re-resolves when their TTL expires.
+type DNSProvider struct {
+	Name   string
+	Record string // "srv" or "a"
+	Port   string
+	Scheme string
+	Server string
+	// Retry is how long to wait after a failed lookup.
+	Retry time.Duration
+}
+
+// NewDNS builds a DNSProvider from cfg.
+func NewDNS(cfg Config, retry time.Duration) (*DNSProvider, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("discovery: dns provider needs a name")
+	}
+	p := &DNSProvider{
+		Name:   cfg.Name,
+		Record: strings.ToLower(cfg.Record),
+		Port:   cfg.Port,
+		Scheme: cfg.Scheme,
+		Server: cfg.Server,
+		Retry:  retry,
+	}
+	if p.Record == "" {
+		p.Record = "srv"
+	}
+	if p.Record != "srv" && p.Record != "a" {
+		return nil, fmt.Errorf("discovery: unknown dns record type %q", cfg.Record)
+	}
+	if p.Record == "a" && p.Port == "" {
+		return nil, fmt.Errorf("discovery: dns A records need a port")
+	}
+	if p.Scheme == "" {
+		p.Scheme = "http"
+	}
+	if p.Server == "" {
+		server, err := systemNameserver()
+		if err != nil {
+			return nil, err
+		}
+		p.Server = server
+	}
+	return p, nil
+}
+
+// Watch resolves the name now and again whenever the shortest TTL runs out.
+// Failed lookups keep the last good list and are retried.
+func (p *DNSProvider) Watch(ctx context.Context) <-chan []string {
+	ch := make(chan []string)
+	go func() {
+		defer close(ch)
+		for {
+			urls, ttl, err := p.Resolve(ctx)
+			wait := ttl
+			if err != nil {
+				wait = p.Retry
+			} else {
+				select {
+				case ch <- urls:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Resolve looks the name up once and returns the sorted backend URLs and how
+// long they may be cached.
+func (p *DNSProvider) Resolve(ctx context.Context) ([]string, time.Duration, error) {
+	var urls []string
+	var ttl uint32
+	switch p.Record {
+	case "a":
+		ips, t, err := p.lookupA(ctx, p.Name)
+		if err != nil {
+			return nil, 0, err
+		}
+		ttl = t
+		for _, ip := range ips {
+			urls = append(urls, fmt.Sprintf("%s://%s/", p.Scheme, net.JoinHostPort(ip, p.Port)))
+		}
+	default:
+		msg, err := p.query(ctx, p.Name, dnsmessage.TypeSRV)
+		if err != nil {
+			return nil, 0, err
+		}
+		glue := map[string][]string{}
+		ttl = ^uint32(0)
+		for _, rr := range msg.Additionals {
+			if a, ok := rr.Body.(*dnsmessage.AResource); ok {
+				glue[rr.Header.Name.String()] = append(glue[rr.Header.Name.String()], net.IP(a.A[:]).String())
+			}
+		}
+		for _, rr := range msg.Answers {
+			srv, ok := rr.Body.(*dnsmessage.SRVResource)
+			if !ok {
+				continue
+			}
+			if rr.Header.TTL < ttl {
+				ttl = rr.Header.TTL
+			}
+			target := srv.Target.String()
+			ips, ok := glue[target]
+			if !ok {
+				var t uint32
+				ips, t, err = p.lookupA(ctx, target)
+				if err != nil {
+					return nil, 0, err
+				}
+				if t < ttl {
+					ttl = t
+				}
+			}
+			port := strconv.Itoa(int(srv.Port))
+			for _, ip := range ips {
+				urls = append(urls, fmt.Sprintf("%s://%s/", p.Scheme, net.JoinHostPort(ip, port)))
+			}
+		}
+		if len(urls) == 0 {
+			return nil, 0, fmt.Errorf("discovery: no SRV records for %v", p.Name)
+		}
+	}
+	sort.Strings(urls)
+
+	refresh := time.Duration(ttl) * time.Second
+	if refresh < minRefresh {
+		refresh = minRefresh
+	}
+	if refresh > maxRefresh {
+		refresh = maxRefresh
+	}
+	return urls, refresh, nil
+}
+
+func (p *DNSProvider) lookupA(ctx context.Context, name string) ([]string, uint32, error) {
+	msg, err := p.query(ctx, name, dnsmessage.TypeA)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ips []string
+	ttl := ^uint32(0)
+	for _, rr := range msg.Answers {
+		if a, ok := rr.Body.(*dnsmessage.AResource); ok {
+			ips = append(ips, net.IP(a.A[:]).String())
+			if rr.Header.TTL < ttl {
+				ttl = rr.Header.TTL
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, fmt.Errorf("discovery: no A records for %v", name)
+	}
+	return ips, ttl, nil
+}
+
+// query sends a single question over UDP. The standard resolver does not
+// expose TTLs, which is why records are fetched by hand.
+func (p *DNSProvider) query(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, err
+	}
+	// A random ID makes spoofed answers hard to guess.
+	id := binary.BigEndian.Uint16(idBytes[:])
+	req := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", p.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(buf[:n]); err != nil {
+			return nil, err
+		}
+		if resp.Header.ID != id {
+			continue
+		}
+		if resp.Header.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("discovery: %v lookup of %v failed: %v", qtype, name, resp.Header.RCode)
+		}
+		return &resp, nil
+	}
+}
+
+func systemNameserver() (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("discovery: no dns server configured: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", fmt.Errorf("discovery: no nameserver in /etc/resolv.conf")
+}
@@ -0,0 +1,229 @@
+package Discovery
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is an in-process DNS server answering from records, which tests
+// may change while it runs. Names it does not know get NXDOMAIN.
+type dnsStub struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	records map[string][]dnsmessage.Resource // by name and type, as "name/TypeA"
+	queries int
+}
+
+func newDNSStub(t *testing.T) *dnsStub {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dnsStub{conn: conn, records: map[string][]dnsmessage.Resource{}}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *dnsStub) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// set replaces the records of name and type.
+func (s *dnsStub) set(name string, qtype dnsmessage.Type, rrs ...dnsmessage.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name+"/"+qtype.String()] = rrs
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var req dnsmessage.Message
+		if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+			continue
+		}
+		q := req.Questions[0]
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: req.Header.ID, Response: true, Authoritative: true},
+			Questions: req.Questions,
+		}
+		s.mu.Lock()
+		s.queries++
+		answers, ok := s.records[q.Name.String()+"/"+q.Type.String()]
+		s.mu.Unlock()
+		if !ok {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+		for _, rr := range answers {
+			// SRV answers carry A records of their targets as glue.
+			if _, glue := rr.Body.(*dnsmessage.AResource); glue && q.Type == dnsmessage.TypeSRV {
+				resp.Additionals = append(resp.Additionals, rr)
+			} else {
+				resp.Answers = append(resp.Answers, rr)
+			}
+		}
+		packed, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(packed, from)
+	}
+}
+
+func a(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var addr [4]byte
+	copy(addr[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: addr},
+	}
+}
+
+func srv(name string, ttl uint32, target string, port uint16) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Target: dnsmessage.MustNewName(target), Port: port},
+	}
+}
+
+func TestDNSResolve(t *testing.T) {
+	stub := newDNSStub(t)
+	// a.svc.test. comes as glue, b.svc.test. needs a lookup of its own.
+	stub.set("_http._tcp.svc.test.", dnsmessage.TypeSRV,
+		srv("_http._tcp.svc.test.", 60, "a.svc.test.", 8081),
+		srv("_http._tcp.svc.test.", 30, "b.svc.test.", 8082),
+		a("a.svc.test.", 60, "10.0.0.1"),
+	)
+	stub.set("b.svc.test.", dnsmessage.TypeA, a("b.svc.test.", 20, "10.0.0.3"), a("b.svc.test.", 90, "10.0.0.2"))
+	stub.set("web.test.", dnsmessage.TypeA, a("web.test.", 0, "10.0.1.1"))
+
+	for _, c := range []struct {
+		name string
+		cfg  Config
+		urls []string
+		ttl  time.Duration
+	}{
+		{"srv", Config{Name: "_http._tcp.svc.test"}, []string{"http://10.0.0.1:8081/", "http://10.0.0.2:8082/", "http://10.0.0.3:8082/"}, 20 * time.Second},
+		{"a", Config{Name: "web.test", Record: "A", Port: "9000", Scheme: "https"}, []string{"https://10.0.1.1:9000/"}, minRefresh},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.cfg.Server = stub.addr()
+			p, err := NewDNS(c.cfg, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			urls, ttl, err := p.Resolve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(urls, c.urls) || ttl != c.ttl {
+				t.Fatalf("got %v for %v, want %v for %v", urls, ttl, c.urls, c.ttl)
+			}
+		})
+	}
+
+	for _, c := range []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"unknown name", Config{Name: "nowhere.test"}, "NameError"},
+		{"srv target without records", Config{Name: "_http._tcp.broken.test"}, "no A records"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			stub.set("_http._tcp.broken.test.", dnsmessage.TypeSRV, srv("_http._tcp.broken.test.", 60, "gone.test.", 80))
+			stub.set("gone.test.", dnsmessage.TypeA)
+			c.cfg.Server = stub.addr()
+			p, err := NewDNS(c.cfg, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := p.Resolve(context.Background()); err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("got %v, want an error with %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestNewDNS(t *testing.T) {
+	for _, cfg := range []Config{
+		{},
+		{Name: "x.test", Record: "mx", Server: "127.0.0.1:53"},
+		{Name: "x.test", Record: "a", Server: "127.0.0.1:53"},
+	} {
+		if _, err := NewDNS(cfg, time.Second); err == nil {
+			t.Errorf("%+v: accepted", cfg)
+		}
+	}
+}
+
+// next waits for the next list from ch.
+func next(t *testing.T, ch <-chan []string, timeout time.Duration) []string {
+	t.Helper()
+	select {
+	case urls, ok := <-ch:
+		if !ok {
+			t.Fatal("watch ended")
+		}
+		return urls
+	case <-time.After(timeout):
+		t.Fatalf("no update after %v", timeout)
+	}
+	return nil
+}
+
+// TestDNSWatch checks records are resolved again once their TTL runs out,
+// membership changes come through merged with the static list, and a
+// failed lookup keeps the last good list.
+func TestDNSWatch(t *testing.T) {
+	stub := newDNSStub(t)
+	stub.set("_http._tcp.svc.test.", dnsmessage.TypeSRV,
+		srv("_http._tcp.svc.test.", 1, "a.svc.test.", 8081), a("a.svc.test.", 1, "10.0.0.1"))
+
+	p, err := New([]string{"http://static:80/"}, []Config{{Provider: "dns", Name: "_http._tcp.svc.test", Server: stub.addr(), Interval: "100ms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := p.Watch(ctx)
+
+	// The static list may come alone before the first lookup.
+	urls := next(t, ch, 5*time.Second)
+	if len(urls) == 1 {
+		urls = next(t, ch, 5*time.Second)
+	}
+	if want := []string{"http://static:80/", "http://10.0.0.1:8081/"}; !reflect.DeepEqual(urls, want) {
+		t.Fatalf("got %v, want %v", urls, want)
+	}
+
+	stub.set("_http._tcp.svc.test.", dnsmessage.TypeSRV,
+		srv("_http._tcp.svc.test.", 1, "a.svc.test.", 8081), srv("_http._tcp.svc.test.", 1, "b.svc.test.", 8081),
+		a("a.svc.test.", 1, "10.0.0.1"), a("b.svc.test.", 1, "10.0.0.2"))
+	if want := []string{"http://static:80/", "http://10.0.0.1:8081/", "http://10.0.0.2:8081/"}; !reflect.DeepEqual(next(t, ch, 5*time.Second), want) {
+		t.Fatalf("added backend: want %v", want)
+	}
+
+	// While lookups fail the list stays, then the next answer replaces it.
+	stub.set("_http._tcp.svc.test.", dnsmessage.TypeSRV)
+	time.Sleep(1500 * time.Millisecond)
+	stub.set("_http._tcp.svc.test.", dnsmessage.TypeSRV,
+		srv("_http._tcp.svc.test.", 1, "b.svc.test.", 8081), a("b.svc.test.", 1, "10.0.0.2"))
+	if want := []string{"http://static:80/", "http://10.0.0.2:8081/"}; !reflect.DeepEqual(next(t, ch, 5*time.Second), want) {
+		t.Fatalf("removed backend: want %v", want)
+	}
+}
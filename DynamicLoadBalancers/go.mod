@@ -1,3 +1,14 @@
 module example.com/loadbalancers
 
 go 1.18
+
+require golang.org/x/net v0.35.0
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/andybalholm/brotli v1.1.1
+	golang.org/x/crypto v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.22.0 // indirect
@@ -0,0 +1,160 @@
+package LbTest
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/loadbalancers/auth"
+)
+
+//	   __   __   ______        __
+//	  / /  / /  /_  __/__ ___ / /_
+//	 / /__/ _ \  / / / -_|_-</ __/
+//	/____/_.__/ /_/  \__/___/\__/
+//
+
+// FakeBackend is an in-process origin server whose latency, failures and
+// availability can be changed while a test runs. It answers with its Name.
+type FakeBackend struct {
+	Name string
+	URL  string
+	addr string
+
+	mu        sync.Mutex
+	latency   time.Duration
+	errorRate float64
+	server    *http.Server
+	hits      int64
+	inflight  int32
+	peak      int32
+}
+
+// NewBackend starts a FakeBackend on a free localhost port, closed when t
+// ends.
+func NewBackend(t testing.TB, name string) *FakeBackend {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &FakeBackend{Name: name, addr: l.Addr().String()}
+	f.URL = "http://" + f.addr + "/"
+	f.serve(l)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *FakeBackend) serve(l net.Listener) {
+	s := &http.Server{Handler: http.HandlerFunc(f.handle)}
+	f.mu.Lock()
+	f.server = s
+	f.mu.Unlock()
+	go s.Serve(l)
+}
+
+func (f *FakeBackend) handle(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&f.hits, 1)
+	n := atomic.AddInt32(&f.inflight, 1)
+	defer atomic.AddInt32(&f.inflight, -1)
+	for {
+		peak := atomic.LoadInt32(&f.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&f.peak, peak, n) {
+			break
+		}
+	}
+
+	f.mu.Lock()
+	latency, errorRate := f.latency, f.errorRate
+	f.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if errorRate > 0 && rand.Float64() < errorRate {
+		http.Error(w, f.Name+" failed", http.StatusInternalServerError)
+		return
+	}
+	// Identity headers the balancer forwarded are echoed back for checks.
+	for name, v := range r.Header {
+		if strings.HasPrefix(name, Auth.IdentityPrefix) {
+			w.Header()["Echo-"+name] = v
+		}
+	}
+	w.Header().Set("X-Backend", f.Name)
+	fmt.Fprint(w, f.Name)
+}
+
+// SetLatency delays every response by d.
+func (f *FakeBackend) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	f.latency = d
+	f.mu.Unlock()
+}
+
+// SetErrorRate answers the given fraction of requests with a 500.
+func (f *FakeBackend) SetErrorRate(rate float64) {
+	f.mu.Lock()
+	f.errorRate = rate
+	f.mu.Unlock()
+}
+
+// Crash closes the listener and every open connection, so new requests
+// are refused until Restart.
+func (f *FakeBackend) Crash() error {
+	f.mu.Lock()
+	s := f.server
+	f.server = nil
+	f.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	return s.Close()
+}
+
+// Restart listens again on the same address after a Crash.
+func (f *FakeBackend) Restart() error {
+	f.mu.Lock()
+	running := f.server != nil
+	f.mu.Unlock()
+	if running {
+		return nil
+	}
+	l, err := net.Listen("tcp", f.addr)
+	if err != nil {
+		return err
+	}
+	f.serve(l)
+	return nil
+}
+
+// Close stops the backend for good.
+func (f *FakeBackend) Close() {
+	f.Crash()
+}
+
+// Hits returns how many requests reached the backend.
+func (f *FakeBackend) Hits() int64 {
+	return atomic.LoadInt64(&f.hits)
+}
+
+// PeakConcurrency returns the highest number of requests handled at once.
+func (f *FakeBackend) PeakConcurrency() int {
+	return int(atomic.LoadInt32(&f.peak))
+}
+
+// Reset zeroes the hit and concurrency counters.
+func (f *FakeBackend) Reset() {
+	atomic.StoreInt64(&f.hits, 0)
+	atomic.StoreInt32(&f.peak, 0)
+}
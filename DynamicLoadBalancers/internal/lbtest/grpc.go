@@ -0,0 +1,198 @@
+package LbTest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// GRPCBackend is a gRPC-style streaming echo server built on net/http and
+// x/net/http2: every length-prefixed message in the request is written
+// straight back, then the call ends with grpc-status 0 and an X-Backend
+// trailer.
+type GRPCBackend struct {
+	Name string
+	URL  string // h2c://host:port
+
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	calls    int64
+}
+
+// NewGRPCBackend starts a GRPCBackend on a free localhost port, closed when
+// t ends. Like gRPC servers it only speaks HTTP/2 with prior knowledge.
+func NewGRPCBackend(t testing.TB, name string) *GRPCBackend {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &GRPCBackend{Name: name, URL: "h2c://" + l.Addr().String(), listener: l, conns: map[net.Conn]bool{}}
+	go g.serve()
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *GRPCBackend) serve() {
+	h2s := &http2.Server{}
+	opts := &http2.ServeConnOpts{Handler: http.HandlerFunc(g.handle)}
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			return
+		}
+		g.mu.Lock()
+		g.conns[conn] = true
+		g.mu.Unlock()
+		go func() {
+			h2s.ServeConn(conn, opts)
+			g.mu.Lock()
+			delete(g.conns, conn)
+			g.mu.Unlock()
+		}()
+	}
+}
+
+func (g *GRPCBackend) handle(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" {
+		http.Error(w, "gRPC over HTTP/2 only", http.StatusUnsupportedMediaType)
+		return
+	}
+	atomic.AddInt64(&g.calls, 1)
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		msg, err := ReadGRPCMessage(r.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", "13")
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", err.Error())
+			return
+		}
+		WriteGRPCMessage(w, msg)
+		w.(http.Flusher).Flush()
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	w.Header().Set(http.TrailerPrefix+"X-Backend", g.Name)
+}
+
+// Calls returns how many calls reached the backend.
+func (g *GRPCBackend) Calls() int64 {
+	return atomic.LoadInt64(&g.calls)
+}
+
+// Close stops the backend and drops its connections.
+func (g *GRPCBackend) Close() {
+	g.listener.Close()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for conn := range g.conns {
+		conn.Close()
+	}
+}
+
+// WriteGRPCMessage writes msg with the gRPC length prefix.
+func WriteGRPCMessage(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadGRPCMessage reads one length-prefixed message. It returns io.EOF at
+// a clean end of stream.
+func ReadGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return msg, nil
+}
+
+// H2CClient speaks HTTP/2 without TLS, multiplexing every call over one
+// connection per host.
+func H2CClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// GRPCResult is the outcome of one GRPCCall.
+type GRPCResult struct {
+	Replies []string
+	Status  string // grpc-status from the trailers, or the headers of a trailers-only response
+	Message string
+	Backend string
+}
+
+// GRPCCall makes one streaming call to url: each message is sent only once
+// the echo of the previous one came back, which fails unless both
+// directions stream through the proxy.
+func GRPCCall(client *http.Client, url string, msgs []string) (GRPCResult, error) {
+	var res GRPCResult
+	body, send := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		send.Close()
+		return res, err
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		send.Close()
+		return res, fmt.Errorf("grpc: got %v, want HTTP/2", resp.Proto)
+	}
+	if status := resp.Header.Get("Grpc-Status"); status != "" {
+		send.Close()
+		res.Status, res.Message = status, resp.Header.Get("Grpc-Message")
+		return res, nil
+	}
+
+	for _, msg := range msgs {
+		go WriteGRPCMessage(send, []byte(msg))
+		reply, err := ReadGRPCMessage(resp.Body)
+		if err != nil {
+			send.Close()
+			return res, fmt.Errorf("grpc: waiting for echo of %q: %v", msg, err)
+		}
+		res.Replies = append(res.Replies, string(reply))
+	}
+	send.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return res, err
+	}
+	res.Status = resp.Trailer.Get("Grpc-Status")
+	res.Message = resp.Trailer.Get("Grpc-Message")
+	res.Backend = resp.Trailer.Get("X-Backend")
+	return res, nil
+}
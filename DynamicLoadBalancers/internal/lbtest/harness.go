@@ -0,0 +1,185 @@
+package LbTest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/loadbalancers/core"
+)
+
+// Harness runs a Core.Balancer in front of N FakeBackends. The package is
+// internal and only imported by tests.
+type Harness struct {
+	Backends []*FakeBackend
+	Balancer *Core.Balancer
+	Proxy    *httptest.Server
+	Client   *http.Client
+
+	cancel context.CancelFunc
+}
+
+// Start launches n fake backends named backend-0 … backend-n-1 and a
+// balancer over them, all closed when t ends. cfg supplies everything but
+// the backend list.
+func Start(t testing.TB, n int, cfg Core.Config, opts Core.Options) *Harness {
+	t.Helper()
+	h := &Harness{Client: &http.Client{Timeout: 10 * time.Second}}
+	t.Cleanup(h.Close)
+	cfg.Backends = nil
+	for i := 0; i < n; i++ {
+		f := NewBackend(t, fmt.Sprintf("backend-%d", i))
+		h.Backends = append(h.Backends, f)
+		cfg.Backends = append(cfg.Backends, &Core.Backend{URL: f.URL})
+	}
+	balancer, err := Core.New(cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Balancer = balancer
+	h.Proxy = httptest.NewServer(balancer.Handler())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go balancer.WatchBackends(ctx)
+	return h
+}
+
+// StartHealthCheck runs the balancer's health check every interval until
+// Close.
+func (h *Harness) StartHealthCheck(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	prev := h.cancel
+	h.cancel = func() { cancel(); prev() }
+	go h.Balancer.HealthCheck(ctx, interval)
+}
+
+// Close stops the proxy, the balancer and every backend.
+func (h *Harness) Close() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+	if h.Proxy != nil {
+		h.Proxy.Close()
+	}
+	if h.Balancer != nil {
+		h.Balancer.Close()
+	}
+	for _, f := range h.Backends {
+		f.Close()
+	}
+}
+
+// Get sends one request through the proxy and returns its status and body.
+func (h *Harness) Get(path string) (int, string, error) {
+	resp, err := h.Client.Get(h.Proxy.URL + path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+// Result counts the outcome of Fire.
+type Result struct {
+	Codes  map[int]int
+	Errors int
+}
+
+// Fire sends n GET requests through the proxy, concurrency at a time.
+func (h *Harness) Fire(n, concurrency int) Result {
+	res := Result{Codes: map[int]int{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, err := h.Client.Get(h.Proxy.URL + "/")
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Errors++
+				return
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			res.Codes[resp.StatusCode]++
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+// Hits returns the request count of every backend by name.
+func (h *Harness) Hits() map[string]int64 {
+	hits := map[string]int64{}
+	for _, f := range h.Backends {
+		hits[f.Name] = f.Hits()
+	}
+	return hits
+}
+
+// ResetHits zeroes every backend's counters.
+func (h *Harness) ResetHits() {
+	for _, f := range h.Backends {
+		f.Reset()
+	}
+}
+
+// Dead reports whether the balancer currently marks f as dead.
+func (h *Harness) Dead(f *FakeBackend) bool {
+	for _, status := range h.Balancer.Backends() {
+		if status.URL == f.URL {
+			return status.Dead
+		}
+	}
+	return false
+}
+
+// WaitFor polls cond until it holds, failing t when timeout passes first.
+func WaitFor(t testing.TB, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v: not after %v", what, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// CheckEven fails t unless every named backend received total/len(names)
+// requests, give or take tolerance (0.1 is ±10%), and no other backend
+// received any.
+func CheckEven(t testing.TB, hits map[string]int64, names []string, tolerance float64) {
+	t.Helper()
+	var total int64
+	for _, n := range hits {
+		total += n
+	}
+	want := float64(total) / float64(len(names))
+	expected := map[string]bool{}
+	for _, name := range names {
+		expected[name] = true
+		if math.Abs(float64(hits[name])-want) > want*tolerance {
+			t.Errorf("%v got %v of %v requests, want about %.0f", name, hits[name], total, want)
+		}
+	}
+	for name, n := range hits {
+		if !expected[name] && n > 0 {
+			t.Errorf("%v got %v requests, want none", name, n)
+		}
+	}
+}
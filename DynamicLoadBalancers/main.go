@@ -1,17 +1,111 @@
 package main
 
-// import "example.com/loadbalancers/roundRobin"
-// import "example.com/loadbalancers/roundRobin"
-// import "example.com/loadbalancers/activeCheck"
-import "example.com/loadbalancers/passiveCheck"
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"example.com/loadbalancers/activeCheck"
+	"example.com/loadbalancers/core"
+	"example.com/loadbalancers/passiveCheck"
+	"example.com/loadbalancers/roundRobin"
+)
+
+const usage = `usage: loadbalancer <command> [flags]
+
+commands:
+  run [--strategy=roundrobin|active|passive] [--config=file]
+                               serve until SIGINT/SIGTERM
+  validate [config]            check a config file and report every error
+  status [--json]              show the pool of a running instance
+  backend add <url> [--max-conns=n] [--json]
+  backend remove <url> [--json]
+  backend drain <url> [--json] change the pool of a running instance
+
+status and backend take --socket (default $LB_ADMIN_SOCKET or proxy.admin_socket's default).
+`
+
+// strategies maps --strategy names to their core options.
+var strategies = map[string]Core.Options{
+	"roundrobin": RoundRobin.Options,
+	"active":     ActiveCheck.Options,
+	"passive":    PassiveCheck.Options,
+}
 
 func main() {
-	// roundRobinLB := RoundRobin.New()
-	// roundRobinLB.LbServer()
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "run":
+		err = run(args)
+	case "validate":
+		err = validate(args)
+	case "status":
+		err = status(args)
+	case "backend":
+		err = backend(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%v", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	strategy := fs.String("strategy", "passive", "balancing strategy: "+strategyNames())
+	path := Core.ConfigFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts, ok := strategies[*strategy]
+	if !ok {
+		return fmt.Errorf("unknown strategy %q, want one of %v", *strategy, strategyNames())
+	}
+	cfg, err := Core.Load(*path)
+	if err != nil {
+		return err
+	}
 
-	// activeCheckLb := ActiveCheck.New()
-	// activeCheckLb.LbServer()
+	go Core.Logger()
+	defer Core.StopLogger()
+	Core.Logf(Core.LogInfo, "Strategy : %v", *strategy)
+	return Core.Run(cfg, opts)
+}
+
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	path := Core.ConfigFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		*path = fs.Arg(0)
+	}
+	cfg, err := Core.Load(*path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v: ok, %d backend(s), %d discovery provider(s), listening on %v\n",
+		*path, len(cfg.Backends), len(cfg.Discovery), strings.Join(cfg.Proxy.Entries(), ", "))
+	return nil
+}
 
-	passiveCheckLb := PassiveCheck.New()
-	passiveCheckLb.LbServer()
+func strategyNames() string {
+	names := []string{}
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
 }
@@ -0,0 +1,162 @@
+package Queue
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//	  ____
+//	 / __ \__ _____ __ _____
+//	/ /_/ / // / -_) // / -_)
+//	\___\_\_,_/\__/\_,_/\__/
+//
+
+var (
+	// ErrFull is returned when the queue is at MaxDepth.
+	ErrFull = errors.New("queue: full")
+	// ErrTimeout is returned when a request waited longer than Timeout.
+	ErrTimeout = errors.New("queue: timed out")
+)
+
+// Config bounds the queue of requests waiting for a free backend.
+type Config struct {
+	MaxDepth int    `json:"max_depth"` // 0 rejects immediately when every backend is full
+	Timeout  string `json:"timeout"`   // default 10s
+}
+
+// Stats is a snapshot of the queue counters.
+type Stats struct {
+	Depth     int           `json:"depth"`
+	MaxDepth  int           `json:"max_depth"`
+	Queued    int64         `json:"queued"`
+	Rejected  int64         `json:"rejected"`
+	TimedOut  int64         `json:"timed_out"`
+	TotalWait time.Duration `json:"total_wait"`
+}
+
+// Queue is a bounded FIFO of requests waiting for backend capacity.
+// Callers join it while holding the lock that guards backend selection and
+// Hand freed slots to it under that same lock, so no slot is lost between
+// a failed pick and joining, and none is taken past a waiting request.
+type Queue struct {
+	mu       sync.Mutex
+	waiters  *list.List
+	maxDepth int
+	timeout  time.Duration
+
+	queued    int64
+	rejected  int64
+	timedOut  int64
+	totalWait int64
+}
+
+// Ticket is a place in the queue.
+type Ticket struct {
+	q      *Queue
+	elem   *list.Element
+	ready  chan struct{}
+	handed bool
+	value  interface{} // what Hand gave the ticket
+	joined time.Time
+}
+
+// New creates a Queue from cfg.
+func New(cfg Config) (*Queue, error) {
+	timeout := 10 * time.Second
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("queue: bad timeout %q: %v", cfg.Timeout, err)
+		}
+		timeout = d
+	}
+	if cfg.MaxDepth < 0 {
+		return nil, fmt.Errorf("queue: max_depth must not be negative")
+	}
+	return &Queue{waiters: list.New(), maxDepth: cfg.MaxDepth, timeout: timeout}, nil
+}
+
+// Len returns the number of waiting requests.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len()
+}
+
+// Join appends a ticket to the queue, or returns ErrFull.
+func (q *Queue) Join() (*Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiters.Len() >= q.maxDepth {
+		atomic.AddInt64(&q.rejected, 1)
+		return nil, ErrFull
+	}
+	t := &Ticket{q: q, ready: make(chan struct{}), joined: time.Now()}
+	t.elem = q.waiters.PushBack(t)
+	atomic.AddInt64(&q.queued, 1)
+	return t, nil
+}
+
+// Hand gives v, a freed slot, to the oldest waiting ticket and wakes it.
+// It returns false when nobody waits.
+func (q *Queue) Hand(v interface{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	front := q.waiters.Front()
+	if front == nil {
+		return false
+	}
+	t := q.waiters.Remove(front).(*Ticket)
+	t.handed, t.value = true, v
+	close(t.ready)
+	return true
+}
+
+// Wait blocks until the ticket is handed a slot, the queue timeout passes
+// or ctx is done. It returns the slot and how long the ticket waited.
+func (t *Ticket) Wait(ctx context.Context) (interface{}, time.Duration, error) {
+	timer := time.NewTimer(t.q.timeout - time.Since(t.joined))
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-t.ready:
+	case <-timer.C:
+		err = ErrTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	waited := time.Since(t.joined)
+	atomic.AddInt64(&t.q.totalWait, int64(waited))
+
+	t.q.mu.Lock()
+	defer t.q.mu.Unlock()
+	if t.handed {
+		// Handed a slot at the same moment it gave up: take it rather
+		// than lose it.
+		return t.value, waited, nil
+	}
+	t.q.waiters.Remove(t.elem)
+	if err == ErrTimeout {
+		atomic.AddInt64(&t.q.timedOut, 1)
+	}
+	return nil, waited, err
+}
+
+// Stats returns the current counters.
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Depth:     q.Len(),
+		MaxDepth:  q.maxDepth,
+		Queued:    atomic.LoadInt64(&q.queued),
+		Rejected:  atomic.LoadInt64(&q.rejected),
+		TimedOut:  atomic.LoadInt64(&q.timedOut),
+		TotalWait: time.Duration(atomic.LoadInt64(&q.totalWait)),
+	}
+}
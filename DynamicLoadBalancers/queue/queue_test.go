@@ -0,0 +1,106 @@
+package Queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newQueue(t *testing.T, depth int, timeout string) *Queue {
+	t.Helper()
+	q, err := New(Config{MaxDepth: depth, Timeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// Slots go to tickets in the order they joined.
+func TestHandOrder(t *testing.T) {
+	q := newQueue(t, 10, "5s")
+	if q.Hand(0) {
+		t.Fatal("handed a slot to an empty queue")
+	}
+	var tickets []*Ticket
+	for i := 0; i < 5; i++ {
+		ticket, err := q.Join()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tickets = append(tickets, ticket)
+	}
+	for i := range tickets {
+		if !q.Hand(i) {
+			t.Fatalf("slot %v: nobody waiting", i)
+		}
+	}
+	for i, ticket := range tickets {
+		v, _, err := ticket.Wait(context.Background())
+		if err != nil || v != i {
+			t.Fatalf("ticket %v got %v, %v", i, v, err)
+		}
+	}
+	if q.Len() != 0 {
+		t.Fatalf("%v tickets left", q.Len())
+	}
+}
+
+func TestFull(t *testing.T) {
+	q := newQueue(t, 1, "5s")
+	if _, err := q.Join(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Join(); err != ErrFull {
+		t.Fatalf("got %v, want ErrFull", err)
+	}
+	if q.Stats().Rejected != 1 {
+		t.Fatalf("got %+v", q.Stats())
+	}
+}
+
+// The timeout runs from Join, not from Wait.
+func TestTimeout(t *testing.T) {
+	q := newQueue(t, 1, "100ms")
+	ticket, _ := q.Join()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if _, _, err := ticket.Wait(context.Background()); err != ErrTimeout {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("waited another %v", d)
+	}
+	if q.Len() != 0 || q.Stats().TimedOut != 1 {
+		t.Fatalf("got %+v", q.Stats())
+	}
+	if q.Hand(0) {
+		t.Fatal("handed a slot to a ticket that left")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	q := newQueue(t, 1, "5s")
+	ticket, _ := q.Join()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := ticket.Wait(ctx); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if q.Len() != 0 || q.Stats().TimedOut != 0 {
+		t.Fatalf("got %+v", q.Stats())
+	}
+}
+
+// A slot handed before the ticket gives up is taken, not lost.
+func TestHandedBeforeGivingUp(t *testing.T) {
+	q := newQueue(t, 1, "5s")
+	ticket, _ := q.Join()
+	q.Hand("slot")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	v, _, err := ticket.Wait(ctx)
+	if err != nil || v != "slot" {
+		t.Fatalf("got %v, %v", v, err)
+	}
+}
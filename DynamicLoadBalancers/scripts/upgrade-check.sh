@@ -0,0 +1,114 @@
+#!/usr/bin/env bash
+# Checks that SIGUSR2 upgrades a running balancer without dropping requests.
+#
+# Builds the balancer, starts two backends (python3 http.server) and the
+# balancer on a TCP port and a Unix socket, then keeps curl busy against
+# both while the balancer is upgraded UPGRADES times. Exits non-zero if any
+# request failed or the process did not change.
+#
+#   ./scripts/upgrade-check.sh            # from DynamicLoadBalancers/
+#   UPGRADES=5 PORT=18090 ./scripts/upgrade-check.sh
+set -euo pipefail
+
+PORT=${PORT:-18090}
+UPGRADES=${UPGRADES:-3}
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+WORK=$(mktemp -d)
+PIDS=()
+
+cleanup() {
+	for pid in "${PIDS[@]}"; do kill "$pid" 2>/dev/null || true; done
+	pkill -f "$WORK/loadbalancer run" 2>/dev/null || true
+	rm -rf "$WORK"
+}
+trap cleanup EXIT
+
+(cd "$ROOT" && go build -o "$WORK/loadbalancer" .)
+
+for port in $((PORT + 1)) $((PORT + 2)); do
+	mkdir -p "$WORK/www$port"
+	echo "backend $port" >"$WORK/www$port/index.html"
+	python3 -m http.server "$port" --bind 127.0.0.1 --directory "$WORK/www$port" >/dev/null 2>&1 &
+	PIDS+=($!)
+done
+for port in $((PORT + 1)) $((PORT + 2)); do
+	for _ in $(seq 50); do
+		curl -sf "http://127.0.0.1:$port/" >/dev/null 2>&1 && break
+		sleep 0.1
+	done
+done
+
+cat >"$WORK/config.json" <<JSON
+{
+  "proxy": {
+    "listen": ["127.0.0.1:$PORT", "unix:$WORK/lb.sock"],
+    "admin_socket": "$WORK/admin.sock"
+  },
+  "backends": [
+    {"url": "http://127.0.0.1:$((PORT + 1))/"},
+    {"url": "http://127.0.0.1:$((PORT + 2))/"}
+  ]
+}
+JSON
+
+"$WORK/loadbalancer" run --strategy=passive --config "$WORK/config.json" >"$WORK/lb.log" 2>&1 &
+first=$!
+for _ in $(seq 50); do
+	curl -sf "http://127.0.0.1:$PORT/" >/dev/null 2>&1 && break
+	sleep 0.1
+done
+
+# load sends requests until $WORK/stop exists and writes "ok fail" counts.
+load() {
+	local ok=0 fail=0 code
+	while [ ! -e "$WORK/stop" ]; do
+		code=$(curl -sS -o /dev/null -w "%{http_code}" --max-time 5 "$@" 2>>"$WORK/curl.err" || true)
+		if [ "$code" = 200 ]; then
+			ok=$((ok + 1))
+		else
+			fail=$((fail + 1))
+			echo "$(date +%T.%N) $* -> ${code:-no response}" >>"$WORK/failures"
+		fi
+	done
+	echo "$ok $fail"
+}
+load "http://127.0.0.1:$PORT/" >"$WORK/tcp.count" &
+tcp=$!
+load --unix-socket "$WORK/lb.sock" "http://lb/" >"$WORK/unix.count" &
+unix=$!
+
+pid=$first
+for i in $(seq "$UPGRADES"); do
+	sleep 1
+	kill -USR2 "$pid"
+	# The old process exits once the new one is serving and it has drained.
+	for _ in $(seq 100); do
+		kill -0 "$pid" 2>/dev/null || break
+		sleep 0.1
+	done
+	new=$(pgrep -f "$WORK/loadbalancer run" | grep -vx "$pid" | head -1 || true)
+	if [ -z "$new" ] || kill -0 "$pid" 2>/dev/null; then
+		echo "upgrade $i: pid $pid did not hand over" >&2
+		grep -v "Requests Loaded" "$WORK/lb.log" | tail -50 >&2
+		exit 1
+	fi
+	echo "upgrade $i: pid $pid -> $new"
+	pid=$new
+done
+sleep 1
+touch "$WORK/stop"
+wait "$tcp" "$unix"
+
+read -r tcp_ok tcp_fail <"$WORK/tcp.count"
+read -r unix_ok unix_fail <"$WORK/unix.count"
+echo "tcp:  $tcp_ok ok, $tcp_fail failed"
+echo "unix: $unix_ok ok, $unix_fail failed"
+"$WORK/loadbalancer" status --socket "$WORK/admin.sock"
+
+if [ "$tcp_fail" -ne 0 ] || [ "$unix_fail" -ne 0 ] || [ "$tcp_ok" -eq 0 ] || [ "$unix_ok" -eq 0 ]; then
+	echo "FAIL" >&2
+	cat "$WORK/failures" "$WORK/curl.err" >&2 2>/dev/null || true
+	grep -v INFO "$WORK/lb.log" >&2 || true
+	exit 1
+fi
+echo "PASS"
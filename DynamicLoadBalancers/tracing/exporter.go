@@ -0,0 +1,183 @@
+package Tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter ships finished spans somewhere.
+type Exporter interface {
+	Export(service string, spans []*Span) error
+	Close() error
+}
+
+func newExporter(cfg Config) (Exporter, error) {
+	switch cfg.Exporter {
+	case "":
+		return nil, nil
+	case "otlp":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("tracing: otlp exporter needs an endpoint")
+		}
+		return &otlpExporter{endpoint: cfg.Endpoint, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("tracing: file exporter needs a file")
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &fileExporter{f: f}, nil
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", cfg.Exporter)
+	}
+}
+
+// OTLP JSON encoding
+// ----------------------->
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func keyValue(k, v string) otlpKeyValue {
+	kv := otlpKeyValue{Key: k}
+	kv.Value.StringValue = v
+	return kv
+}
+
+func toOTLP(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentID,
+		TraceState:        s.TraceState,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: 1},
+	}
+	for k, v := range s.Attributes {
+		o.Attributes = append(o.Attributes, keyValue(k, v))
+	}
+	if s.Err != "" {
+		o.Status = otlpStatus{Code: 2, Message: s.Err}
+	}
+	return o
+}
+
+func buildRequest(service string, spans []*Span) otlpRequest {
+	var ss otlpScopeSpans
+	ss.Scope.Name = "example.com/loadbalancers/tracing"
+	for _, s := range spans {
+		ss.Spans = append(ss.Spans, toOTLP(s))
+	}
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpKeyValue{keyValue("service.name", service)}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+// <-----------------------
+
+// otlpExporter posts OTLP/HTTP JSON payloads to a collector.
+type otlpExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (e *otlpExporter) Export(service string, spans []*Span) error {
+	body, err := json.Marshal(buildRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("tracing: collector returned %v", resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpExporter) Close() error { return nil }
+
+// fileExporter writes one OTLP JSON span per line, for local runs.
+type fileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+type fileSpan struct {
+	Service string `json:"service"`
+	otlpSpan
+}
+
+func (e *fileExporter) Export(service string, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.f)
+	for _, s := range spans {
+		if err := enc.Encode(fileSpan{Service: service, otlpSpan: toOTLP(s)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *fileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
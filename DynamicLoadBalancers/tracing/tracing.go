@@ -0,0 +1,318 @@
+package Tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//	 ______              _
+//	/_  __/______ ______(_)__  ___ _
+//	 / / / __/ _ `/ __/ / _ \/ _ `/
+//	/_/ /_/  \_,_/\__/_/_//_/\_, /
+//	                        /___/
+
+// Header names used for propagation.
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+	HeaderRequestID   = "X-Request-ID"
+)
+
+// Span kinds as defined by OTLP.
+const (
+	KindServer = 2
+	KindClient = 3
+)
+
+// Config controls how spans are exported.
+// An empty Exporter still propagates traceparent and X-Request-ID, but drops spans.
+type Config struct {
+	Exporter    string `json:"exporter"` // "otlp", "file" or ""
+	Endpoint    string `json:"endpoint"` // OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	File        string `json:"file"`     // JSON lines output for the file exporter
+	ServiceName string `json:"service_name"`
+}
+
+// Span is a single timed operation within a trace.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	TraceState string
+	RequestID  string
+	Name       string
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        string
+	sampled    bool
+
+	mu     sync.Mutex
+	tracer *Tracer
+	ended  bool
+}
+
+// Tracer starts spans and hands finished ones to an Exporter in batches.
+type Tracer struct {
+	service  string
+	exporter Exporter
+	spanCh   chan *Span
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+const (
+	batchSize     = 100
+	flushInterval = 5 * time.Second
+)
+
+// New creates a Tracer from cfg and starts its export loop.
+func New(cfg Config) (*Tracer, error) {
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	service := cfg.ServiceName
+	if service == "" {
+		service = "loadbalancer"
+	}
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		spanCh:   make(chan *Span, 1024),
+		doneCh:   make(chan struct{}),
+	}
+	if exporter != nil {
+		t.wg.Add(1)
+		go t.exportLoop()
+	}
+	return t, nil
+}
+
+// Shutdown flushes pending spans and closes the exporter.
+func (t *Tracer) Shutdown() {
+	if t == nil || t.exporter == nil {
+		return
+	}
+	close(t.doneCh)
+	t.wg.Wait()
+	t.exporter.Close()
+}
+
+func (t *Tracer) exportLoop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// Export errors are not fatal to the proxy; the batch is dropped.
+		_ = t.exporter.Export(t.service, batch)
+		batch = make([]*Span, 0, batchSize)
+	}
+	for {
+		select {
+		case s := <-t.spanCh:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.doneCh:
+			for {
+				select {
+				case s := <-t.spanCh:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span stored in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// RequestID returns the request ID of the span stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.RequestID
+	}
+	return ""
+}
+
+// StartRequest starts a server span for an incoming request.
+// The W3C trace context is continued when a valid traceparent is present and
+// generated otherwise. X-Request-ID is kept when supplied and valid,
+// generated if not, and set on the request so it is forwarded upstream.
+func (t *Tracer) StartRequest(r *http.Request) (*Span, *http.Request) {
+	s := &Span{
+		Name:       "proxy " + r.Method,
+		Kind:       KindServer,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+		tracer:     t,
+	}
+	if traceID, parentID, sampled, ok := parseTraceParent(r.Header.Get(HeaderTraceParent)); ok {
+		s.TraceID, s.ParentID, s.sampled = traceID, parentID, sampled
+		s.TraceState = r.Header.Get(HeaderTraceState)
+	} else {
+		s.TraceID = randomHex(16)
+		s.sampled = true
+	}
+	s.SpanID = randomHex(8)
+
+	s.RequestID = r.Header.Get(HeaderRequestID)
+	if !validRequestID(s.RequestID) {
+		s.RequestID = randomHex(16)
+		r.Header.Set(HeaderRequestID, s.RequestID)
+	}
+
+	s.Attributes["http.method"] = r.Method
+	s.Attributes["http.target"] = r.URL.RequestURI()
+	s.Attributes["request.id"] = s.RequestID
+
+	return s, r.WithContext(context.WithValue(r.Context(), spanKey{}, s))
+}
+
+// StartChild starts a client span under s, e.g. for the upstream round trip.
+func (s *Span) StartChild(name string) *Span {
+	return &Span{
+		TraceID:    s.TraceID,
+		SpanID:     randomHex(8),
+		ParentID:   s.SpanID,
+		TraceState: s.TraceState,
+		RequestID:  s.RequestID,
+		Name:       name,
+		Kind:       KindClient,
+		Start:      time.Now(),
+		Attributes: map[string]string{"request.id": s.RequestID},
+		sampled:    s.sampled,
+		tracer:     s.tracer,
+	}
+}
+
+// Inject writes the span's trace context and request ID into h.
+func (s *Span) Inject(h http.Header) {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	h.Set(HeaderTraceParent, fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags))
+	if s.TraceState != "" {
+		h.Set(HeaderTraceState, s.TraceState)
+	} else {
+		h.Del(HeaderTraceState)
+	}
+	h.Set(HeaderRequestID, s.RequestID)
+}
+
+// SetAttr records a string attribute on the span.
+func (s *Span) SetAttr(key, value string) {
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	s.Err = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish ends the span and queues it for export. Calling it twice is a no-op.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	t := s.tracer
+	if t == nil || t.exporter == nil || !s.sampled {
+		return
+	}
+	select {
+	case t.spanCh <- s:
+	default:
+		// Exporter is behind; drop rather than block the request path.
+	}
+}
+
+// parseTraceParent validates a version 00 traceparent header.
+func parseTraceParent(v string) (traceID, parentID string, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", false, false
+	}
+	traceID, parentID = parts[1], parts[2]
+	if len(traceID) != 32 || !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) {
+		return "", "", false, false
+	}
+	if len(parentID) != 16 || !isLowerHex(parentID) || parentID == strings.Repeat("0", 16) {
+		return "", "", false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return "", "", false, false
+	}
+	return traceID, parentID, flags[0]&0x01 == 1, true
+}
+
+// maxRequestID is the longest X-Request-ID kept from a client.
+const maxRequestID = 128
+
+// validRequestID allows short IDs of printable ASCII without spaces, so a
+// client cannot forge log lines or fields with them.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,209 @@
+package Tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID = "00f067aa0ba902b7"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	for _, c := range []struct {
+		name, header string
+		ok, sampled  bool
+	}{
+		{"sampled", "00-" + traceID + "-" + parentID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + parentID + "-00", true, false},
+		{"padded", "  00-" + traceID + "-" + parentID + "-01 ", true, true},
+		{"later version with more fields", "01-" + traceID + "-" + parentID + "-01-extra", true, true},
+		{"empty", "", false, false},
+		{"version ff", "ff-" + traceID + "-" + parentID + "-01", false, false},
+		{"version 00 with more fields", "00-" + traceID + "-" + parentID + "-01-extra", false, false},
+		{"short trace id", "00-" + traceID[1:] + "-" + parentID + "-01", false, false},
+		{"upper case trace id", "00-" + strings.ToUpper(traceID) + "-" + parentID + "-01", false, false},
+		{"zero trace id", "00-" + strings.Repeat("0", 32) + "-" + parentID + "-01", false, false},
+		{"short parent id", "00-" + traceID + "-" + parentID[1:] + "-01", false, false},
+		{"zero parent id", "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", false, false},
+		{"bad flags", "00-" + traceID + "-" + parentID + "-zz", false, false},
+		{"long flags", "00-" + traceID + "-" + parentID + "-0101", false, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			gotTrace, gotParent, sampled, ok := parseTraceParent(c.header)
+			if ok != c.ok || sampled != c.sampled {
+				t.Fatalf("got ok %v sampled %v, want ok %v sampled %v", ok, sampled, c.ok, c.sampled)
+			}
+			if ok && (gotTrace != traceID || gotParent != parentID) {
+				t.Fatalf("got trace %v parent %v", gotTrace, gotParent)
+			}
+		})
+	}
+}
+
+// A valid traceparent is continued, the span is in the request's context
+// and Inject hands the trace on with this span as the parent.
+func TestPropagation(t *testing.T) {
+	tracer, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set(HeaderTraceParent, "00-"+traceID+"-"+parentID+"-01")
+	r.Header.Set(HeaderTraceState, "vendor=1")
+	r.Header.Set(HeaderRequestID, "req-1")
+
+	s, r := tracer.StartRequest(r)
+	if s.TraceID != traceID || s.ParentID != parentID || s.SpanID == parentID || !s.sampled {
+		t.Fatalf("span did not continue the trace: %+v", s)
+	}
+	if SpanFromContext(r.Context()) != s || RequestID(r.Context()) != "req-1" {
+		t.Fatal("span not in the request context")
+	}
+	if RequestID(context.Background()) != "" {
+		t.Fatal("request id without a span")
+	}
+
+	child := s.StartChild("upstream")
+	h := http.Header{}
+	child.Inject(h)
+	if want := "00-" + traceID + "-" + child.SpanID + "-01"; h.Get(HeaderTraceParent) != want {
+		t.Errorf("traceparent %q, want %q", h.Get(HeaderTraceParent), want)
+	}
+	if child.ParentID != s.SpanID || h.Get(HeaderTraceState) != "vendor=1" || h.Get(HeaderRequestID) != "req-1" {
+		t.Errorf("child %+v injected %v", child, h)
+	}
+
+	// A bad traceparent starts a new, sampled trace
+	r = httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set(HeaderTraceParent, "00-nope-nope-01")
+	r.Header.Set(HeaderTraceState, "vendor=1")
+	s, _ = tracer.StartRequest(r)
+	if len(s.TraceID) != 32 || s.TraceID == traceID || s.ParentID != "" || s.TraceState != "" || !s.sampled {
+		t.Fatalf("got %+v, want a new trace", s)
+	}
+	h = http.Header{HeaderTraceState: {"stale"}}
+	s.Inject(h)
+	if h.Get(HeaderTraceState) != "" {
+		t.Errorf("tracestate %q left on a new trace", h.Get(HeaderTraceState))
+	}
+}
+
+// X-Request-ID is kept when it is safe to log, and replaced otherwise.
+func TestRequestID(t *testing.T) {
+	tracer, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name, sent string
+		kept       bool
+	}{
+		{"sane", "client-42", true},
+		{"longest", strings.Repeat("x", maxRequestID), true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("x", maxRequestID+1), false},
+		{"space", "has space", false},
+		{"newline", "a\nforged line", false},
+		{"control", "a\x1b[31m", false},
+		{"not ascii", "ïd", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.sent != "" {
+				r.Header.Set(HeaderRequestID, c.sent)
+			}
+			s, r := tracer.StartRequest(r)
+			if c.kept && s.RequestID != c.sent {
+				t.Fatalf("got %q, want %q kept", s.RequestID, c.sent)
+			}
+			if !c.kept && (s.RequestID == c.sent || len(s.RequestID) != 32 || !isLowerHex(s.RequestID)) {
+				t.Fatalf("got %q, want a generated id", s.RequestID)
+			}
+			if r.Header.Get(HeaderRequestID) != s.RequestID || s.Attributes["request.id"] != s.RequestID {
+				t.Fatalf("forwarded %q, recorded %q, want %q", r.Header.Get(HeaderRequestID), s.Attributes["request.id"], s.RequestID)
+			}
+		})
+	}
+}
+
+// The file exporter writes every sampled span as a JSON line once the
+// tracer shuts down, and leaves unsampled ones out.
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	tracer, err := New(Config{Exporter: "file", File: path, ServiceName: "lb-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set(HeaderRequestID, "req-1")
+	s, _ := tracer.StartRequest(r)
+	child := s.StartChild("upstream")
+	child.SetAttr("http.status_code", "502")
+	child.SetError(errors.New("backend down"))
+	child.Finish()
+	s.Finish()
+	s.Finish()
+
+	r = httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set(HeaderTraceParent, "00-"+traceID+"-"+parentID+"-00")
+	unsampled, _ := tracer.StartRequest(r)
+	unsampled.Finish()
+	tracer.Shutdown()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var spans []fileSpan
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line fileSpan
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("%v: %s", err, scanner.Bytes())
+		}
+		spans = append(spans, line)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the request and its child", len(spans))
+	}
+	byName := map[string]fileSpan{}
+	for _, line := range spans {
+		if line.Service != "lb-test" || line.TraceID != s.TraceID {
+			t.Errorf("span %+v is not from lb-test's trace %v", line, s.TraceID)
+		}
+		byName[line.Name] = line
+	}
+	server, upstream := byName["proxy GET"], byName["upstream"]
+	if server.Kind != KindServer || server.Status.Code != 1 || server.ParentSpanID != "" {
+		t.Errorf("server span %+v", server)
+	}
+	if upstream.Kind != KindClient || upstream.ParentSpanID != server.SpanID || upstream.Status.Code != 2 || upstream.Status.Message != "backend down" {
+		t.Errorf("upstream span %+v", upstream)
+	}
+	attrs := map[string]string{}
+	for _, kv := range upstream.Attributes {
+		attrs[kv.Key] = kv.Value.StringValue
+	}
+	if attrs["request.id"] != "req-1" || attrs["http.status_code"] != "502" {
+		t.Errorf("upstream attributes %v", attrs)
+	}
+
+	if _, err := New(Config{Exporter: "file"}); err == nil {
+		t.Error("file exporter without a file")
+	}
+	if _, err := New(Config{Exporter: "carrier-pigeon"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
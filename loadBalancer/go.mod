@@ -1,3 +1,16 @@
 module reverseProxy
 
 go 1.18
+
+require example.com/loadbalancers v0.0.0
+
+require (
+	github.com/BurntSushi/toml v1.3.2 // indirect
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace example.com/loadbalancers => ../DynamicLoadBalancers
@@ -2,93 +2,100 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"log"
-	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"sync"
+	"os"
+	"strconv"
+	"strings"
 	"time"
-)
 
-// Logging Structure
-// ----------------------->
-const (
-	logInfo    = "INFO"
-	logWarning = "WARNING"
-	logError   = "ERROR"
+	"example.com/loadbalancers/core"
 )
 
-type logEntry struct {
-	time     time.Time
-	severity string
-	message  string
+// Default origin servers, used when no --backend or --backends is given.
+var defaultBackends = []string{
+	"http://localhost:8081",
+	"http://localhost:8082",
 }
 
-// <-----------------------
-
-// Wait Group
-var logCh = make(chan logEntry, 50) // regular channel
-var doneCh = make(chan struct{})    // signal only channel
+// backendFlags collects repeated --backend flags.
+type backendFlags []string
 
-func main() {
+func (b *backendFlags) String() string {
+	return strings.Join(*b, ",")
+}
 
-	// This is a way to pass in a port number to the program. Via Flags
-	portFlag := flag.Int("port", 8080, "listening port")
-	flag.Parse()
-	port := fmt.Sprintf(":%d", *portFlag)
+func (b *backendFlags) Set(value string) error {
+	*b = append(*b, value)
+	return nil
+}
 
+func main() {
 	// Close logger at end of life
-	go logger()
-	defer func() {
-		close(logCh)
-	}()
+	go Core.Logger()
+	defer Core.StopLogger()
 
-	loadBalancer(port)
+	cfg, opts, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := Core.Run(cfg, opts); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func loadBalancer(port string) {
-	var nextServerIndex int32 = 0
-	var mu sync.Mutex
-
-	// define origin server list to load balance the requests
-	originServerList := []string{
-		"http://localhost:8081",
-		"http://localhost:8082",
+// parseFlags turns the command line into a balancer config. The balancer,
+// its health check and failover are the shared Core ones; only the flags
+// are this program's own.
+func parseFlags(fs *flag.FlagSet, args []string) (Core.Config, Core.Options, error) {
+	// This is a way to pass in a port number to the program. Via Flags
+	portFlag := fs.Int("port", 8080, "listening port")
+	var backendList backendFlags
+	fs.Var(&backendList, "backend", "origin server URL, repeat for more servers")
+	backendsFile := fs.String("backends", "", "file with one origin server URL per line, # comments")
+	healthInterval := fs.Duration("health-interval", 10*time.Second, "how often to check origin servers, 0 disables it")
+	failover := fs.Bool("failover", true, "retry a failed request on the next origin server")
+	if err := fs.Parse(args); err != nil {
+		return Core.Config{}, Core.Options{}, err
 	}
 
-	loadBalancerHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		// use mutex to prevent data race
-		mu.Lock()
-
-		// get next server to send a request to
-		originServerURL, _ := url.Parse(originServerList[(nextServerIndex)%2])
-
-		// increment next server value
-		nextServerIndex++
-
-		mu.Unlock()
-
-		// use existing reverse proxy from httputil to route
-		// a request to previously selected server url
-		reverseProxy := httputil.NewSingleHostReverseProxy(originServerURL)
-
-		reverseProxy.ServeHTTP(rw, req)
-		logCh <- logEntry{time.Now(), logInfo, "Requests Loaded to : http://" + originServerURL.Host}
-
-	})
-	logCh <- logEntry{time.Now(), logInfo, "Server up : http://localhost:" + port}
-	log.Fatal(http.ListenAndServe(port, loadBalancerHandler))
+	urls := []string(backendList)
+	if *backendsFile != "" {
+		fromFile, err := readBackendsFile(*backendsFile)
+		if err != nil {
+			return Core.Config{}, Core.Options{}, err
+		}
+		urls = append(urls, fromFile...)
+	}
+	if len(urls) == 0 {
+		urls = defaultBackends
+	}
 
+	// No admin socket: everything this balancer does is set by its flags.
+	cfg := Core.Config{Proxy: Core.Proxy{Port: strconv.Itoa(*portFlag), AdminSocket: "none"}}
+	for _, u := range urls {
+		cfg.Backends = append(cfg.Backends, &Core.Backend{URL: u})
+	}
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		err.(*Core.ConfigError).Path = "flags"
+		return cfg, Core.Options{}, err
+	}
+	return cfg, Core.Options{Failover: *failover, HealthCheck: *healthInterval}, nil
 }
 
-func logger() {
-	for {
-		select {
-		case entry := <-logCh:
-			fmt.Printf("%v : [%v] %v\n", entry.time.Format("2006-01-02"), entry.severity, entry.message)
-		case <-doneCh:
-			break
+// readBackendsFile reads one URL per line, skipping blanks and # comments.
+func readBackendsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		urls = append(urls, line)
 	}
+	return urls, nil
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/loadbalancers/core"
+)
+
+func backendURLs(cfg Core.Config) []string {
+	var urls []string
+	for _, b := range cfg.Backends {
+		urls = append(urls, b.URL)
+	}
+	return urls
+}
+
+func TestParseFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backends")
+	if err := os.WriteFile(file, []byte("# origin servers\nhttp://c:8083\n\n  http://d:8084  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name     string
+		args     []string
+		port     string
+		backends []string
+		opts     Core.Options
+		err      string
+	}{
+		{"defaults", nil, "8080", defaultBackends, Core.Options{Failover: true, HealthCheck: 10 * time.Second}, ""},
+		{"flags", []string{"-port=9090", "-backend=http://a:8081", "-backend=http://b:8082", "-failover=false", "-health-interval=0"},
+			"9090", []string{"http://a:8081", "http://b:8082"}, Core.Options{}, ""},
+		{"file", []string{"-backend=http://a:8081", "-backends=" + file},
+			"8080", []string{"http://a:8081", "http://c:8083", "http://d:8084"}, Core.Options{Failover: true, HealthCheck: 10 * time.Second}, ""},
+		{"missing file", []string{"-backends=" + file + ".missing"}, "", nil, Core.Options{}, "no such file"},
+		{"bad url", []string{"-backend=localhost:8081"}, "", nil, Core.Options{}, "backends[0].url"},
+		{"listed twice", []string{"-backend=http://a:8081", "-backend=http://a:8081"}, "", nil, Core.Options{}, "listed twice"},
+		{"bad port", []string{"-port=70000"}, "", nil, Core.Options{}, "proxy.port"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("loadBalancer", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			cfg, opts, err := parseFlags(fs, c.args)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got %v, want an error about %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Proxy.Port != c.port || cfg.Proxy.AdminSocket != "none" {
+				t.Errorf("got proxy %+v", cfg.Proxy)
+			}
+			if got := backendURLs(cfg); !reflect.DeepEqual(got, c.backends) {
+				t.Errorf("got backends %v, want %v", got, c.backends)
+			}
+			if opts != c.opts {
+				t.Errorf("got %+v, want %+v", opts, c.opts)
+			}
+		})
+	}
+}
+
+// The flags drive the shared balancer: requests go round robin and a dead
+// origin server is skipped.
+func TestServe(t *testing.T) {
+	var args []string
+	hits := map[string]int{}
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		defer s.Close()
+		args = append(args, "-backend="+s.URL)
+		hits[name] = 0
+	}
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	args = append(args, "-backend="+dead.URL)
+
+	fs := flag.NewFlagSet("loadBalancer", flag.ContinueOnError)
+	cfg, opts, err := parseFlags(fs, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balancer, err := Core.New(cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balancer.Close()
+	proxy := httptest.NewServer(balancer.Handler())
+	defer proxy.Close()
+
+	for i := 0; i < 30; i++ {
+		resp, err := http.Get(proxy.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %v: got %v %s", i, resp.StatusCode, body)
+		}
+		hits[string(body)]++
+	}
+	for name, n := range hits {
+		if n != 10 {
+			t.Errorf("%v got %v of 30 requests", name, n)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package Api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"s_backend/feed"
+	"s_backend/search"
+	"s_backend/store"
+)
+
+// API serves the event endpoints from a Store.EventStore.
+type API struct {
+	store Store.EventStore
+	cfg   Config
+	feed  *Feed.Feed
+	index *Search.Index
+
+	writeMu sync.Mutex // orders writes, their changes and the index alike
+}
+
+// Config tunes the API, the zero Config is the default.
+type Config struct {
+	// RequireIfMatch turns a PUT, PATCH or DELETE without If-Match into a
+	// 428, so clients cannot overwrite changes they have not seen.
+	RequireIfMatch bool
+	// Feed records every change for /events/stream and webhooks. When it
+	// is nil the router keeps its own with Feed.DefaultSize changes.
+	Feed *Feed.Feed
+	// Webhooks serves /webhooks, it has to follow Feed. When it is nil
+	// there are no webhooks.
+	Webhooks *Feed.Webhooks
+	// CORS lets browsers on other origins call the API.
+	CORS CORSConfig
+	// Timeout is how long a request may take before it is answered with
+	// a 503, 0 for no limit. Streams are not held to it.
+	Timeout time.Duration
+}
+
+// NewRouter returns the router for every endpoint, backed by store.
+func NewRouter(store Store.EventStore, cfg Config) *mux.Router {
+	a := &API{store: store, cfg: cfg, feed: cfg.Feed}
+	if a.feed == nil {
+		a.feed = Feed.New(Feed.DefaultSize)
+	}
+	a.index = indexStore(store)
+	router := mux.NewRouter().StrictSlash(true)
+	middleware := []mux.MiddlewareFunc{RequestID, LogRequests, Recover, CORS(cfg.CORS)}
+	router.Use(middleware...)
+	routes := a.routes()
+	for _, rt := range routes {
+		var handler http.Handler = rt.handler
+		if cfg.Timeout > 0 && !rt.doc.stream {
+			handler = Timeout(cfg.Timeout)(handler)
+		}
+		router.Handle(rt.path, handler).Methods(rt.method)
+	}
+	// The spec documents the routes above, these two serve it
+	router.HandleFunc(SpecPath, serveSpec(routes)).Methods("GET")
+	router.HandleFunc(DocsPath, serveDocs).Methods("GET")
+	// mux skips the middleware when no route matches, so these get it
+	// here, CORS preflight requests included
+	router.NotFoundHandler = Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, newError(http.StatusNotFound, CodeNotFound, "no such endpoint "+r.URL.Path))
+	}), middleware...)
+	router.MethodNotAllowedHandler = Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path))
+	}), middleware...)
+	return router
+}
+
+// Callback Function
+func homeLink(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "Welcome home!")
+}
+
+func (a *API) createEvent(w http.ResponseWriter, r *http.Request) {
+	var newEvent Store.Event
+	// Parse json data to event type
+	if err := decodeJSON(r, &newEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkServerFields(newEvent, Store.Event{}); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := validateEvent(&newEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Add Event to the store
+	newEvent.ID = NewID()
+	newEvent.CreatedAt = now()
+	newEvent.UpdatedAt = newEvent.CreatedAt
+	newEvent.Version = 1
+	if err := a.commit(Feed.Created, newEvent, a.store.Create); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Send Back status and body
+	w.Header().Set("Location", "/events/"+newEvent.ID)
+	w.Header().Set("ETag", eventTag(newEvent))
+	writeJSON(w, http.StatusCreated, newEvent)
+
+	// log
+	Logf(LogInfo, "Event # %v was created", newEvent.ID)
+}
+
+func (a *API) getOneEvent(w http.ResponseWriter, r *http.Request) {
+	// Grab EventID
+	eventID := mux.Vars(r)["id"]
+
+	singleEvent, err := a.store.Get(eventID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// log
+	Logf(LogInfo, "Event # %v was queried", singleEvent.ID)
+	// Send back event, or 304 when the client has this version
+	writeTagged(w, r, eventTag(singleEvent), singleEvent)
+}
+
+func (a *API) getAllEvents(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page, err := query.page(a.store)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Log
+	Logf(LogInfo, "%d Events have been queried", len(page.Events))
+	// return one page, with links to the first and next
+	w.Header().Set("Link", pageLinks(r, page.NextCursor))
+	writeTagged(w, r, bodyTag(page), page)
+}
+
+// replaceEvent handles PUT: the body is the whole event, so fields left out
+// are cleared.
+func (a *API) replaceEvent(w http.ResponseWriter, r *http.Request) {
+	// Get eventID
+	eventID := mux.Vars(r)["id"]
+	var newEvent Store.Event
+
+	// Parse body to Event Type
+	if err := decodeJSON(r, &newEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Events are only created by POST, so an unknown ID is a 404
+	stored, err := a.store.Get(eventID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := a.checkIfMatch(r, stored); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkVersion(newEvent, stored); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkServerFields(newEvent, stored); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := validateEvent(&newEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+	newEvent.ID = stored.ID
+	newEvent.CreatedAt = stored.CreatedAt
+	newEvent.UpdatedAt = now()
+	newEvent.Version = stored.Version + 1
+	// The store refuses the write if someone else got in since the Get
+	if err := a.commit(Feed.Updated, newEvent, a.store.Update); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Log
+	Logf(LogInfo, "Event # %v was replaced", newEvent.ID)
+	w.Header().Set("ETag", eventTag(newEvent))
+	writeJSON(w, http.StatusOK, newEvent)
+}
+
+// updateEvent handles PATCH with a JSON Merge Patch: fields left out are
+// kept and fields set to null are cleared.
+func (a *API) updateEvent(w http.ResponseWriter, r *http.Request) {
+	// Get eventID
+	eventID := mux.Vars(r)["id"]
+
+	// Find Event and apply the patch to it
+	singleEvent, err := a.store.Get(eventID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := a.checkIfMatch(r, singleEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+	singleEvent, err = patchEvent(r, singleEvent)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := validateEvent(&singleEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+	singleEvent.UpdatedAt = now()
+	singleEvent.Version++
+	// The store refuses the write if someone else got in since the Get
+	if err := a.commit(Feed.Updated, singleEvent, a.store.Update); err != nil {
+		writeError(w, err)
+		return
+	}
+	// Log
+	Logf(LogInfo, "Event # %v was updated", singleEvent.ID)
+	w.Header().Set("ETag", eventTag(singleEvent))
+	writeJSON(w, http.StatusOK, singleEvent)
+}
+
+func (a *API) deleteEvent(w http.ResponseWriter, r *http.Request) {
+	// Fetch ID
+	eventID := mux.Vars(r)["id"]
+
+	// Only hold the store to a version when the client named one
+	var version int64
+	if r.Header.Get("If-Match") != "" || a.cfg.RequireIfMatch {
+		stored, err := a.store.Get(eventID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := a.checkIfMatch(r, stored); err != nil {
+			writeError(w, err)
+			return
+		}
+		version = stored.Version
+	}
+	remove := func(e Store.Event) error { return a.store.Delete(e.ID, version) }
+	if err := a.commit(Feed.Deleted, Store.Event{ID: eventID}, remove); err != nil {
+		writeError(w, err)
+		return
+	}
+	Logf(LogInfo, "Event # %v was deleted", eventID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commit runs write on e and, when it succeeds, publishes the change to
+// the feed and updates the search index under one lock, so both follow
+// the order the store took the changes in. Deletes only carry the ID.
+func (a *API) commit(typ string, e Store.Event, write func(Store.Event) error) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	if err := write(e); err != nil {
+		return err
+	}
+	if typ == Feed.Deleted {
+		a.index.Remove(e.ID)
+		a.feed.Publish(typ, e.ID, nil)
+	} else {
+		a.index.Put(e)
+		a.feed.Publish(typ, e.ID, &e)
+	}
+	return nil
+}
+
+// now is the time stamped on events, in UTC so every store keeps it alike.
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,515 @@
+package Api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"s_backend/feed"
+	"s_backend/store"
+)
+
+// Import & export
+// ----------------------->
+
+// Formats of POST /events:import and GET /events:export.
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// Modes of POST /events:import.
+const (
+	// ImportAtomic stores every row or, when one is rejected, none.
+	ImportAtomic = "atomic"
+	// ImportBestEffort stores the rows that pass as they are read.
+	ImportBestEffort = "best_effort"
+)
+
+// MaxImport caps an import body, in bytes.
+const MaxImport = 32 << 20
+
+// exportBatch is how many events an export reads from the store at once.
+const exportBatch = 500
+
+// mediaTypes of each format, the first is the one sent.
+var mediaTypes = map[string][]string{
+	FormatNDJSON: {"application/x-ndjson", "application/ndjson", "application/jsonl"},
+	FormatCSV:    {"text/csv"},
+}
+
+// csvColumns are the CSV columns, named like the JSON fields.
+var csvColumns = []string{"ID", "Title", "Description", "created_at", "updated_at", "version"}
+
+// ImportRow is how one row of an import went. Row counts the events in
+// the body from 1, leaving out the CSV header and blank lines.
+type ImportRow struct {
+	Row    int          `json:"row"`
+	ID     string       `json:"id,omitempty"`
+	Status string       `json:"status"` // accepted or rejected
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// ImportReport is what POST /events:import answers. Committed says whether
+// the accepted rows were stored. When the import failed Error says why,
+// so the report doubles as an error envelope.
+type ImportReport struct {
+	Mode      string      `json:"mode"`
+	Format    string      `json:"format"`
+	Total     int         `json:"total"`
+	Accepted  int         `json:"accepted"`
+	Rejected  int         `json:"rejected"`
+	Committed bool        `json:"committed"`
+	Rows      []ImportRow `json:"rows"`
+	Error     *APIError   `json:"error,omitempty"`
+}
+
+// errImportTooLarge is returned by importLimit past MaxImport.
+var errImportTooLarge = errors.New("the import is larger than the limit")
+
+// importLimit reads at most n bytes from r, then fails.
+type importLimit struct {
+	r    io.Reader
+	n    int64
+	over bool
+}
+
+func (l *importLimit) Read(p []byte) (int, error) {
+	if l.over {
+		return 0, errImportTooLarge
+	}
+	// One byte more than is left tells a body of exactly the limit from a
+	// longer one
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.over = true
+		return int(l.n), errImportTooLarge
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// rowReader reads the events of an import one row at a time. Problems
+// with a row come back as its errors, those without a field when the row
+// could not be read at all. err is for the body as a whole and is io.EOF
+// at the end.
+type rowReader interface {
+	next() (e Store.Event, rowErrs []FieldError, err error)
+}
+
+// ndjsonReader reads an event per line.
+type ndjsonReader struct {
+	lines *bufio.Scanner
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 64<<10), MaxBody)
+	return &ndjsonReader{lines}
+}
+
+func (nr *ndjsonReader) next() (Store.Event, []FieldError, error) {
+	var e Store.Event
+	for nr.lines.Scan() {
+		line := bytes.TrimSpace(nr.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			return e, []FieldError{{"", "is not a JSON event: " + err.Error()}}, nil
+		}
+		if dec.More() {
+			return e, []FieldError{{"", "has more than one JSON value"}}, nil
+		}
+		return e, nil, nil
+	}
+	if err := nr.lines.Err(); err == bufio.ErrTooLong {
+		return e, nil, newError(http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("a line is longer than %d bytes", MaxBody))
+	} else if err != nil {
+		return e, nil, err
+	}
+	return e, nil, io.EOF
+}
+
+// csvReader reads an event per record, the header names the columns.
+type csvReader struct {
+	records *csv.Reader
+	columns []string // canonical name of each column
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	records := csv.NewReader(r)
+	header, err := records.Read()
+	if err == io.EOF {
+		return nil, newError(http.StatusBadRequest, CodeBadRequest, "the CSV has no header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	records.FieldsPerRecord = len(header)
+	cr := &csvReader{records: records}
+	seen := map[string]bool{}
+	for _, name := range header {
+		column := ""
+		for _, c := range csvColumns {
+			// Spreadsheets may start the file with a byte order mark
+			if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")), c) {
+				column = c
+			}
+		}
+		if column == "" || seen[column] {
+			return nil, newError(http.StatusBadRequest, CodeBadRequest,
+				fmt.Sprintf("the CSV header has %q, columns are %v and each at most once", name, strings.Join(csvColumns, ", ")))
+		}
+		seen[column] = true
+		cr.columns = append(cr.columns, column)
+	}
+	if !seen["Title"] {
+		return nil, newError(http.StatusBadRequest, CodeBadRequest, "the CSV header has no Title column")
+	}
+	return cr, nil
+}
+
+func (cr *csvReader) next() (Store.Event, []FieldError, error) {
+	var e Store.Event
+	record, err := cr.records.Read()
+	if perr, ok := err.(*csv.ParseError); ok && perr.Err == csv.ErrFieldCount {
+		return e, []FieldError{{"", fmt.Sprintf("has %d columns, the header %d", len(record), len(cr.columns))}}, nil
+	}
+	if err != nil {
+		return e, nil, err
+	}
+	var rowErrs []FieldError
+	for i, v := range record {
+		switch cr.columns[i] {
+		case "ID":
+			e.ID = v
+		case "Title":
+			e.Title = v
+		case "Description":
+			e.Description = v
+		case "created_at", "updated_at":
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				rowErrs = append(rowErrs, FieldError{cr.columns[i], "must be an RFC 3339 time"})
+			} else if cr.columns[i] == "created_at" {
+				e.CreatedAt = t
+			} else {
+				e.UpdatedAt = t
+			}
+		case "version":
+			if v == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				rowErrs = append(rowErrs, FieldError{"version", "must be a whole number"})
+			}
+			e.Version = n
+		}
+	}
+	return e, rowErrs, nil
+}
+
+// reservedIDs are the literal segments routes has after /events/. An
+// event with one of them as its ID could not be read by its URL.
+var reservedIDs = map[string]bool{"stream": true, "search": true}
+
+// validImportID allows IDs that work in a path: letters, digits and "-",
+// "_", ".", "~", up to 128, and not a segment of another route.
+func validImportID(id string) bool {
+	if len(id) > 128 || id == "." || id == ".." || reservedIDs[id] {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareImport fills in what an imported event left out and checks the
+// rest, the way the store would get it from POST /event. IDs, timestamps
+// and versions from another environment are kept.
+func prepareImport(e Store.Event, at time.Time) (Store.Event, []FieldError) {
+	var rowErrs []FieldError
+	if e.ID == "" {
+		e.ID = NewID()
+	} else if !validImportID(e.ID) {
+		rowErrs = append(rowErrs, FieldError{"ID", "may only have letters, digits, -, _, . and ~, up to 128, and not be stream or search"})
+	}
+	if err := validateEvent(&e); err != nil {
+		if apiErr, ok := err.(*APIError); ok {
+			rowErrs = append(rowErrs, apiErr.Details...)
+		}
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = at
+	}
+	if e.UpdatedAt.IsZero() {
+		e.UpdatedAt = e.CreatedAt
+	}
+	e.CreatedAt, e.UpdatedAt = e.CreatedAt.UTC(), e.UpdatedAt.UTC()
+	if e.UpdatedAt.Before(e.CreatedAt) {
+		rowErrs = append(rowErrs, FieldError{"updated_at", "is before created_at"})
+	}
+	switch {
+	case e.Version == 0:
+		e.Version = 1
+	case e.Version < 0:
+		rowErrs = append(rowErrs, FieldError{"version", "must be at least 1"})
+	}
+	return e, rowErrs
+}
+
+// importEvents handles POST /events:import. The body is NDJSON or CSV, by
+// Content-Type, read and checked a row at a time. ?mode=atomic, the
+// default, stores all rows or none, ?mode=best_effort stores every row
+// that passes. Either way the answer reports on every row.
+func (a *API) importEvents(w http.ResponseWriter, r *http.Request) {
+	report := ImportReport{Mode: ImportAtomic, Rows: []ImportRow{}}
+	// fail answers with the report so far and why the import stopped
+	fail := func(err error) {
+		apiErr, ok := err.(*APIError)
+		switch {
+		case ok:
+		case err == errImportTooLarge:
+			apiErr = newError(http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("the import is larger than %d bytes", MaxImport))
+		case err == Store.ErrExists:
+			apiErr = newError(http.StatusConflict, CodeConflict, "an event was created with one of the IDs meanwhile, nothing was imported")
+		default:
+			Log(LogError, err.Error())
+			apiErr = newError(http.StatusInternalServerError, CodeInternal, "internal error")
+		}
+		report.Error = apiErr
+		writeJSON(w, apiErr.status, report)
+	}
+
+	values := r.URL.Query()
+	for param := range values {
+		if param != "mode" {
+			fail(newError(http.StatusBadRequest, CodeBadRequest, param+" is not a known parameter"))
+			return
+		}
+	}
+	switch mode := values.Get("mode"); mode {
+	case "", ImportAtomic:
+	case ImportBestEffort:
+		// Rows are stored as they are accepted
+		report.Mode, report.Committed = mode, true
+	default:
+		fail(newError(http.StatusBadRequest, CodeBadRequest, "mode must be atomic or best_effort"))
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for format, types := range mediaTypes {
+		for _, t := range types {
+			if mediaType == t {
+				report.Format = format
+			}
+		}
+	}
+	body := &importLimit{r: r.Body, n: MaxImport}
+	var rows rowReader
+	switch report.Format {
+	case FormatNDJSON:
+		rows = newNDJSONReader(body)
+	case FormatCSV:
+		cr, err := newCSVReader(body)
+		if err != nil {
+			fail(bodyError(err))
+			return
+		}
+		rows = cr
+	default:
+		fail(newError(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "send application/x-ndjson or text/csv"))
+		return
+	}
+
+	at := now()
+	seen := map[string]int{} // row of each ID so far
+	var batch []Store.Event
+	for n := 1; ; n++ {
+		e, rowErrs, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(bodyError(err))
+			return
+		}
+		row := ImportRow{Row: n, ID: e.ID}
+		if readable(rowErrs) {
+			var more []FieldError
+			e, more = prepareImport(e, at)
+			rowErrs = append(rowErrs, more...)
+			row.ID = e.ID
+			if first, ok := seen[e.ID]; ok {
+				rowErrs = append(rowErrs, FieldError{"ID", fmt.Sprintf("repeats row %d", first)})
+			} else if _, err := a.store.Get(e.ID); err == nil {
+				rowErrs = append(rowErrs, FieldError{"ID", "already exists"})
+			} else if err != Store.ErrNotFound {
+				fail(err)
+				return
+			} else {
+				seen[e.ID] = n
+			}
+		}
+		if len(rowErrs) == 0 && report.Mode == ImportBestEffort {
+			if err := a.commit(Feed.Created, e, a.store.Create); err == Store.ErrExists {
+				rowErrs = append(rowErrs, FieldError{"ID", "already exists"})
+			} else if err != nil {
+				fail(err)
+				return
+			}
+		}
+		report.Total++
+		if len(rowErrs) > 0 {
+			row.Status, row.Errors = "rejected", rowErrs
+			report.Rejected++
+		} else {
+			row.Status = "accepted"
+			report.Accepted++
+			if report.Mode == ImportAtomic {
+				batch = append(batch, e)
+			}
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	if report.Mode == ImportAtomic {
+		if report.Rejected > 0 {
+			err := newError(http.StatusUnprocessableEntity, CodeValidation,
+				fmt.Sprintf("%d of %d rows were rejected, nothing was imported", report.Rejected, report.Total))
+			fail(err)
+			return
+		}
+		if err := a.commitAll(batch); err != nil {
+			fail(err)
+			return
+		}
+		report.Committed = true
+	}
+	Logf(LogInfo, "%d of %d Events were imported", report.Accepted, report.Total)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// bodyError turns an error reading the body into a 400, unless it already
+// says what went wrong.
+func bodyError(err error) error {
+	if _, ok := err.(*APIError); ok || err == errImportTooLarge {
+		return err
+	}
+	return newError(http.StatusBadRequest, CodeBadRequest, "the body could not be read: "+err.Error())
+}
+
+// readable says whether a row with rowErrs was read, whatever its fields.
+func readable(rowErrs []FieldError) bool {
+	for _, fe := range rowErrs {
+		if fe.Field == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// commitAll is commit for a batch of new events: all are stored and
+// published, or none.
+func (a *API) commitAll(events []Store.Event) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	if err := a.store.CreateAll(events); err != nil {
+		return err
+	}
+	for i := range events {
+		a.index.Put(events[i])
+		a.feed.Publish(Feed.Created, events[i].ID, &events[i])
+	}
+	return nil
+}
+
+// exportEvents handles GET /events:export. It streams every event in ID
+// order as NDJSON, or CSV with ?format=csv, reading the store a batch at a
+// time, so it is not a snapshot: writes during the export may or may not
+// be in it.
+func (a *API) exportEvents(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	for param := range values {
+		if param != "format" {
+			writeError(w, newError(http.StatusBadRequest, CodeBadRequest, param+" is not a known parameter"))
+			return
+		}
+	}
+	format := values.Get("format")
+	if format == "" {
+		format = FormatNDJSON
+	}
+	if mediaTypes[format] == nil {
+		writeError(w, newError(http.StatusBadRequest, CodeBadRequest, "format must be ndjson or csv"))
+		return
+	}
+	page, err := a.store.Page("", exportBatch)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypes[format][0])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="events-%v.%v"`, now().Format("20060102T150405Z"), format))
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	var csvOut *csv.Writer
+	if format == FormatCSV {
+		csvOut = csv.NewWriter(w)
+		csvOut.Write(csvColumns)
+	}
+	enc := json.NewEncoder(w)
+	count := 0
+	for len(page) > 0 {
+		for _, e := range page {
+			if csvOut != nil {
+				csvOut.Write([]string{e.ID, e.Title, e.Description,
+					e.CreatedAt.Format(time.RFC3339Nano), e.UpdatedAt.Format(time.RFC3339Nano), strconv.FormatInt(e.Version, 10)})
+			} else if err := enc.Encode(e); err != nil {
+				return // the client left
+			}
+		}
+		count += len(page)
+		if csvOut != nil {
+			csvOut.Flush()
+			if csvOut.Error() != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if page, err = a.store.Page(page[len(page)-1].ID, exportBatch); err != nil {
+			// Too late for an error status, cut the response short so the
+			// client does not take it for the whole store
+			Logf(LogError, "Export stopped after %d Events: %v", count, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	Logf(LogInfo, "%d Events were exported as %v", count, format)
+}
+
+// <-----------------------
@@ -0,0 +1,197 @@
+package Api_test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"s_backend/api"
+	"s_backend/feed"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+const (
+	ndjsonType = "application/x-ndjson"
+	csvType    = "text/csv"
+)
+
+// importRows posts body to /events:import in mode and decodes the report.
+func importRows(t testing.TB, c ApiTest.Client, mode, contentType, body string) (ApiTest.Response, Api.ImportReport) {
+	t.Helper()
+	var report Api.ImportReport
+	resp := c.Do("POST", "/events:import?mode="+mode, body, "Content-Type", contentType)
+	if err := resp.Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return resp, report
+}
+
+// expectReport checks a report's counts and the status of each row.
+func expectReport(t testing.TB, report Api.ImportReport, committed bool, statuses ...string) {
+	t.Helper()
+	accepted := 0
+	for _, s := range statuses {
+		if s == "accepted" {
+			accepted++
+		}
+	}
+	if report.Committed != committed || report.Total != len(statuses) || report.Accepted != accepted || report.Rejected != len(statuses)-accepted || len(report.Rows) != len(statuses) {
+		t.Fatalf("report %+v, want %v rows, %d accepted, committed %v", report, len(statuses), accepted, committed)
+	}
+	for i, row := range report.Rows {
+		if row.Row != i+1 || row.Status != statuses[i] || (row.Status == "rejected") != (len(row.Errors) > 0) {
+			t.Fatalf("row %d is %+v, want %v", i+1, row, statuses[i])
+		}
+	}
+}
+
+// listAll returns every event through the API.
+func listAll(t testing.TB, c ApiTest.Client) []Store.Event {
+	t.Helper()
+	var all []Store.Event
+	path := fmt.Sprintf("/events?limit=%d", Api.MaxLimit)
+	for {
+		var page Api.EventPage
+		if err := c.Do("GET", path, "").Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page.Events...)
+		if page.NextCursor == "" {
+			return all
+		}
+		path = fmt.Sprintf("/events?limit=%d&cursor=%v", Api.MaxLimit, page.NextCursor)
+	}
+}
+
+// Imports check every row, store all or none in atomic mode and what
+// passes in best effort mode, and an export of either format imports into
+// another store as the same events.
+func TestBulk(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		f := Feed.New(Feed.DefaultSize)
+		c := ApiTest.StartWith(t, newStore(), Api.Config{Feed: f})
+
+		// IDs, times and versions from elsewhere are kept, the rest filled in
+		resp, report := importRows(t, c, Api.ImportAtomic, ndjsonType,
+			`{"ID":"legacy-1","Title":"kept","created_at":"2020-01-02T03:04:05Z","version":4}`+"\n\n"+
+				`{"Title":"  new  ","Description":"d"}`+"\n"+
+				`{"Title":"third"}`)
+		if resp.Status != http.StatusOK || report.Mode != Api.ImportAtomic || report.Format != Api.FormatNDJSON {
+			t.Fatalf("import: got %v %s", resp.Status, resp.Body)
+		}
+		expectReport(t, report, true, "accepted", "accepted", "accepted")
+		if f.Last() != 3 {
+			t.Fatalf("import: feed at %d, want a created change per row", f.Last())
+		}
+		resp = c.Do("GET", "/events/legacy-1", "")
+		var kept Store.Event
+		if err := resp.Decode(&kept); err != nil {
+			t.Fatal(err)
+		}
+		created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		if kept.Version != 4 || !kept.CreatedAt.Equal(created) || !kept.UpdatedAt.Equal(created) || resp.Header.Get("ETag") != `"4"` {
+			t.Fatalf("import kept %+v with ETag %v", kept, resp.Header.Get("ETag"))
+		}
+		var filled Store.Event
+		if err := c.Do("GET", "/events/"+report.Rows[1].ID, "").Decode(&filled); err != nil {
+			t.Fatal(err)
+		}
+		if len(filled.ID) != 26 || filled.Title != "new" || filled.Version != 1 || filled.CreatedAt.IsZero() {
+			t.Fatalf("import filled in %+v", filled)
+		}
+
+		// One good row among bad ones: atomic stores nothing, best effort
+		// the good one
+		mixed := strings.Join([]string{
+			`{"Title":"good"}`,
+			`{"Title":""}`,
+			`{"ID":"legacy-1","Title":"taken"}`,
+			`{"Title":`,
+			`{"Title":"unknown field","Colour":"red"}`,
+			`{"ID":"a/b","Title":"bad id"}`,
+			`{"ID":"twice","Title":"first"}`,
+			`{"ID":"twice","Title":"second"}`,
+			`{"ID":"search","Title":"shadowed by a route"}`,
+		}, "\n")
+		want := []string{"accepted", "rejected", "rejected", "rejected", "rejected", "rejected", "accepted", "rejected", "rejected"}
+		resp, report = importRows(t, c, Api.ImportAtomic, ndjsonType, mixed)
+		ApiTest.ExpectError(t, resp, 422, Api.CodeValidation)
+		expectReport(t, report, false, want...)
+		if !strings.Contains(fmt.Sprint(report.Rows[7].Errors), "repeats row 7") {
+			t.Fatalf("repeated ID: %+v", report.Rows[7])
+		}
+		if events := listAll(t, c); len(events) != 3 || f.Last() != 3 {
+			t.Fatalf("atomic with rejects stored %d events", len(events)-3)
+		}
+		if resp, report = importRows(t, c, Api.ImportBestEffort, ndjsonType, mixed); resp.Status != http.StatusOK {
+			t.Fatalf("best effort: got %v %s", resp.Status, resp.Body)
+		}
+		expectReport(t, report, true, want...)
+		if events := listAll(t, c); len(events) != 5 || f.Last() != 5 {
+			t.Fatalf("best effort: %d events, want 5", len(events))
+		}
+
+		// CSV, as a spreadsheet would save it
+		_, report = importRows(t, c, Api.ImportBestEffort, csvType+"; charset=utf-8",
+			"\ufefftitle,Description,version\r\n"+
+				"from csv,\"two\nlines, and \"\"quotes\"\"\",2\r\n"+
+				"short row\r\n"+
+				",no title,\r\n"+
+				"bad version,,two\r\n")
+		expectReport(t, report, true, "accepted", "rejected", "rejected", "rejected")
+		var fromCSV Store.Event
+		if err := c.Do("GET", "/events/"+report.Rows[0].ID, "").Decode(&fromCSV); err != nil || fromCSV.Description != "two\nlines, and \"quotes\"" || fromCSV.Version != 2 {
+			t.Fatalf("csv stored %+v (%v)", fromCSV, err)
+		}
+
+		for _, tc := range []struct {
+			name, query, contentType, body string
+			status                         int
+			code                           string
+		}{
+			{"unknown column", "", csvType, "Title,Colour\r\nx,red\r\n", 400, Api.CodeBadRequest},
+			{"no title column", "", csvType, "Description\r\nx\r\n", 400, Api.CodeBadRequest},
+			{"empty csv", "", csvType, "", 400, Api.CodeBadRequest},
+			{"plain text", "", "text/plain", "Title\r\nx\r\n", 415, Api.CodeUnsupportedMedia},
+			{"unknown mode", "?mode=some", ndjsonType, `{"Title":"x"}`, 400, Api.CodeBadRequest},
+			{"unknown parameter", "?dry_run=1", ndjsonType, `{"Title":"x"}`, 400, Api.CodeBadRequest},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				ApiTest.ExpectError(t, c.For(t).Do("POST", "/events:import"+tc.query, tc.body, "Content-Type", tc.contentType), tc.status, tc.code)
+			})
+		}
+		ApiTest.ExpectError(t, c.Do("GET", "/events:export?format=xml", ""), 400, Api.CodeBadRequest)
+
+		// Enough events for the export to take several batches, then each
+		// format moves them to an empty store unchanged
+		var many strings.Builder
+		for i := 0; i < 1200; i++ {
+			fmt.Fprintf(&many, "{\"Title\":\"bulk %d\",\"Description\":\"with, a comma\"}\n", i)
+		}
+		if _, report = importRows(t, c, Api.ImportAtomic, ndjsonType, many.String()); !report.Committed || report.Accepted != 1200 {
+			t.Fatalf("import 1200: %+v", report)
+		}
+		source := listAll(t, c)
+		for _, format := range []string{Api.FormatNDJSON, Api.FormatCSV} {
+			t.Run("export "+format, func(t *testing.T) {
+				resp := c.For(t).Do("GET", "/events:export?format="+format, "")
+				contentType := ndjsonType
+				if format == Api.FormatCSV {
+					contentType = csvType
+				}
+				if resp.Status != http.StatusOK || resp.Header.Get("Content-Type") != contentType || !strings.Contains(resp.Header.Get("Content-Disposition"), "."+format) {
+					t.Fatalf("got %v %v", resp.Status, resp.Header)
+				}
+				target := ApiTest.Start(t, newStore())
+				_, report := importRows(t, target, Api.ImportAtomic, contentType, string(resp.Body))
+				if copied := listAll(t, target); !report.Committed || !reflect.DeepEqual(copied, source) {
+					t.Fatalf("imported %d of %d events, or not as they were", len(copied), len(source))
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package Api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"s_backend/store"
+)
+
+// Error envelope
+// ----------------------->
+
+// ErrorBody is what every error response carries:
+//
+//	{"error": {"code": "validation_failed", "message": "...", "details": [...]}}
+type ErrorBody struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes what went wrong. Code is stable for clients to match
+// on, Message is for people.
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+	status  int
+}
+
+// FieldError is one field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error codes and the status each is sent with.
+const (
+	CodeBadRequest           = "bad_request"           // 400
+	CodeNotFound             = "not_found"             // 404
+	CodeMethodNotAllowed     = "method_not_allowed"    // 405
+	CodeConflict             = "conflict"              // 409
+	CodePreconditionFailed   = "precondition_failed"   // 412
+	CodeTooLarge             = "too_large"             // 413
+	CodeUnsupportedMedia     = "unsupported_media"     // 415
+	CodeValidation           = "validation_failed"     // 422
+	CodePreconditionRequired = "precondition_required" // 428
+	CodeInternal             = "internal"              // 500
+	CodeTimeout              = "timeout"               // 503
+)
+
+func newError(status int, code, message string) *APIError {
+	return &APIError{Code: code, Message: message, status: status}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// writeJSON sends v with status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends err in the envelope. Store errors map to 404, 409 and 412,
+// anything unknown is logged and hidden behind a 500.
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*APIError)
+	switch {
+	case ok:
+	case err == Store.ErrNotFound:
+		apiErr = newError(http.StatusNotFound, CodeNotFound, err.Error())
+	case err == Store.ErrExists:
+		apiErr = newError(http.StatusConflict, CodeConflict, err.Error())
+	case err == Store.ErrStale:
+		apiErr = newError(http.StatusPreconditionFailed, CodePreconditionFailed, err.Error())
+	default:
+		Log(LogError, err.Error())
+		apiErr = newError(http.StatusInternalServerError, CodeInternal, "internal error")
+	}
+	writeJSON(w, apiErr.status, ErrorBody{*apiErr})
+}
+
+// <-----------------------
@@ -0,0 +1,86 @@
+package Api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"s_backend/store"
+)
+
+// ETags
+// ----------------------->
+
+// eventTag is the strong ETag of e, its version.
+func eventTag(e Store.Event) string {
+	return `"` + strconv.FormatInt(e.Version, 10) + `"`
+}
+
+// matchTag reports whether tag is one of the comma separated tags in
+// header, or header is "*". Weak comparison ignores a W/ prefix, strong
+// comparison never matches a weak tag.
+func matchTag(header, tag string, weak bool) bool {
+	if weak {
+		tag = strings.TrimPrefix(tag, "W/")
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch holds a write to stored back unless its If-Match header
+// names the current version: 412 when it names another, 428 when it is
+// missing and the API requires it.
+func (a *API) checkIfMatch(r *http.Request, stored Store.Event) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if a.cfg.RequireIfMatch {
+			return newError(http.StatusPreconditionRequired, CodePreconditionRequired, "send If-Match with the ETag of the event")
+		}
+		return nil
+	}
+	if !matchTag(header, eventTag(stored), false) {
+		return newError(http.StatusPreconditionFailed, CodePreconditionFailed, "the event is now at ETag "+eventTag(stored))
+	}
+	return nil
+}
+
+// checkVersion treats a version in a PUT body like If-Match: sent back
+// unchanged it is fine, an older one is a 412.
+func checkVersion(e, stored Store.Event) error {
+	if e.Version != 0 && e.Version != stored.Version {
+		return newError(http.StatusPreconditionFailed, CodePreconditionFailed, "the event is now at version "+strconv.FormatInt(stored.Version, 10))
+	}
+	return nil
+}
+
+// writeTagged sends v with tag as its ETag, or a bare 304 when the
+// If-None-Match header of r already has it.
+func writeTagged(w http.ResponseWriter, r *http.Request, tag string, v interface{}) {
+	w.Header().Set("ETag", tag)
+	if header := r.Header.Get("If-None-Match"); header != "" && matchTag(header, tag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// bodyTag is a weak ETag for v from a hash of its JSON, for responses that
+// have no version of their own.
+func bodyTag(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// <-----------------------
@@ -0,0 +1,589 @@
+package Api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"s_backend/api"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// IDs are generated by the server, unique and ordered, and created events
+// can be read back.
+func TestCreate(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		c := ApiTest.Start(t, newStore())
+
+		var ids []string
+		for i := 0; i < 20; i++ {
+			resp := c.Do("POST", "/event", fmt.Sprintf(`{"Title":"event %d","Description":"d"}`, i))
+			var e Store.Event
+			if resp.Status != http.StatusCreated {
+				t.Fatalf("create: got %v %s, want 201", resp.Status, resp.Body)
+			}
+			if err := resp.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			if len(e.ID) != 26 {
+				t.Fatalf("create: ID %q is not a ULID", e.ID)
+			}
+			if len(ids) > 0 && e.ID <= ids[len(ids)-1] {
+				t.Fatalf("create: ID %v does not sort after %v", e.ID, ids[len(ids)-1])
+			}
+			if loc := resp.Header.Get("Location"); loc != "/events/"+e.ID {
+				t.Fatalf("create: Location %q", loc)
+			}
+			ids = append(ids, e.ID)
+		}
+
+		resp := c.Do("GET", "/events/"+ids[3], "")
+		var e Store.Event
+		if resp.Status != http.StatusOK || resp.Decode(&e) != nil || e.Title != "event 3" {
+			t.Fatalf("get: got %v %s", resp.Status, resp.Body)
+		}
+		resp = c.Do("POST", "/event", `{"Title":"  padded  "}`)
+		if resp.Decode(&e) != nil || e.Title != "padded" {
+			t.Fatalf("create: title not trimmed: %s", resp.Body)
+		}
+	})
+}
+
+// Bad requests and queries get 400, unknown events 404, store conflicts
+// 409 and invalid fields 422, all in the error envelope.
+func TestErrors(t *testing.T) {
+	long := strings.Repeat("x", Api.MaxTitle+1)
+	huge := strings.Repeat("x", Api.MaxBody)
+	cases := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+		field                    string
+	}{
+		{"malformed json", "POST", "/event", `{"Title":`, 400, Api.CodeBadRequest, ""},
+		{"wrong type", "POST", "/event", `{"Title":5}`, 400, Api.CodeBadRequest, ""},
+		{"unknown field", "POST", "/event", `{"Title":"a","Colour":"red"}`, 400, Api.CodeBadRequest, ""},
+		{"empty body", "POST", "/event", ``, 400, Api.CodeBadRequest, ""},
+		{"trailing data", "POST", "/event", `{"Title":"a"} {}`, 400, Api.CodeBadRequest, ""},
+		{"huge body", "POST", "/event", `{"Title":"a","Description":"` + huge + `"}`, 413, Api.CodeTooLarge, ""},
+		{"huge replacement", "PUT", "/events/nope", `{"Title":"` + huge + `"}`, 413, Api.CodeTooLarge, ""},
+		{"missing title", "POST", "/event", `{"Description":"d"}`, 422, Api.CodeValidation, "Title"},
+		{"blank title", "POST", "/event", `{"Title":"   "}`, 422, Api.CodeValidation, "Title"},
+		{"long title", "POST", "/event", `{"Title":"` + long + `"}`, 422, Api.CodeValidation, "Title"},
+		{"client id", "POST", "/event", `{"ID":"1","Title":"a"}`, 422, Api.CodeValidation, "ID"},
+		{"client created_at", "POST", "/event", `{"Title":"a","created_at":"2001-01-01T00:00:00Z"}`, 422, Api.CodeValidation, "created_at"},
+		{"bad limit", "GET", "/events?limit=0", ``, 400, Api.CodeBadRequest, "limit"},
+		{"big limit", "GET", fmt.Sprintf("/events?limit=%d", Api.MaxLimit+1), ``, 400, Api.CodeBadRequest, "limit"},
+		{"bad sort", "GET", "/events?sort=colour", ``, 400, Api.CodeBadRequest, "sort"},
+		{"bad time", "GET", "/events?created_after=yesterday", ``, 400, Api.CodeBadRequest, "created_after"},
+		{"bad cursor", "GET", "/events?cursor=nope", ``, 400, Api.CodeBadRequest, "cursor"},
+		{"unknown parameter", "GET", "/events?colour=red", ``, 400, Api.CodeBadRequest, "colour"},
+		{"unknown event", "GET", "/events/nope", ``, 404, Api.CodeNotFound, ""},
+		{"update unknown", "PATCH", "/events/nope", `{"Title":"a"}`, 404, Api.CodeNotFound, ""},
+		{"replace unknown", "PUT", "/events/nope", `{"Title":"a"}`, 404, Api.CodeNotFound, ""},
+		{"delete unknown", "DELETE", "/events/nope", ``, 404, Api.CodeNotFound, ""},
+		{"unknown endpoint", "GET", "/nowhere", ``, 404, Api.CodeNotFound, ""},
+		{"wrong method", "POST", "/events/x", `{}`, 405, Api.CodeMethodNotAllowed, ""},
+	}
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		c := ApiTest.Start(t, newStore())
+		for _, tc := range cases {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				resp := c.For(t).Do(tc.method, tc.path, tc.body)
+				ApiTest.ExpectError(t, resp, tc.status, tc.code)
+				if tc.field != "" {
+					ApiTest.ExpectField(t, resp, tc.field)
+				}
+			})
+		}
+
+		// The store refusing a create is a conflict.
+		t.Run("store conflict", func(t *testing.T) {
+			cc := ApiTest.Start(t, conflictStore{newStore()})
+			ApiTest.ExpectError(t, cc.Do("POST", "/event", `{"Title":"a"}`), 409, Api.CodeConflict)
+		})
+	})
+}
+
+// PATCH merges (RFC 7396), PUT replaces and DELETE answers 204, and
+// changing one event leaves every other one alone: updating used to
+// truncate the list after the updated event.
+func TestUpdate(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		c := ApiTest.Start(t, newStore())
+
+		var ids []string
+		var created Store.Event
+		for i := 0; i < 5; i++ {
+			resp := c.Do("POST", "/event", fmt.Sprintf(`{"Title":"event %d","Description":"about %d"}`, i, i))
+			var e Store.Event
+			if resp.Status != http.StatusCreated || resp.Decode(&e) != nil {
+				t.Fatalf("create: got %v %s", resp.Status, resp.Body)
+			}
+			if i == 1 {
+				created = e
+			}
+			ids = append(ids, e.ID)
+		}
+		mid := ids[1]
+		if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+			t.Fatalf("create: timestamps not set: %+v", created)
+		}
+
+		// get fetches one event and fails on anything but a 200.
+		get := func(id string) Store.Event {
+			t.Helper()
+			var e Store.Event
+			resp := c.Do("GET", "/events/"+id, "")
+			if resp.Status != http.StatusOK || resp.Decode(&e) != nil {
+				t.Fatalf("get %v: got %v %s", id, resp.Status, resp.Body)
+			}
+			return e
+		}
+		// others checks there are count events and every one but mid is as
+		// it was created.
+		others := func(step string, count int) {
+			t.Helper()
+			var page Api.EventPage
+			if err := c.Do("GET", "/events", "").Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Events) != count {
+				t.Fatalf("%v: %d events left, want %d", step, len(page.Events), count)
+			}
+			for i, id := range ids {
+				if id == mid {
+					continue
+				}
+				e := get(id)
+				if e.Title != fmt.Sprintf("event %d", i) || e.Description != fmt.Sprintf("about %d", i) {
+					t.Fatalf("%v: event %v changed to %+v", step, id, e)
+				}
+			}
+		}
+
+		steps := []struct {
+			name, method, body, contentType string
+			want                            Store.Event
+		}{
+			{"patch title", "PATCH", `{"Title":"renamed"}`, Api.MergePatchType, Store.Event{Title: "renamed", Description: "about 1"}},
+			{"patch description", "PATCH", `{"Description":"new"}`, "application/json", Store.Event{Title: "renamed", Description: "new"}},
+			{"patch empty", "PATCH", `{}`, Api.MergePatchType, Store.Event{Title: "renamed", Description: "new"}},
+			{"patch null", "PATCH", `{"Description":null}`, Api.MergePatchType, Store.Event{Title: "renamed"}},
+			{"patch same id", "PATCH", `{"ID":"` + mid + `","Description":"back"}`, Api.MergePatchType, Store.Event{Title: "renamed", Description: "back"}},
+			{"put", "PUT", `{"Title":"replaced","Description":"all new"}`, "application/json", Store.Event{Title: "replaced", Description: "all new"}},
+			{"put clears", "PUT", `{"Title":"bare"}`, "application/json", Store.Event{Title: "bare"}},
+		}
+		// same compares what a client sets, the ID and when the event was
+		// created, which no update may change.
+		same := func(e, want Store.Event) bool {
+			return e.ID == mid && e.Title == want.Title && e.Description == want.Description && e.CreatedAt.Equal(created.CreatedAt)
+		}
+		updated := created.UpdatedAt
+		for _, step := range steps {
+			resp := c.Do(step.method, "/events/"+mid, step.body, "Content-Type", step.contentType)
+			var e Store.Event
+			if resp.Status != http.StatusOK || resp.Decode(&e) != nil {
+				t.Fatalf("%v: got %v %s", step.name, resp.Status, resp.Body)
+			}
+			if !same(e, step.want) {
+				t.Fatalf("%v: answered %+v, want %+v", step.name, e, step.want)
+			}
+			if e.UpdatedAt.Before(updated) {
+				t.Fatalf("%v: updated_at went back from %v to %v", step.name, updated, e.UpdatedAt)
+			}
+			updated = e.UpdatedAt
+			if e = get(mid); !same(e, step.want) || !e.UpdatedAt.Equal(updated) {
+				t.Fatalf("%v: stored %+v, want %+v", step.name, e, step.want)
+			}
+			others(step.name, len(ids))
+		}
+
+		bad := []struct {
+			name, method, body, contentType string
+			status                          int
+			code                            string
+		}{
+			{"patch null title", "PATCH", `{"Title":null}`, Api.MergePatchType, 422, Api.CodeValidation},
+			{"patch id", "PATCH", `{"ID":"other"}`, Api.MergePatchType, 422, Api.CodeValidation},
+			{"patch unknown field", "PATCH", `{"Colour":"red"}`, Api.MergePatchType, 400, Api.CodeBadRequest},
+			{"patch array", "PATCH", `[]`, Api.MergePatchType, 400, Api.CodeBadRequest},
+			{"patch media type", "PATCH", `{"Title":"a"}`, "text/plain", 415, Api.CodeUnsupportedMedia},
+			{"put missing title", "PUT", `{"Description":"d"}`, "application/json", 422, Api.CodeValidation},
+			{"put id", "PUT", `{"ID":"other","Title":"a"}`, "application/json", 422, Api.CodeValidation},
+			{"patch created_at", "PATCH", `{"created_at":"2001-01-01T00:00:00Z"}`, Api.MergePatchType, 422, Api.CodeValidation},
+			{"patch null updated_at", "PATCH", `{"updated_at":null}`, Api.MergePatchType, 422, Api.CodeValidation},
+			{"put updated_at", "PUT", `{"Title":"a","updated_at":"2001-01-01T00:00:00Z"}`, "application/json", 422, Api.CodeValidation},
+		}
+		for _, tc := range bad {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				ApiTest.ExpectError(t, c.For(t).Do(tc.method, "/events/"+mid, tc.body, "Content-Type", tc.contentType), tc.status, tc.code)
+			})
+		}
+		if e := get(mid); e.Title != "bare" {
+			t.Fatalf("rejected updates changed the event to %+v", e)
+		}
+
+		resp := c.Do("DELETE", "/events/"+mid, "")
+		if resp.Status != http.StatusNoContent || len(resp.Body) != 0 {
+			t.Fatalf("delete: got %v %s, want 204", resp.Status, resp.Body)
+		}
+		ApiTest.ExpectError(t, c.Do("DELETE", "/events/"+mid, ""), 404, Api.CodeNotFound)
+		others("delete", len(ids)-1)
+	})
+}
+
+// GET /events pages with cursors and Link headers, filters by title and
+// time, sorts, and keeps its place when events before the cursor are
+// deleted.
+func TestList(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		c := ApiTest.Start(t, newStore())
+
+		titles := []string{"Zeta", "alpha", "Beta", "gamma", "Theta", "delta", "Epsilon"}
+		var events []Store.Event
+		for _, title := range titles {
+			resp := c.Do("POST", "/event", `{"Title":"`+title+`"}`)
+			var e Store.Event
+			if resp.Status != http.StatusCreated || resp.Decode(&e) != nil {
+				t.Fatalf("create: got %v %s", resp.Status, resp.Body)
+			}
+			events = append(events, e)
+		}
+		resp := c.Do("PATCH", "/events/"+events[0].ID, `{"Description":"touched"}`)
+		if resp.Status != http.StatusOK || resp.Decode(&events[0]) != nil {
+			t.Fatalf("patch: got %v %s", resp.Status, resp.Body)
+		}
+
+		// walk follows the next links from path and returns the titles
+		// seen and the size of each page.
+		walk := func(t *testing.T, path string) ([]string, []int) {
+			t.Helper()
+			var seen []string
+			var sizes []int
+			for path != "" {
+				resp := c.For(t).Do("GET", path, "")
+				var page Api.EventPage
+				if resp.Status != http.StatusOK || resp.Decode(&page) != nil {
+					t.Fatalf("list %v: got %v %s", path, resp.Status, resp.Body)
+				}
+				for _, e := range page.Events {
+					seen = append(seen, e.Title)
+				}
+				sizes = append(sizes, len(page.Events))
+				links := resp.Header.Get("Link")
+				if !strings.Contains(links, `rel="first"`) {
+					t.Fatalf("list %v: no first link in %q", path, links)
+				}
+				path = linkTo(links, "next")
+				if (path == "") != (page.NextCursor == "") || !strings.Contains(path, page.NextCursor) {
+					t.Fatalf("list: next link %q does not match next_cursor %q", path, page.NextCursor)
+				}
+				if len(sizes) > len(titles) {
+					t.Fatalf("list %v: pages never end", path)
+				}
+			}
+			return seen, sizes
+		}
+
+		cases := []struct {
+			name, path string
+			want       []string
+			sizes      []int
+		}{
+			{"all", "/events", titles, []int{7}},
+			{"pages", "/events?limit=3", titles, []int{3, 3, 1}},
+			{"exact pages", "/events?limit=7", titles, []int{7}},
+			{"by title", "/events?sort=title&limit=2", []string{"alpha", "Beta", "delta", "Epsilon", "gamma", "Theta", "Zeta"}, []int{2, 2, 2, 1}},
+			{"by title descending", "/events?sort=-title&limit=4", []string{"Zeta", "Theta", "gamma", "Epsilon", "delta", "Beta", "alpha"}, []int{4, 3}},
+			{"by id descending", "/events?sort=-id&limit=5", []string{"Epsilon", "delta", "Theta", "gamma", "Beta", "alpha", "Zeta"}, []int{5, 2}},
+			{"title filter", "/events?title=ET&limit=1", []string{"Zeta", "Beta", "Theta"}, []int{1, 1, 1}},
+			{"no match", "/events?title=omega", nil, []int{0}},
+			{"created range", "/events?created_after=" + stamp(events[2].CreatedAt) + "&created_before=" + stamp(events[5].CreatedAt), []string{"gamma", "Theta"}, []int{2}},
+			{"updated after", "/events?updated_after=" + stamp(events[6].UpdatedAt), []string{"Zeta"}, []int{1}},
+			{"latest update first", "/events?sort=-updated_at&limit=2", []string{"Zeta", "Epsilon", "delta", "Theta", "gamma", "Beta", "alpha"}, []int{2, 2, 2, 1}},
+		}
+		for _, tc := range cases {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				seen, sizes := walk(t, tc.path)
+				if strings.Join(seen, ",") != strings.Join(tc.want, ",") || fmt.Sprint(sizes) != fmt.Sprint(tc.sizes) {
+					t.Fatalf("got %v in pages %v, want %v in pages %v", seen, sizes, tc.want, tc.sizes)
+				}
+			})
+		}
+
+		// A cursor marks a place, not an offset: deleting events already
+		// seen does not skip any.
+		var page Api.EventPage
+		if err := c.Do("GET", "/events?limit=3", "").Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Events[:2] {
+			if resp := c.Do("DELETE", "/events/"+e.ID, ""); resp.Status != http.StatusNoContent {
+				t.Fatalf("delete: got %v %s", resp.Status, resp.Body)
+			}
+		}
+		seen, _ := walk(t, "/events?limit=3&cursor="+page.NextCursor)
+		if want := strings.Join(titles[3:], ","); strings.Join(seen, ",") != want {
+			t.Fatalf("after deleting: got %v, want %v", seen, want)
+		}
+
+		// A cursor only works for the query it came from.
+		ApiTest.ExpectError(t, c.Do("GET", "/events?sort=title&limit=3&cursor="+page.NextCursor, ""), 400, Api.CodeBadRequest)
+	})
+}
+
+// pagingStore counts the batches read and fails the test when the whole
+// store is loaded at once.
+type pagingStore struct {
+	Store.EventStore
+	t     testing.TB
+	pages int
+}
+
+func (s *pagingStore) List() ([]Store.Event, error) {
+	s.t.Error("the list was read whole")
+	return s.EventStore.List()
+}
+
+func (s *pagingStore) Page(after string, n int) ([]Store.Event, error) {
+	s.pages++
+	return s.EventStore.Page(after, n)
+}
+
+// Lists longer than a store batch page the same in every order, without
+// loading the store whole, and a page in ID order only reads the batches
+// it needs.
+func TestListBatches(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		const n = 1234
+		store := &pagingStore{EventStore: newStore(), t: t}
+		start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		var events []Store.Event
+		for i := 0; i < n; i++ {
+			at := start.Add(time.Duration(i) * time.Second)
+			events = append(events, Store.Event{ID: fmt.Sprintf("e%05d", i), Title: fmt.Sprintf("t%05d", (i*7)%n), CreatedAt: at, UpdatedAt: at, Version: 1})
+		}
+		if err := store.CreateAll(events); err != nil {
+			t.Fatal(err)
+		}
+		c := ApiTest.Start(t, store)
+
+		for _, tc := range []struct {
+			sort  string
+			first string
+			last  string
+		}{
+			{"id", "e00000", "e01233"},
+			{"-id", "e01233", "e00000"},
+			{"title", "t00000", fmt.Sprintf("t%05d", n-1)},
+			{"-created_at", "e01233", "e00000"},
+		} {
+			t.Run(tc.sort, func(t *testing.T) {
+				c := c.For(t)
+				var seen []Store.Event
+				path := fmt.Sprintf("/events?sort=%v&limit=%d", tc.sort, Api.MaxLimit)
+				for path != "" {
+					resp := c.Do("GET", path, "")
+					var page Api.EventPage
+					if err := resp.Decode(&page); err != nil {
+						t.Fatal(err)
+					}
+					seen = append(seen, page.Events...)
+					path = linkTo(resp.Header.Get("Link"), "next")
+				}
+				ids := map[string]bool{}
+				for _, e := range seen {
+					ids[e.ID] = true
+				}
+				if len(seen) != n || len(ids) != n {
+					t.Fatalf("got %d events, %d different, want %d", len(seen), len(ids), n)
+				}
+				first, last := seen[0], seen[n-1]
+				if tc.sort == "title" {
+					if first.Title != tc.first || last.Title != tc.last {
+						t.Fatalf("titles run from %v to %v", first.Title, last.Title)
+					}
+				} else if first.ID != tc.first || last.ID != tc.last {
+					t.Fatalf("IDs run from %v to %v", first.ID, last.ID)
+				}
+			})
+		}
+
+		t.Run("reads what it needs", func(t *testing.T) {
+			store.pages = 0
+			var page Api.EventPage
+			if err := c.For(t).Do("GET", "/events?limit=10", "").Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Events) != 10 || store.pages != 1 {
+				t.Fatalf("got %d events reading %d batches, want 10 from 1", len(page.Events), store.pages)
+			}
+		})
+	})
+}
+
+// GETs carry ETags and answer If-None-Match with 304, and writes holding
+// an old ETag or version get 412 instead of overwriting, also when clients
+// race, and 428 without If-Match when the API requires it.
+func TestETags(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		c := ApiTest.Start(t, newStore())
+
+		resp := c.Do("POST", "/event", `{"Title":"shared","Description":""}`)
+		var e Store.Event
+		if resp.Status != http.StatusCreated || resp.Decode(&e) != nil || e.Version != 1 || resp.Header.Get("ETag") != `"1"` {
+			t.Fatalf("create: got %v %v %s", resp.Status, resp.Header.Get("ETag"), resp.Body)
+		}
+		path := "/events/" + e.ID
+
+		steps := []struct {
+			name, method, path, body string
+			header                   []string
+			status                   int
+			etag                     string
+		}{
+			{"get", "GET", path, "", nil, 200, `"1"`},
+			{"get current", "GET", path, "", []string{"If-None-Match", `"1"`}, 304, `"1"`},
+			{"get current weak", "GET", path, "", []string{"If-None-Match", `"0", W/"1"`}, 304, `"1"`},
+			{"get any", "GET", path, "", []string{"If-None-Match", "*"}, 304, `"1"`},
+			{"get changed", "GET", path, "", []string{"If-None-Match", `"0"`}, 200, `"1"`},
+			{"patch current", "PATCH", path, `{"Description":"a"}`, []string{"If-Match", `"1"`}, 200, `"2"`},
+			{"patch stale", "PATCH", path, `{"Description":"b"}`, []string{"If-Match", `"1"`}, 412, ""},
+			{"put any", "PUT", path, `{"Title":"shared","Description":"c"}`, []string{"If-Match", "*"}, 200, `"3"`},
+			{"put weak", "PUT", path, `{"Title":"shared"}`, []string{"If-Match", `W/"3"`}, 412, ""},
+			{"put stale", "PUT", path, `{"Title":"shared"}`, []string{"If-Match", `"1", "2"`}, 412, ""},
+			{"put stale version", "PUT", path, `{"Title":"shared","version":2}`, nil, 412, ""},
+			{"patch stale version", "PATCH", path, `{"Description":"d","version":1}`, nil, 412, ""},
+			{"patch version", "PATCH", path, `{"Description":"","version":3}`, nil, 200, `"4"`},
+			{"put without", "PUT", path, `{"Title":"shared"}`, nil, 200, `"5"`},
+			{"delete stale", "DELETE", path, "", []string{"If-Match", `"4"`}, 412, ""},
+			{"get after refusals", "GET", path, "", nil, 200, `"5"`},
+		}
+		// The steps build on each other, so the first failure ends them.
+		for _, step := range steps {
+			resp := c.Do(step.method, step.path, step.body, step.header...)
+			if resp.Status != step.status {
+				t.Fatalf("%v: got %v %s, want %v", step.name, resp.Status, resp.Body, step.status)
+			}
+			if step.status == 412 {
+				if resp.ErrorCode() != Api.CodePreconditionFailed {
+					t.Fatalf("%v: got %s", step.name, resp.Body)
+				}
+				continue
+			}
+			if tag := resp.Header.Get("ETag"); tag != step.etag {
+				t.Fatalf("%v: ETag %v, want %v", step.name, tag, step.etag)
+			}
+			if step.status == 304 && len(resp.Body) != 0 {
+				t.Fatalf("%v: 304 with a body: %s", step.name, resp.Body)
+			}
+		}
+
+		// The list has a tag of its own that changes with any event.
+		listTag := c.Do("GET", "/events", "").Header.Get("ETag")
+		if resp := c.Do("GET", "/events", "", "If-None-Match", listTag); resp.Status != 304 {
+			t.Fatalf("list with its own tag: got %v, want 304", resp.Status)
+		}
+		c.Do("PATCH", path, `{"Description":"changed"}`)
+		if resp := c.Do("GET", "/events", "", "If-None-Match", listTag); resp.Status != 200 || resp.Header.Get("ETag") == listTag {
+			t.Fatalf("list after a change: got %v with tag %v, want 200 and a new tag", resp.Status, resp.Header.Get("ETag"))
+		}
+
+		// Writers appending to the description from what they read: with
+		// If-Match and retries on 412 no append is lost.
+		const writers, perWriter = 6, 4
+		c.Do("PUT", path, `{"Title":"shared"}`)
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < perWriter; {
+					resp, err := c.Send("GET", path, "")
+					if err != nil {
+						errs <- err
+						return
+					}
+					var cur Store.Event
+					if err := resp.Decode(&cur); err != nil {
+						errs <- err
+						return
+					}
+					body, _ := json.Marshal(map[string]string{"Description": cur.Description + "x"})
+					resp, err = c.Send("PATCH", path, string(body), "If-Match", resp.Header.Get("ETag"))
+					switch {
+					case err != nil:
+						errs <- err
+						return
+					case resp.Status == http.StatusOK:
+						i++
+					case resp.Status != http.StatusPreconditionFailed:
+						errs <- fmt.Errorf("racing patch: got %v %s", resp.Status, resp.Body)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+		if err := c.Do("GET", path, "").Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if len(e.Description) != writers*perWriter {
+			t.Fatalf("racing patches: %d of %d appends kept", len(e.Description), writers*perWriter)
+		}
+
+		// With RequireIfMatch a write has to say what it read.
+		t.Run("require if-match", func(t *testing.T) {
+			rc := ApiTest.StartWith(t, newStore(), Api.Config{RequireIfMatch: true})
+			if err := rc.Do("POST", "/event", `{"Title":"guarded"}`).Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			for _, method := range []string{"PATCH", "PUT", "DELETE"} {
+				ApiTest.ExpectError(t, rc.Do(method, "/events/"+e.ID, `{"Title":"guarded"}`), 428, Api.CodePreconditionRequired)
+			}
+			if resp := rc.Do("DELETE", "/events/"+e.ID, "", "If-Match", `"1"`); resp.Status != http.StatusNoContent {
+				t.Fatalf("delete with If-Match: got %v, want 204", resp.Status)
+			}
+		})
+	})
+}
+
+// linkTo returns the target of the link with rel in a Link header.
+func linkTo(header, rel string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(link), ";", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[1]) == `rel="`+rel+`"` {
+			return strings.Trim(parts[0], "<>")
+		}
+	}
+	return ""
+}
+
+// stamp formats t for a query string.
+func stamp(t time.Time) string {
+	return url.QueryEscape(t.Format(time.RFC3339Nano))
+}
+
+// conflictStore refuses every create as if the ID were taken.
+type conflictStore struct {
+	Store.EventStore
+}
+
+func (conflictStore) Create(Store.Event) error {
+	return Store.ErrExists
+}
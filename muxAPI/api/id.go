@@ -0,0 +1,72 @@
+package Api
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// IDs are ULIDs: 48 bits of milliseconds then 80 random bits, written in
+// Crockford base32. They sort by creation time, so stores that list by ID
+// list oldest first. Within one millisecond the random part is incremented
+// to keep that order.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	idMu       sync.Mutex
+	idLastMs   uint64
+	idLastRand [10]byte
+)
+
+// NewID returns a new ULID.
+func NewID() string {
+	idMu.Lock()
+	defer idMu.Unlock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= idLastMs {
+		ms = idLastMs
+		increment(&idLastRand)
+	} else {
+		if _, err := rand.Read(idLastRand[:]); err != nil {
+			panic(err)
+		}
+		idLastMs = ms
+	}
+
+	var raw [16]byte
+	for i := 0; i < 6; i++ {
+		raw[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(raw[6:], idLastRand[:])
+	return encodeULID(raw)
+}
+
+func increment(b *[10]byte) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
+
+// encodeULID writes 128 bits as 26 base32 digits, the first holding the
+// top 3 bits.
+func encodeULID(raw [16]byte) string {
+	out := make([]byte, 26)
+	var acc uint64
+	bits := 0
+	j := 25
+	for i := len(raw) - 1; i >= 0; i-- {
+		acc |= uint64(raw[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			out[j] = crockford[acc&31]
+			j--
+			acc >>= 5
+			bits -= 5
+		}
+	}
+	out[0] = crockford[acc&31]
+	return string(out)
+}
@@ -0,0 +1,254 @@
+package Api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"s_backend/store"
+)
+
+// Listing
+// ----------------------->
+
+// Page sizes for GET /events.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// EventPage is what GET /events answers. NextCursor is empty on the last
+// page.
+type EventPage struct {
+	Events     []Store.Event `json:"events"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// sortKeys are the fields GET /events can sort by and the key each orders
+// events with. Ties are broken by ID, so every order is total.
+var sortKeys = map[string]func(Store.Event) string{
+	"id":         func(Store.Event) string { return "" },
+	"title":      func(e Store.Event) string { return strings.ToLower(e.Title) },
+	"created_at": func(e Store.Event) string { return timeKey(e.CreatedAt) },
+	"updated_at": func(e Store.Event) string { return timeKey(e.UpdatedAt) },
+}
+
+// timeKey formats t with a fixed width so keys compare like the times.
+func timeKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// filterParams are the query parameters that narrow the list, each is part
+// of what a cursor is bound to.
+var filterParams = []string{"title", "created_after", "created_before", "updated_after", "updated_before"}
+
+// cursor marks the last event of a page. Query is the filters and sort it
+// was made for, so it cannot be replayed against a different list.
+type cursor struct {
+	Query string `json:"q"`
+	Key   string `json:"k"`
+	ID    string `json:"id"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// listQuery is a parsed GET /events query.
+type listQuery struct {
+	limit  int
+	title  string
+	after  map[string]time.Time // created_at or updated_at, exclusive
+	before map[string]time.Time
+	key    func(Store.Event) string
+	desc   bool
+	byID   bool // sorted by ID ascending, the order the store pages in
+	query  string
+	cursor *cursor
+}
+
+// parseListQuery reads the query of r. Unknown parameters and bad values
+// are a 400 naming the parameter.
+func parseListQuery(r *http.Request) (listQuery, error) {
+	values := r.URL.Query()
+	q := listQuery{limit: DefaultLimit, after: map[string]time.Time{}, before: map[string]time.Time{}}
+	var details []FieldError
+	bad := func(param, message string) {
+		details = append(details, FieldError{param, message})
+	}
+
+	canonical := url.Values{}
+	known := map[string]bool{"limit": true, "cursor": true, "sort": true}
+	for _, param := range filterParams {
+		known[param] = true
+	}
+	for param := range values {
+		if !known[param] {
+			bad(param, "is not a known parameter")
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			bad("limit", fmt.Sprintf("must be a number from 1 to %d", MaxLimit))
+		}
+		q.limit = n
+	}
+	if q.title = values.Get("title"); q.title != "" {
+		canonical.Set("title", q.title)
+	}
+	for _, param := range filterParams[1:] {
+		v := values.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			bad(param, "must be an RFC 3339 time, like 2024-05-01T12:00:00Z")
+			continue
+		}
+		canonical.Set(param, v)
+		if field := strings.TrimSuffix(param, "_after"); field != param {
+			q.after[field+"_at"] = t
+		} else {
+			q.before[strings.TrimSuffix(param, "_before")+"_at"] = t
+		}
+	}
+
+	field := values.Get("sort")
+	if field == "" {
+		field = "id"
+	}
+	canonical.Set("sort", field)
+	if strings.HasPrefix(field, "-") {
+		q.desc = true
+		field = field[1:]
+	}
+	q.byID = field == "id" && !q.desc
+	if q.key = sortKeys[field]; q.key == nil {
+		bad("sort", "must be id, title, created_at or updated_at, with a leading - for descending")
+	}
+	q.query = canonical.Encode()
+
+	if v := values.Get("cursor"); v != "" {
+		var c cursor
+		data, err := base64.RawURLEncoding.DecodeString(v)
+		switch {
+		case err != nil || json.Unmarshal(data, &c) != nil:
+			bad("cursor", "is not valid, use the next_cursor of a previous page")
+		case c.Query != q.query:
+			bad("cursor", "was made for different filters or sort, start again without it")
+		default:
+			q.cursor = &c
+		}
+	}
+
+	if len(details) > 0 {
+		err := newError(http.StatusBadRequest, CodeBadRequest, "the query is not valid")
+		err.Details = details
+		return q, err
+	}
+	return q, nil
+}
+
+// match reports whether e passes the filters of q.
+func (q listQuery) match(e Store.Event) bool {
+	if q.title != "" && !strings.Contains(strings.ToLower(e.Title), strings.ToLower(q.title)) {
+		return false
+	}
+	times := map[string]time.Time{"created_at": e.CreatedAt, "updated_at": e.UpdatedAt}
+	for field, t := range q.after {
+		if !times[field].After(t) {
+			return false
+		}
+	}
+	for field, t := range q.before {
+		if !times[field].Before(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// less orders events by key then ID, in the direction of q.
+func (q listQuery) less(key, id, otherKey, otherID string) bool {
+	if key != otherKey {
+		return (key < otherKey) != q.desc
+	}
+	if id == otherID {
+		return false
+	}
+	return (id < otherID) != q.desc
+}
+
+// page reads the store a batch at a time and cuts out the page after the
+// cursor. Only the first limit+1 matches are held, so a page costs the
+// same whatever the size of the store, and in ID order the walk starts at
+// the cursor and stops once the page is full.
+func (q listQuery) page(store Store.EventStore) (EventPage, error) {
+	less := func(a, b Store.Event) bool { return q.less(q.key(a), a.ID, q.key(b), b.ID) }
+	keep := q.limit + 1
+	var matched []Store.Event
+	trim := func() {
+		sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+		if len(matched) > keep {
+			matched = matched[:keep]
+		}
+	}
+
+	after := ""
+	if q.byID && q.cursor != nil {
+		after = q.cursor.ID
+	}
+	for {
+		batch, err := store.Page(after, exportBatch)
+		if err != nil {
+			return EventPage{}, err
+		}
+		for _, e := range batch {
+			if q.match(e) && (q.cursor == nil || q.less(q.cursor.Key, q.cursor.ID, q.key(e), e.ID)) {
+				matched = append(matched, e)
+			}
+		}
+		if len(matched) >= 2*keep {
+			trim()
+		}
+		if len(batch) == 0 || q.byID && len(matched) >= keep {
+			break
+		}
+		after = batch[len(batch)-1].ID
+	}
+	trim()
+
+	if len(matched) <= q.limit {
+		return EventPage{Events: matched}, nil
+	}
+	last := matched[q.limit-1]
+	return EventPage{
+		Events:     matched[:q.limit],
+		NextCursor: cursor{q.query, q.key(last), last.ID}.encode(),
+	}, nil
+}
+
+// pageLinks returns the Link header for a page of r: the first page and,
+// unless this is the last one, the next.
+func pageLinks(r *http.Request, next string) string {
+	values := r.URL.Query()
+	values.Del("cursor")
+	links := []string{fmt.Sprintf(`<%v?%v>; rel="first"`, r.URL.Path, values.Encode())}
+	if next != "" {
+		values.Set("cursor", next)
+		links = append(links, fmt.Sprintf(`<%v?%v>; rel="next"`, r.URL.Path, values.Encode()))
+	}
+	return strings.Join(links, ", ")
+}
+
+// <-----------------------
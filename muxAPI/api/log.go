@@ -0,0 +1,87 @@
+package Api
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Logging Structure
+// ----------------------->
+
+// Severities of a log line. LogRequests logs a request as INFO, or ERROR
+// when it got a 5xx; Timeout gives up with a WARNING.
+const (
+	LogInfo    = "INFO"
+	LogWarning = "WARNING"
+	LogError   = "ERROR"
+)
+
+// logEntry is one line queued by a handler or middleware.
+type logEntry struct {
+	time     time.Time
+	severity string
+	message  string
+}
+
+var logCh = make(chan logEntry, 50) // lines waiting for Logger
+var doneCh = make(chan struct{})    // closed by StopLogger
+var stoppedCh = make(chan struct{}) // closed once Logger has drained logCh
+var running int32                   // set while Logger is draining logCh
+
+// Logger prints the lines handlers and middleware queue, in order, until
+// StopLogger. main runs it on a goroutine of its own before serving.
+func Logger() {
+	atomic.StoreInt32(&running, 1)
+	defer close(stoppedCh)
+	for {
+		select {
+		case entry := <-logCh:
+			printEntry(entry)
+		case <-doneCh:
+			atomic.StoreInt32(&running, 0)
+			for {
+				select {
+				case entry := <-logCh:
+					printEntry(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// printEntry writes one line to stdout as "date : [SEVERITY] message".
+func printEntry(entry logEntry) {
+	fmt.Printf("%v : [%v] %v\n", entry.time.Format("2006-01-02"), entry.severity, entry.message)
+}
+
+// StopLogger ends Logger once it has printed what is still queued, so the
+// last requests before a shutdown are not lost.
+func StopLogger() {
+	close(doneCh)
+	<-stoppedCh
+}
+
+// Log queues a message for Logger. It is called on the request path, so
+// when nothing runs Logger, as in the api tests behind httptest, a message
+// that does not fit the queue is dropped instead of stalling the request.
+func Log(severity, message string) {
+	entry := logEntry{time.Now(), severity, message}
+	if atomic.LoadInt32(&running) == 1 {
+		logCh <- entry
+		return
+	}
+	select {
+	case logCh <- entry:
+	default:
+	}
+}
+
+// Logf is Log with formatting.
+func Logf(severity, format string, args ...interface{}) {
+	Log(severity, fmt.Sprintf(format, args...))
+}
+
+// <-----------------------
@@ -0,0 +1,361 @@
+package Api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Middleware
+// ----------------------->
+
+// NewRouter runs every request through RequestID, LogRequests, Recover and
+// CORS, in that order, and every route but streams through Timeout. Each
+// is a mux.MiddlewareFunc, so other routers can use them as well.
+
+// HeaderRequestID carries the ID of a request, both ways.
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestID is the longest request ID taken from a client.
+const maxRequestID = 128
+
+// Chain wraps h in middleware, the first outermost.
+func Chain(h http.Handler, middleware ...mux.MiddlewareFunc) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+type requestIDKey struct{}
+
+// RequestID gives each request an ID, in the response and the request
+// context. A client's own X-Request-ID is kept when it is sane.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = NewID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID allows short IDs of printable ASCII, so they are safe to
+// log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFrom returns the ID RequestID gave the request of ctx.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusWriter remembers the status and size of a response. It flushes,
+// so streams still work through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.size += int64(n)
+	return n, err
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// LogRequests logs a line per request once it is answered: method, path,
+// status, size, latency and request ID. Server errors are logged as such.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			severity := LogInfo
+			if status >= 500 {
+				severity = LogError
+			}
+			Logf(severity, "%v %v %d %dB %v id=%v from %v", r.Method, r.URL.RequestURI(), status, sw.size,
+				time.Since(start).Round(time.Microsecond), RequestIDFrom(r.Context()), r.RemoteAddr)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Recover turns a panic in a handler into a 500 and logs it with its
+// stack, instead of dropping the connection. http.ErrAbortHandler is let
+// through, it is how a handler asks for that.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			logPanic(r, p, debug.Stack())
+			// Too late for a status once the handler has written one
+			if sw.status == 0 {
+				writeError(sw, newError(http.StatusInternalServerError, CodeInternal, "internal error"))
+			}
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// logPanic logs a panic raised serving r, with the stack it came from.
+func logPanic(r *http.Request, p interface{}, stack []byte) {
+	Logf(LogError, "Panic serving %v %v id=%v: %v\n%s", r.Method, r.URL.Path, RequestIDFrom(r.Context()), p, stack)
+}
+
+// CORSConfig says which other origins browsers let call the API. With no
+// AllowedOrigins there are no CORS headers and browsers only allow the
+// same origin.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed, like "https://app.example",
+	// or "*" for any.
+	AllowedOrigins []string
+	// AllowedMethods defaults to every method the API serves.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed, defaults to those
+	// the API reads.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts can read, defaults
+	// to those the API sends.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight, 0 leaves it to
+	// them.
+	MaxAge time.Duration
+}
+
+// Defaults of CORSConfig.
+var (
+	corsMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	corsHeaders = []string{"Content-Type", "If-Match", "If-None-Match", "Last-Event-ID", HeaderRequestID}
+	corsExposed = []string{"ETag", "Link", "Location", HeaderRequestID}
+)
+
+// CORS answers preflight requests and adds CORS headers to requests from
+// allowed origins.
+func CORS(cfg CORSConfig) mux.MiddlewareFunc {
+	methods, headers, exposed := cfg.AllowedMethods, cfg.AllowedHeaders, cfg.ExposedHeaders
+	if methods == nil {
+		methods = corsMethods
+	}
+	if headers == nil {
+		headers = corsHeaders
+	}
+	if exposed == nil {
+		exposed = corsExposed
+	}
+	allowHeader := map[string]bool{}
+	for _, h := range headers {
+		allowHeader[strings.ToLower(h)] = true
+	}
+	anyOrigin := false
+	origins := map[string]bool{}
+	for _, o := range cfg.AllowedOrigins {
+		anyOrigin = anyOrigin || o == "*"
+		origins[o] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || len(origins) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !anyOrigin && !origins[origin] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if anyOrigin && !cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				// "*" does not work with credentials, so the origin is echoed
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || method == "" {
+				h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Preflight: allowed or not, it is answered here and browsers
+			// refuse what the headers leave out
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			var asked []string
+			for _, name := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				if name = strings.TrimSpace(name); name != "" && allowHeader[strings.ToLower(name)] {
+					asked = append(asked, name)
+				}
+			}
+			if len(asked) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(asked, ", "))
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// Timeout answers 503 when a handler takes longer than d, and cancels the
+// request context so it can stop. The response is held back until the
+// handler returns, so it cannot wrap streams. A panic goes on to Recover,
+// or is logged when it comes after the 503.
+func Timeout(d time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			tw := &timeoutWriter{header: http.Header{}}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					p := recover()
+					if p == nil {
+						return
+					}
+					tw.mu.Lock()
+					defer tw.mu.Unlock()
+					switch {
+					case !tw.timedOut:
+						panicked <- p
+					case p != http.ErrAbortHandler:
+						// The 503 is sent and Recover has returned, so
+						// nobody else will hear of it
+						logPanic(r, p, debug.Stack())
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+			select {
+			case p := <-panicked:
+				// Raised again here, where Recover can see it
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for k, v := range tw.header {
+					w.Header()[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				select {
+				case p := <-panicked:
+					// It panicked before the time was up
+					panic(p)
+				default:
+				}
+				tw.timedOut = true
+				Logf(LogWarning, "%v %v id=%v gave up after %v", r.Method, r.URL.Path, RequestIDFrom(r.Context()), d)
+				writeError(w, newError(http.StatusServiceUnavailable, CodeTimeout, fmt.Sprintf("the request took longer than %v", d)))
+			}
+		})
+	}
+}
+
+// timeoutWriter holds a response back for Timeout. Writes after the
+// timeout fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 && !tw.timedOut {
+		tw.status = status
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
+
+// <-----------------------
@@ -0,0 +1,125 @@
+package Api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"s_backend/api"
+	"s_backend/feed"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// trickStore misbehaves on purpose: getting "panic" panics, getting
+// "slow" takes a while and getting "late" panics after a while.
+type trickStore struct {
+	Store.EventStore
+	delay time.Duration
+}
+
+func (s trickStore) Get(id string) (Store.Event, error) {
+	switch id {
+	case "panic":
+		panic("trickStore was asked to panic")
+	case "slow":
+		time.Sleep(s.delay)
+	case "late":
+		time.Sleep(s.delay)
+		panic("trickStore panicked late")
+	}
+	return s.EventStore.Get(id)
+}
+
+// Every response gets a request ID, a panic is a 500 the server survives,
+// CORS lets the allowed origin in, preflights included, and slow requests
+// time out while streams stay open.
+func TestMiddleware(t *testing.T) {
+	const origin = "https://app.example"
+	timeout := 100 * time.Millisecond
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		c := ApiTest.StartWith(t, trickStore{newStore(), 3 * timeout}, Api.Config{
+			Feed:    Feed.New(Feed.DefaultSize),
+			CORS:    Api.CORSConfig{AllowedOrigins: []string{origin}, MaxAge: 10 * time.Minute},
+			Timeout: timeout,
+		})
+
+		t.Run("request id", func(t *testing.T) {
+			c := c.For(t)
+			if id := c.Do("GET", "/events", "").Header.Get(Api.HeaderRequestID); len(id) != 26 {
+				t.Fatalf("got %q, want a ULID", id)
+			}
+			// Kept when sane, made up otherwise
+			for _, tc := range []struct{ sent, want string }{
+				{"client-42", "client-42"},
+				{strings.Repeat("x", 200), ""},
+				{"has space", ""},
+			} {
+				got := c.Do("GET", "/events", "", Api.HeaderRequestID, tc.sent).Header.Get(Api.HeaderRequestID)
+				if tc.want != "" && got != tc.want || tc.want == "" && (got == tc.sent || len(got) != 26) {
+					t.Fatalf("sent %q, answered with %q", tc.sent, got)
+				}
+			}
+		})
+
+		t.Run("panic", func(t *testing.T) {
+			c := c.For(t)
+			resp := c.Do("GET", "/events/panic", "")
+			ApiTest.ExpectError(t, resp, 500, Api.CodeInternal)
+			if resp.Header.Get(Api.HeaderRequestID) == "" {
+				t.Fatal("answered without a request id")
+			}
+			if resp = c.Do("GET", "/events", ""); resp.Status != http.StatusOK {
+				t.Fatalf("after the panic: got %v %s", resp.Status, resp.Body)
+			}
+		})
+
+		t.Run("cors", func(t *testing.T) {
+			c := c.For(t)
+			// Errors included, so scripts can read them
+			for _, path := range []string{"/events", "/events/missing", "/nowhere"} {
+				resp := c.Do("GET", path, "", "Origin", origin)
+				exposed := resp.Header.Get("Access-Control-Expose-Headers")
+				if resp.Header.Get("Access-Control-Allow-Origin") != origin || !strings.Contains(resp.Header.Get("Vary"), "Origin") {
+					t.Fatalf("%v: headers %v", path, resp.Header)
+				}
+				for _, h := range []string{"ETag", "Link", "Location", Api.HeaderRequestID} {
+					if !strings.Contains(exposed, h) {
+						t.Fatalf("%v: %v not exposed in %q", path, h, exposed)
+					}
+				}
+			}
+			if got := c.Do("GET", "/events", "", "Origin", "https://evil.example").Header.Get("Access-Control-Allow-Origin"); got != "" {
+				t.Fatalf("other origin allowed as %q", got)
+			}
+			resp := c.Do("OPTIONS", "/events/anything", "", "Origin", origin,
+				"Access-Control-Request-Method", "PATCH", "Access-Control-Request-Headers", "if-match, content-type, x-evil")
+			if resp.Status != http.StatusNoContent || !strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), "PATCH") ||
+				resp.Header.Get("Access-Control-Allow-Headers") != "if-match, content-type" || resp.Header.Get("Access-Control-Max-Age") != "600" {
+				t.Fatalf("preflight: got %v %v", resp.Status, resp.Header)
+			}
+			ApiTest.ExpectError(t, c.Do("OPTIONS", "/events/anything", ""), 405, Api.CodeMethodNotAllowed)
+		})
+
+		t.Run("timeout", func(t *testing.T) {
+			c := c.For(t)
+			start := time.Now()
+			ApiTest.ExpectError(t, c.Do("GET", "/events/slow", ""), 503, Api.CodeTimeout)
+			if took := time.Since(start); took > 2*timeout {
+				t.Fatalf("answered after %v, the timeout is %v", took, timeout)
+			}
+			// A panic after the 503 leaves it standing and the server up
+			ApiTest.ExpectError(t, c.Do("GET", "/events/late", ""), 503, Api.CodeTimeout)
+			time.Sleep(3 * timeout)
+			if resp := c.Do("GET", "/events", ""); resp.Status != http.StatusOK {
+				t.Fatalf("after a late panic: got %v %s", resp.Status, resp.Body)
+			}
+			// Streams are left alone
+			s := c.Stream("/events/stream")
+			time.Sleep(3 * timeout)
+			c.Do("POST", "/event", `{"Title":"after the timeout"}`)
+			ApiTest.ExpectChanges(t, s, []string{Feed.Created}, []string{"after the timeout"})
+		})
+	})
+}
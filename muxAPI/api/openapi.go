@@ -0,0 +1,360 @@
+package Api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAPI
+// ----------------------->
+
+// The spec is built from the same routes NewRouter serves, with schemas
+// taken from the Go types by reflection, so it cannot drift from the code.
+
+// SpecVersion is the version of the API in the spec.
+const SpecVersion = "1.0.0"
+
+// Where the spec and Swagger UI are served. They are left out of the spec.
+const (
+	SpecPath = "/openapi.json"
+	DocsPath = "/docs"
+)
+
+// swaggerUI is where /docs loads Swagger UI from.
+const swaggerUI = "https://unpkg.com/swagger-ui-dist@5.17.14"
+
+// route is one endpoint: how it is served and how it is documented.
+type route struct {
+	method, path string
+	handler      http.HandlerFunc
+	doc          operation
+}
+
+// operation documents a route.
+type operation struct {
+	id, summary, description string
+	tag                      string
+	params                   []param
+	body                     *content // request body, nil for none
+	responses                []response
+	stream                   bool // long running or streamed, so no Timeout
+}
+
+// param is a path, query or header parameter.
+type param struct {
+	name, in, description string
+	schema                map[string]interface{}
+	required              bool
+}
+
+// content is a body: its media type and a value of the Go type it holds,
+// or a schema when it has no Go type.
+type content struct {
+	mediaType string
+	value     interface{}
+	schema    map[string]interface{}
+	also      []string // more media types with the same schema
+}
+
+// response is one status a route answers with. Errors use the envelope.
+type response struct {
+	status      int
+	description string
+	body        *content
+	headers     []string
+}
+
+// jsonBody is a JSON body holding values like v.
+func jsonBody(v interface{}) *content {
+	return &content{mediaType: "application/json", value: v}
+}
+
+// ok is a 200 with a JSON body like v.
+func ok(description string, v interface{}, headers ...string) response {
+	return response{http.StatusOK, description, jsonBody(v), headers}
+}
+
+// fails lists error statuses, each answered with the error envelope.
+func fails(statuses ...int) []response {
+	var list []response
+	for _, status := range statuses {
+		list = append(list, response{status, errorDocs[status], jsonBody(ErrorBody{}), nil})
+	}
+	return list
+}
+
+// errorDocs says when each error status is sent.
+var errorDocs = map[int]string{
+	http.StatusBadRequest:            "The body or query is malformed (`bad_request`).",
+	http.StatusNotFound:              "There is no such event (`not_found`).",
+	http.StatusConflict:              "The store already has that ID (`conflict`).",
+	http.StatusPreconditionFailed:    "If-Match or the version is not current (`precondition_failed`).",
+	http.StatusRequestEntityTooLarge: "The body is larger than allowed (`too_large`).",
+	http.StatusUnsupportedMediaType:  "The body is not in a format the route takes (`unsupported_media`).",
+	http.StatusUnprocessableEntity:   "A field is not valid, see `details` (`validation_failed`).",
+	http.StatusPreconditionRequired:  "If-Match is required and missing (`precondition_required`).",
+	http.StatusInternalServerError:   "The store failed (`internal`).",
+	http.StatusServiceUnavailable:    "The request took longer than the server allows (`timeout`).",
+}
+
+// headerDocs describes the response headers routes list.
+var headerDocs = map[string]string{
+	"ETag":                "Version of the event, or a hash of a list page.",
+	"Location":            "Path of the new resource.",
+	"Content-Disposition": "Suggests a file name to save the export as.",
+	"Link":                `Links to the first and next pages, with rel="first" and rel="next".`,
+}
+
+// pathParam is a required path parameter.
+func pathParam(name, description string) param {
+	return param{name, "path", description, stringSchema, true}
+}
+
+var stringSchema = map[string]interface{}{"type": "string"}
+
+// spec renders the OpenAPI 3 document for routes.
+func spec(routes []route) ([]byte, error) {
+	s := &schemas{defs: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range routes {
+		for _, m := range pathParams.FindAllStringSubmatch(rt.path, -1) {
+			if !hasParam(rt.doc, m[1]) {
+				return nil, fmt.Errorf("%v %v does not document {%v}", rt.method, rt.path, m[1])
+			}
+		}
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]interface{}{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = s.operation(rt.doc)
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "muxAPI events",
+			"version":     SpecVersion,
+			"description": "Events with server assigned IDs, optimistic concurrency through ETags, and a change feed over SSE and webhooks. Every error comes in the same envelope.",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": s.defs},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// serveSpec answers with the document for routes, built once.
+func serveSpec(routes []route) http.HandlerFunc {
+	doc, err := spec(routes)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+// serveDocs answers with Swagger UI showing the spec.
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>muxAPI docs</title>
+  <link rel="stylesheet" href="%[1]v/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%[1]v/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "%[2]v", dom_id: "#swagger-ui", deepLinking: true});
+  </script>
+</body>
+</html>
+`, swaggerUI, SpecPath)
+}
+
+// schemas collects the component schemas the operations refer to.
+type schemas struct {
+	defs map[string]interface{}
+}
+
+// pathParams finds the variables in a route path.
+var pathParams = regexp.MustCompile(`{(\w+)}`)
+
+func hasParam(op operation, name string) bool {
+	for _, p := range op.params {
+		if p.in == "path" && p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *schemas) operation(op operation) map[string]interface{} {
+	out := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+	}
+	if op.description != "" {
+		out["description"] = op.description
+	}
+	var params []interface{}
+	for _, p := range op.params {
+		out := map[string]interface{}{"name": p.name, "in": p.in, "schema": p.schema, "description": p.description}
+		if p.required {
+			out["required"] = true
+		}
+		params = append(params, out)
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	if op.body != nil {
+		out["requestBody"] = map[string]interface{}{"required": true, "content": s.content(op.body)}
+	}
+	responses := map[string]interface{}{}
+	for _, resp := range op.responses {
+		r := map[string]interface{}{"description": resp.description}
+		if resp.body != nil {
+			r["content"] = s.content(resp.body)
+		}
+		if len(resp.headers) > 0 {
+			headers := map[string]interface{}{}
+			for _, h := range resp.headers {
+				headers[h] = map[string]interface{}{"description": headerDocs[h], "schema": stringSchema}
+			}
+			r["headers"] = headers
+		}
+		responses[fmt.Sprint(resp.status)] = r
+	}
+	out["responses"] = responses
+	return out
+}
+
+func (s *schemas) content(c *content) map[string]interface{} {
+	schema := c.schema
+	if schema == nil {
+		schema = s.of(reflect.TypeOf(c.value))
+	}
+	out := map[string]interface{}{c.mediaType: map[string]interface{}{"schema": schema}}
+	for _, t := range c.also {
+		out[t] = out[c.mediaType]
+	}
+	return out
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// of returns the schema of t, adding structs to the components.
+func (s *schemas) of(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return s.of(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case t.Kind() == reflect.String:
+		return stringSchema
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, ok := s.defs[name]; !ok {
+			s.defs[name] = nil // refers to itself while it is built
+			s.defs[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// object is the schema of a struct: its exported fields under their JSON
+// names. Fields without omitempty are required.
+func (s *schemas) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := f.Name, ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				opts = parts[1]
+			}
+		}
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		prop := s.of(f.Type)
+		if doc := fieldDocs[t.Name()+"."+name]; doc != "" {
+			if _, isRef := prop["$ref"]; isRef {
+				prop = map[string]interface{}{"allOf": []interface{}{prop}, "description": doc}
+			} else {
+				described := map[string]interface{}{"description": doc}
+				for k, v := range prop {
+					described[k] = v
+				}
+				prop = described
+			}
+		}
+		props[name] = prop
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	out := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// fieldDocs describe schema fields, keyed by type and JSON name.
+var fieldDocs = map[string]string{
+	"Event.ID":                "ULID assigned by the server, events sort by it in creation order.",
+	"Event.Title":             fmt.Sprintf("Required, at most %d characters, trimmed.", MaxTitle),
+	"Event.Description":       fmt.Sprintf("At most %d characters.", MaxDescription),
+	"Event.created_at":        "Set by the server.",
+	"Event.updated_at":        "Set by the server on every write.",
+	"Event.version":           "Bumped on every write, the ETag of the event.",
+	"eventInput.Title":        fmt.Sprintf("Required, at most %d characters, trimmed.", MaxTitle),
+	"eventPatch.Title":        "Replaces the title, null is refused as the title is required.",
+	"eventPatch.Description":  "Replaces the description, null clears it.",
+	"eventPatch.version":      "When sent, has to be the current version, like If-Match.",
+	"EventPage.next_cursor":   "Pass as cursor for the next page, missing on the last.",
+	"APIError.code":           "Stable, for clients to match on.",
+	"APIError.message":        "For people.",
+	"Change.seq":              "Position in the feed.",
+	"Change.event":            "The event after the write, missing for deletes.",
+	"Webhook.secret":          "Signs deliveries, only returned when the webhook is added.",
+	"Webhook.types":           "Change types delivered, all when empty.",
+	"webhookRequest.secret":   "At least 16 characters, one is made up when missing.",
+	"webhookRequest.types":    "Any of created, updated and deleted, all when missing.",
+	"SearchResult.highlights": "Title and Description, when they matched, HTML escaped with the matching words in <mark> tags.",
+	"SearchResult.score":      "BM25 score, only comparable within one search.",
+	"ImportReport.committed":  "Whether the accepted rows are stored. In best_effort mode they are stored as they are read.",
+	"ImportReport.error":      "Why the import stopped, like the error envelope.",
+	"ImportRow.row":           "Events in the body counted from 1, leaving out the CSV header and blank lines.",
+	"ImportRow.status":        "accepted or rejected.",
+}
+
+// <-----------------------
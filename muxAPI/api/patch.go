@@ -0,0 +1,97 @@
+package Api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"s_backend/store"
+)
+
+// MergePatchType is the media type of JSON Merge Patch (RFC 7396).
+const MergePatchType = "application/merge-patch+json"
+
+// mergePatch applies patch to target as RFC 7396 describes: members set to
+// null are removed, objects are merged recursively and anything else
+// replaces what was there.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// patchEvent applies the merge patch in the body of r to e. Removing a
+// field resets it, and removing Title leaves the event invalid.
+func patchEvent(r *http.Request, e Store.Event) (Store.Event, error) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mt != MergePatchType && mt != "application/json") {
+			return e, newError(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "send the patch as "+MergePatchType)
+		}
+	}
+	var patch interface{}
+	if err := decodeJSON(r, &patch); err != nil {
+		return e, err
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return e, newError(http.StatusBadRequest, CodeBadRequest, "a merge patch for an event must be a JSON object")
+	}
+
+	doc, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return e, err
+	}
+	patched, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return e, err
+	}
+
+	var out Store.Event
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return e, newError(http.StatusBadRequest, CodeBadRequest, "invalid patch: "+err.Error())
+	}
+	// A version in the patch is a precondition like If-Match
+	if out.Version != e.Version {
+		return e, newError(http.StatusPreconditionFailed, CodePreconditionFailed, "the event is now at version "+strconv.FormatInt(e.Version, 10))
+	}
+
+	// The server owns ID and the timestamps, a patch may repeat them but
+	// not change or remove them
+	var details []FieldError
+	if out.ID != e.ID {
+		details = append(details, FieldError{"ID", "cannot be changed"})
+	}
+	if !out.CreatedAt.Equal(e.CreatedAt) {
+		details = append(details, FieldError{"created_at", "is set by the server, leave it out"})
+	}
+	if !out.UpdatedAt.Equal(e.UpdatedAt) {
+		details = append(details, FieldError{"updated_at", "is set by the server, leave it out"})
+	}
+	if len(details) > 0 {
+		err := newError(http.StatusUnprocessableEntity, CodeValidation, "the event is not valid")
+		err.Details = details
+		return e, err
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+package Api
+
+import (
+	"fmt"
+	"net/http"
+
+	"s_backend/feed"
+	"s_backend/store"
+)
+
+// Routes
+// ----------------------->
+
+// eventInput is the body of POST /event, for the spec.
+type eventInput struct {
+	Title       string `json:"Title"`
+	Description string `json:"Description,omitempty"`
+}
+
+// eventPatch is the body of PATCH /events/{id}, for the spec.
+type eventPatch struct {
+	Title       string `json:"Title,omitempty"`
+	Description string `json:"Description,omitempty"`
+	Version     int64  `json:"version,omitempty"`
+}
+
+var (
+	eventID   = pathParam("id", "ID of the event.")
+	webhookID = pathParam("id", "ID of the webhook.")
+	ifMatch   = param{"If-Match", "header", "ETag the client last saw, the write is refused with 412 when the event changed since.", stringSchema, false}
+	ifNone    = param{"If-None-Match", "header", "ETag the client has, answered with 304 when it is still current.", stringSchema, false}
+)
+
+// notModified is the 304 of a conditional GET.
+var notModified = response{http.StatusNotModified, "The client's copy, named in If-None-Match, is current.", nil, nil}
+
+// routes lists every endpoint NewRouter serves, with its documentation.
+func (a *API) routes() []route {
+	list := []route{
+		{"GET", "/", homeLink, operation{
+			id: "home", summary: "Check the API is up", tag: "meta",
+			responses: []response{{http.StatusOK, "A greeting.", &content{mediaType: "text/plain", schema: stringSchema}, nil}},
+		}},
+		{"POST", "/event", a.createEvent, operation{
+			id: "createEvent", summary: "Create an event", tag: "events",
+			description: "The server assigns the ID, timestamps and version, sending any of them is a 422.",
+			body:        jsonBody(eventInput{}),
+			responses: append([]response{{http.StatusCreated, "The event as stored.", jsonBody(Store.Event{}), []string{"Location", "ETag"}}},
+				fails(http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusInternalServerError)...),
+		}},
+		{"GET", "/events", a.getAllEvents, operation{
+			id: "listEvents", summary: "List events a page at a time", tag: "events",
+			description: "Pages are linked with next_cursor and the Link header. A cursor only works with the query it came from.",
+			params: []param{
+				{"limit", "query", fmt.Sprintf("Events per page, from 1 to %d.", MaxLimit), map[string]interface{}{"type": "integer", "minimum": 1, "maximum": MaxLimit, "default": DefaultLimit}, false},
+				{"cursor", "query", "next_cursor of the previous page.", stringSchema, false},
+				{"sort", "query", "Field to sort by, with a leading - for descending. Ties go by ID.", map[string]interface{}{"type": "string", "default": "id", "enum": []string{"id", "-id", "title", "-title", "created_at", "-created_at", "updated_at", "-updated_at"}}, false},
+				{"title", "query", "Only events whose title contains this, ignoring case.", stringSchema, false},
+				timeParam("created_after"), timeParam("created_before"),
+				timeParam("updated_after"), timeParam("updated_before"),
+				ifNone,
+			},
+			responses: append([]response{ok("One page of events.", EventPage{}, "Link", "ETag"), notModified},
+				fails(http.StatusBadRequest, http.StatusInternalServerError)...),
+		}},
+		{"POST", "/events:import", a.importEvents, operation{
+			id: "importEvents", summary: "Import events from NDJSON or CSV", tag: "events",
+			description: "One event per line as JSON, or per CSV record under a header naming the columns " +
+				"ID, Title, Description, created_at, updated_at and version. Only Title is required, IDs, times and versions are kept when given. " +
+				"Every row is checked like POST /event and the report says how each went.",
+			params: []param{
+				{"mode", "query", "atomic stores every row or none, best_effort stores the rows that pass.", map[string]interface{}{"type": "string", "default": ImportAtomic, "enum": []string{ImportAtomic, ImportBestEffort}}, false},
+			},
+			body:   &content{mediaType: mediaTypes[FormatNDJSON][0], schema: stringSchema, also: append(mediaTypes[FormatNDJSON][1:], mediaTypes[FormatCSV]...)},
+			stream: true,
+			responses: append([]response{
+				ok("The report, the import went through.", ImportReport{}),
+				{http.StatusUnprocessableEntity, "In atomic mode, rows were rejected and nothing was stored. The report has `error` like the envelope.", jsonBody(ImportReport{}), nil},
+			}, fails(http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError)...),
+		}},
+		{"GET", "/events:export", a.exportEvents, operation{
+			id: "exportEvents", summary: "Export every event as NDJSON or CSV", tag: "events",
+			description: "Streamed in ID order, a batch at a time, so writes during the export may or may not be in it. The output imports as is.",
+			params: []param{
+				{"format", "query", "ndjson, one event per line, or csv with a header.", map[string]interface{}{"type": "string", "default": FormatNDJSON, "enum": []string{FormatNDJSON, FormatCSV}}, false},
+			},
+			stream: true,
+			responses: append([]response{
+				{http.StatusOK, "Every event.", &content{mediaType: mediaTypes[FormatNDJSON][0], schema: stringSchema, also: mediaTypes[FormatCSV]}, []string{"Content-Disposition"}},
+			}, fails(http.StatusBadRequest, http.StatusInternalServerError)...),
+		}},
+		{"GET", "/events/stream", a.streamEvents, operation{
+			id: "streamEvents", summary: "Stream changes as server-sent events", tag: "changes",
+			description: "Each change is an event named created, updated or deleted whose data is a Change. " +
+				"After Last-Event-ID the stream first replays what the client missed, or sends a reset event when that is no longer kept.",
+			params: []param{
+				{"Last-Event-ID", "header", "id of the last change the client got.", stringSchema, false},
+				{"last_event_id", "query", "Same as Last-Event-ID, for clients that cannot set headers.", stringSchema, false},
+			},
+			stream:    true,
+			responses: []response{{http.StatusOK, "The stream, open until the client leaves.", &content{mediaType: "text/event-stream", value: Feed.Change{}}, nil}},
+		}},
+		{"GET", "/events/search", a.searchEvents, operation{
+			id: "searchEvents", summary: "Search event titles and descriptions", tag: "events",
+			description: "Matches events having any word of q, or another form of it, like launch for launches. " +
+				"Ranked with BM25, a word in the title counts twice. Highlights are HTML escaped with matches in <mark> tags.",
+			params: []param{
+				{"q", "query", "Words to search for.", stringSchema, true},
+				{"limit", "query", fmt.Sprintf("Results per page, from 1 to %d.", MaxSearchLimit), map[string]interface{}{"type": "integer", "minimum": 1, "maximum": MaxSearchLimit, "default": DefaultSearchLimit}, false},
+				{"offset", "query", "Results to skip, next_offset of the previous page.", map[string]interface{}{"type": "integer", "minimum": 0, "default": 0}, false},
+			},
+			responses: append([]response{ok("One page of results, best first.", SearchPage{})},
+				fails(http.StatusBadRequest, http.StatusInternalServerError)...),
+		}},
+		{"GET", "/events/{id}", a.getOneEvent, operation{
+			id: "getEvent", summary: "Get an event", tag: "events",
+			params:    []param{eventID, ifNone},
+			responses: append([]response{ok("The event.", Store.Event{}, "ETag"), notModified}, fails(http.StatusNotFound, http.StatusInternalServerError)...),
+		}},
+		{"PUT", "/events/{id}", a.replaceEvent, operation{
+			id: "replaceEvent", summary: "Replace an event", tag: "events",
+			description: "Fields left out are cleared. ID and timestamps may be sent back as they are.",
+			params:      []param{eventID, ifMatch},
+			body:        jsonBody(Store.Event{}),
+			responses: append([]response{ok("The event as stored.", Store.Event{}, "ETag")},
+				fails(http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusPreconditionRequired, http.StatusInternalServerError)...),
+		}},
+		{"PATCH", "/events/{id}", a.updateEvent, operation{
+			id: "updateEvent", summary: "Update an event with a JSON Merge Patch", tag: "events",
+			description: "Fields left out are kept and fields set to null are cleared (RFC 7396).",
+			params:      []param{eventID, ifMatch},
+			body:        &content{mediaType: MergePatchType, value: eventPatch{}},
+			responses: append([]response{ok("The event as stored.", Store.Event{}, "ETag")},
+				fails(http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, http.StatusPreconditionRequired, http.StatusInternalServerError)...),
+		}},
+		{"DELETE", "/events/{id}", a.deleteEvent, operation{
+			id: "deleteEvent", summary: "Delete an event", tag: "events",
+			params: []param{eventID, ifMatch},
+			responses: append([]response{{http.StatusNoContent, "The event is gone.", nil, nil}},
+				fails(http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired, http.StatusInternalServerError)...),
+		}},
+	}
+	if a.cfg.Webhooks == nil {
+		return list
+	}
+	return append(list,
+		route{"POST", "/webhooks", a.createWebhook, operation{
+			id: "createWebhook", summary: "Add a webhook", tag: "changes",
+			description: "Changes are POSTed to the URL as a Change, signed with the secret. The secret is only returned here.",
+			body:        jsonBody(webhookRequest{}),
+			responses: append([]response{{http.StatusCreated, "The webhook, with its secret.", jsonBody(Feed.Webhook{}), []string{"Location"}}},
+				fails(http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity)...),
+		}},
+		route{"GET", "/webhooks", a.getAllWebhooks, operation{
+			id: "listWebhooks", summary: "List webhooks", tag: "changes",
+			responses: []response{ok("Every webhook, without secrets.", []Feed.Webhook{})},
+		}},
+		route{"GET", "/webhooks/{id}", a.getOneWebhook, operation{
+			id: "getWebhook", summary: "Get a webhook and its delivery counts", tag: "changes",
+			params:    []param{webhookID},
+			responses: append([]response{ok("The webhook, without its secret.", Feed.Webhook{})}, fails(http.StatusNotFound)...),
+		}},
+		route{"DELETE", "/webhooks/{id}", a.deleteWebhook, operation{
+			id: "deleteWebhook", summary: "Remove a webhook", tag: "changes",
+			params:    []param{webhookID},
+			responses: append([]response{{http.StatusNoContent, "The webhook gets nothing more.", nil, nil}}, fails(http.StatusNotFound)...),
+		}},
+	)
+}
+
+// timeParam is an exclusive time filter of GET /events.
+func timeParam(name string) param {
+	return param{name, "query", "Exclusive bound, as an RFC 3339 time.", map[string]interface{}{"type": "string", "format": "date-time"}, false}
+}
+
+// <-----------------------
@@ -0,0 +1,127 @@
+package Api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"s_backend/search"
+	"s_backend/store"
+)
+
+// Search
+// ----------------------->
+
+// Page sizes for GET /events/search.
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// snippetLength is how much of a description a highlight shows, in
+// characters.
+const snippetLength = 160
+
+// SearchResult is an event matching a search. Highlights has the fields
+// that matched, HTML escaped, with the matching words in <mark> tags.
+type SearchResult struct {
+	Event      Store.Event       `json:"event"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchPage is what GET /events/search answers. NextOffset is missing on
+// the last page.
+type SearchPage struct {
+	Query      string         `json:"query"`
+	Total      int            `json:"total"`
+	Results    []SearchResult `json:"results"`
+	NextOffset int            `json:"next_offset,omitempty"`
+}
+
+// indexStore puts every event of store in a new index.
+func indexStore(store Store.EventStore) *Search.Index {
+	index := Search.New()
+	after := ""
+	for {
+		page, err := store.Page(after, exportBatch)
+		if err != nil {
+			Logf(LogError, "Search only has %d Events, reading the store failed: %v", index.Len(), err)
+			return index
+		}
+		if len(page) == 0 {
+			return index
+		}
+		for _, e := range page {
+			index.Put(e)
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// searchEvents handles GET /events/search?q=: the events whose title or
+// description has any word of q, or a form of it, ranked with BM25, where
+// a word in the title counts twice.
+func (a *API) searchEvents(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	var details []FieldError
+	for param := range values {
+		if param != "q" && param != "limit" && param != "offset" {
+			details = append(details, FieldError{param, "is not a known parameter"})
+		}
+	}
+	query := values.Get("q")
+	terms := Search.Terms(query)
+	if len(terms) == 0 {
+		details = append(details, FieldError{"q", "has no words to search for"})
+	}
+	limit, offset := DefaultSearchLimit, 0
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxSearchLimit {
+			details = append(details, FieldError{"limit", fmt.Sprintf("must be a number from 1 to %d", MaxSearchLimit)})
+		}
+		limit = n
+	}
+	if v := values.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			details = append(details, FieldError{"offset", "must be a number from 0"})
+		}
+		offset = n
+	}
+	if len(details) > 0 {
+		err := newError(http.StatusBadRequest, CodeBadRequest, "the search is not valid")
+		err.Details = details
+		writeError(w, err)
+		return
+	}
+
+	hits, total := a.index.Search(terms, offset, limit)
+	page := SearchPage{Query: query, Total: total, Results: []SearchResult{}}
+	for _, hit := range hits {
+		e, err := a.store.Get(hit.ID)
+		if err == Store.ErrNotFound {
+			continue // deleted since
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		highlights := map[string]string{}
+		if h := Search.Highlight(e.Title, terms, 0); h != "" {
+			highlights["Title"] = h
+		}
+		if h := Search.Highlight(e.Description, terms, snippetLength); h != "" {
+			highlights["Description"] = h
+		}
+		page.Results = append(page.Results, SearchResult{e, hit.Score, highlights})
+	}
+	if offset+len(hits) < total {
+		page.NextOffset = offset + len(hits)
+	}
+	Logf(LogInfo, "Search for %q found %d Events", query, total)
+	writeJSON(w, http.StatusOK, page)
+}
+
+// <-----------------------
@@ -0,0 +1,184 @@
+package Api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"s_backend/api"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// search runs GET /events/search with q and more query parameters.
+func search(t testing.TB, c ApiTest.Client, q string, more string) Api.SearchPage {
+	t.Helper()
+	var page Api.SearchPage
+	resp := c.Do("GET", "/events/search?q="+url.QueryEscape(q)+more, "")
+	if resp.Status != http.StatusOK {
+		t.Fatalf("search %q: got %v %s", q, resp.Status, resp.Body)
+	}
+	if err := resp.Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// titlesOf lists the titles of the results, in order.
+func titlesOf(page Api.SearchPage) []string {
+	titles := []string{}
+	for _, r := range page.Results {
+		titles = append(titles, r.Event.Title)
+	}
+	return titles
+}
+
+// /events/search finds events by any form of their words, ranks title
+// matches first, highlights safely, follows creates, updates, deletes and
+// imports, and indexes what the store held already.
+func TestSearch(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		store := newStore()
+		now := time.Now().UTC()
+		if err := store.Create(Store.Event{ID: "old", Title: "Rocket launch party", CreatedAt: now, UpdatedAt: now, Version: 1}); err != nil {
+			t.Fatal(err)
+		}
+		c := ApiTest.Start(t, store)
+
+		ids := map[string]string{}
+		for _, e := range []struct{ title, description string }{
+			{"Launch review", "Review the launch checklist"},
+			{"Team lunch", "We talk about launches and launching schedules"},
+			{"Quarterly planning", "Nothing to see"},
+			{"<b>launch</b> & more", ""},
+		} {
+			var created Store.Event
+			if err := c.Do("POST", "/event", fmt.Sprintf(`{"Title":%q,"Description":%q}`, e.title, e.description)).Decode(&created); err != nil {
+				t.Fatal(err)
+			}
+			ids[e.title] = created.ID
+		}
+
+		page := search(t, c, "Launched", "")
+		titles := titlesOf(page)
+		if page.Total != 4 || len(titles) != 4 || titles[0] != "Launch review" || titles[3] != "Team lunch" {
+			t.Fatalf("search launched: got %v of %d, want the title and description match first and the description only match last", titles, page.Total)
+		}
+		for i := 1; i < len(page.Results); i++ {
+			if page.Results[i].Score > page.Results[i-1].Score {
+				t.Fatalf("search launched: results are not best first: %+v", page.Results)
+			}
+		}
+		want := map[string]map[string]string{
+			"Launch review":        {"Title": "<mark>Launch</mark> review", "Description": "Review the <mark>launch</mark> checklist"},
+			"Team lunch":           {"Description": "We talk about <mark>launches</mark> and <mark>launching</mark> schedules"},
+			"<b>launch</b> & more": {"Title": "&lt;b&gt;<mark>launch</mark>&lt;/b&gt; &amp; more"},
+			"Rocket launch party":  {"Title": "Rocket <mark>launch</mark> party"},
+		}
+		for _, r := range page.Results {
+			if fmt.Sprint(r.Highlights) != fmt.Sprint(want[r.Event.Title]) {
+				t.Fatalf("highlights of %q: got %v, want %v", r.Event.Title, r.Highlights, want[r.Event.Title])
+			}
+		}
+
+		// Paging
+		var paged []string
+		for offset := 0; ; {
+			page := search(t, c, "launch", fmt.Sprintf("&limit=1&offset=%d", offset))
+			paged = append(paged, titlesOf(page)...)
+			if page.NextOffset == 0 {
+				break
+			}
+			offset = page.NextOffset
+		}
+		if strings.Join(paged, "|") != strings.Join(titles, "|") {
+			t.Fatalf("paged %v, want %v", paged, titles)
+		}
+
+		// Writes are searchable at once
+		for _, step := range []struct{ method, id, body string }{
+			{"PATCH", ids["Quarterly planning"], `{"Description":"We launch later"}`},
+			{"PUT", ids["Launch review"], `{"Title":"Retro","Description":"nothing"}`},
+			{"DELETE", ids["Team lunch"], ""},
+		} {
+			if resp := c.Do(step.method, "/events/"+step.id, step.body); resp.Status >= 300 {
+				t.Fatalf("%v %v: got %v %s", step.method, step.id, resp.Status, resp.Body)
+			}
+		}
+		if _, report := importRows(t, c, Api.ImportAtomic, ndjsonType, `{"Title":"Imported launch"}`); !report.Committed {
+			t.Fatalf("import: %+v", report)
+		}
+		got := strings.Join(titlesOf(search(t, c, "launch", "")), "|")
+		for _, title := range []string{"Quarterly planning", "Imported launch", "Rocket launch party"} {
+			if !strings.Contains(got, title) {
+				t.Fatalf("after writes: got %v, want %v", got, title)
+			}
+		}
+		for _, title := range []string{"Retro", "Launch review", "Team lunch"} {
+			if strings.Contains(got, title) {
+				t.Fatalf("after writes: got %v, want no %v", got, title)
+			}
+		}
+
+		// A long description is cut around the first match
+		long := strings.Repeat("filler words here ", 40) + "the needle is here " + strings.Repeat("more filler ", 40)
+		if resp := c.Do("POST", "/event", fmt.Sprintf(`{"Title":"haystack","Description":%q}`, long)); resp.Status != http.StatusCreated {
+			t.Fatalf("create haystack: got %v %s", resp.Status, resp.Body)
+		}
+		page = search(t, c, "needles", "")
+		if len(page.Results) != 1 {
+			t.Fatalf("search needles: got %v", titlesOf(page))
+		}
+		snippet := page.Results[0].Highlights["Description"]
+		if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") || !strings.Contains(snippet, "<mark>needle</mark>") || len([]rune(snippet)) > 200 {
+			t.Fatalf("snippet %q, want about 160 characters around the match", snippet)
+		}
+
+		// A matching word longer than the snippet is shown whole
+		word := strings.Repeat("z", 300)
+		if resp := c.Do("POST", "/event", fmt.Sprintf(`{"Title":"monolith","Description":"a %v word"}`, word)); resp.Status != http.StatusCreated {
+			t.Fatalf("create monolith: got %v %s", resp.Status, resp.Body)
+		}
+		page = search(t, c, word, "")
+		if len(page.Results) != 1 {
+			t.Fatalf("search long word: got %v", titlesOf(page))
+		}
+		if snippet := page.Results[0].Highlights["Description"]; !strings.Contains(snippet, "<mark>"+word+"</mark>") {
+			t.Fatalf("snippet %q, want the whole word marked", snippet)
+		}
+
+		for _, tc := range []struct{ name, query, field string }{
+			{"no query", "", "q"},
+			{"only stop words", "?q=the+and+a", "q"},
+			{"limit", "?q=launch&limit=0", "limit"},
+			{"offset", "?q=launch&offset=-1", "offset"},
+			{"unknown parameter", "?q=launch&sort=title", "sort"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				resp := c.For(t).Do("GET", "/events/search"+tc.query, "")
+				ApiTest.ExpectError(t, resp, 400, Api.CodeBadRequest)
+				ApiTest.ExpectField(t, resp, tc.field)
+			})
+		}
+
+		// Counts stay right with many events
+		var many strings.Builder
+		for i := 0; i < 3000; i++ {
+			word := "straw"
+			if i%3 == 0 {
+				word = "pins"
+			}
+			fmt.Fprintf(&many, "{\"Title\":\"bulk %d\",\"Description\":\"%v\"}\n", i, word)
+		}
+		if _, report := importRows(t, c, Api.ImportAtomic, ndjsonType, many.String()); !report.Committed {
+			t.Fatalf("import 3000: %+v", report.Rejected)
+		}
+		page = search(t, c, "pin", fmt.Sprintf("&limit=%d", Api.MaxSearchLimit))
+		if page.Total != 1000 || len(page.Results) != Api.MaxSearchLimit || page.NextOffset != Api.MaxSearchLimit {
+			t.Fatalf("search pin: %d results of %d, next at %d, want 100 of 1000", len(page.Results), page.Total, page.NextOffset)
+		}
+	})
+}
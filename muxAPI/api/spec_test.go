@@ -0,0 +1,250 @@
+package Api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"s_backend/api"
+	"s_backend/feed"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// specDoc is the part of an OpenAPI document the tests read.
+type specDoc struct {
+	OpenAPI    string                              `json:"openapi"`
+	Paths      map[string]map[string]specOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+type specOperation struct {
+	OperationID string `json:"operationId"`
+	Parameters  []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+var (
+	routeVars = regexp.MustCompile(`{(\w+)}`)
+	specRefs  = regexp.MustCompile(`"\$ref":\s*"#/components/schemas/([^"]+)"`)
+)
+
+// checkSpecCovers returns an error unless spec documents every route of
+// router, with its path parameters and at least one response, nothing
+// router does not serve and no schema that says nothing. The spec and docs
+// routes themselves are left out.
+func checkSpecCovers(router *mux.Router, spec []byte) error {
+	var doc specDoc
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return fmt.Errorf("spec: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return fmt.Errorf("spec: openapi is %q, want 3.x", doc.OpenAPI)
+	}
+
+	var missing []string
+	served := map[string]bool{}
+	ids := map[string]string{}
+	err := router.Walk(func(r *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := r.GetPathTemplate()
+		if err != nil || path == Api.SpecPath || path == Api.DocsPath {
+			return nil
+		}
+		methods, err := r.GetMethods()
+		if err != nil {
+			missing = append(missing, "any method on "+path)
+			return nil
+		}
+		for _, method := range methods {
+			name := method + " " + path
+			served[name] = true
+			op, ok := doc.Paths[path][strings.ToLower(method)]
+			if !ok {
+				missing = append(missing, name)
+				continue
+			}
+			if len(op.Responses) == 0 {
+				return fmt.Errorf("spec: %v has no responses", name)
+			}
+			if other, dup := ids[op.OperationID]; op.OperationID == "" || dup {
+				return fmt.Errorf("spec: %v has operationId %q, already used by %v", name, op.OperationID, other)
+			}
+			ids[op.OperationID] = name
+			for _, v := range routeVars.FindAllStringSubmatch(path, -1) {
+				documented := false
+				for _, p := range op.Parameters {
+					documented = documented || p.In == "path" && p.Name == v[1]
+				}
+				if !documented {
+					return fmt.Errorf("spec: %v does not document {%v}", name, v[1])
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("spec: routes missing: %v", strings.Join(missing, ", "))
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if name := strings.ToUpper(method) + " " + path; !served[name] {
+				return fmt.Errorf("spec: documents %v, which is not served", name)
+			}
+		}
+	}
+	for _, ref := range specRefs.FindAllSubmatch(spec, -1) {
+		if _, ok := doc.Components.Schemas[string(ref[1])]; !ok {
+			return fmt.Errorf("spec: refers to missing schema %s", ref[1])
+		}
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(spec, &tree); err != nil {
+		return fmt.Errorf("spec: %v", err)
+	}
+	var empty []string
+	findEmptySchemas(tree, "#", false, &empty)
+	if len(empty) > 0 {
+		sort.Strings(empty)
+		return fmt.Errorf("spec: empty schemas at %v", strings.Join(empty, ", "))
+	}
+	return nil
+}
+
+// schemaKeys are the keywords that say what a schema holds. A schema with
+// none of them, {} or only a description, matches anything.
+var schemaKeys = []string{"type", "$ref", "allOf", "oneOf", "anyOf", "enum", "not"}
+
+// findEmptySchemas walks v, appending the JSON pointer of every empty
+// schema to empty. isSchema tells whether v sits where a schema goes.
+func findEmptySchemas(v interface{}, at string, isSchema bool, empty *[]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if isSchema {
+			said := false
+			for _, k := range schemaKeys {
+				_, ok := v[k]
+				said = said || ok
+			}
+			if !said {
+				*empty = append(*empty, at)
+			}
+		}
+		for k, child := range v {
+			path := at + "/" + k
+			switch {
+			case k == "schema" || k == "items" || k == "additionalProperties" || k == "not":
+				findEmptySchemas(child, path, true, empty)
+			case k == "properties" && isSchema || k == "schemas" && strings.HasSuffix(at, "/components"):
+				if children, ok := child.(map[string]interface{}); ok {
+					for name, schema := range children {
+						findEmptySchemas(schema, path+"/"+name, true, empty)
+					}
+				}
+			case (k == "allOf" || k == "oneOf" || k == "anyOf") && isSchema:
+				if list, ok := child.([]interface{}); ok {
+					for i, schema := range list {
+						findEmptySchemas(schema, fmt.Sprintf("%v/%d", path, i), true, empty)
+					}
+				}
+			default:
+				findEmptySchemas(child, path, false, empty)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			findEmptySchemas(child, fmt.Sprintf("%v/%d", at, i), false, empty)
+		}
+	}
+}
+
+// object follows keys down doc to a JSON object.
+func object(doc map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, k := range keys {
+		doc = doc[k].(map[string]interface{})
+	}
+	return doc
+}
+
+// /openapi.json covers every route, webhooks included, without empty
+// schemas; a route left out of it or an empty schema is caught, and /docs
+// shows it.
+func TestSpec(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		hooks := Feed.NewWebhooks(Feed.New(Feed.DefaultSize))
+		t.Cleanup(hooks.Close)
+		store := newStore()
+		t.Cleanup(func() { store.Close() })
+		router := Api.NewRouter(store, Api.Config{Webhooks: hooks})
+
+		c := ApiTest.Start(t, newStore())
+		resp := c.Do("GET", Api.SpecPath, "")
+		if resp.Status != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("spec: got %v as %q", resp.Status, resp.Header.Get("Content-Type"))
+		}
+		if err := checkSpecCovers(router, resp.Body); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("empty schema", func(t *testing.T) {
+			for _, tc := range []struct {
+				name  string
+				at    string
+				empty func(doc map[string]interface{})
+			}{
+				{"component", "#/components/schemas/Loose", func(doc map[string]interface{}) {
+					object(doc, "components", "schemas")["Loose"] = map[string]interface{}{}
+				}},
+				{"property", "#/components/schemas/Event/properties/Loose", func(doc map[string]interface{}) {
+					object(doc, "components", "schemas", "Event", "properties")["Loose"] = map[string]interface{}{"description": "Anything."}
+				}},
+				{"items", "#/components/schemas/Event/properties/Tags/items", func(doc map[string]interface{}) {
+					object(doc, "components", "schemas", "Event", "properties")["Tags"] = map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+				}},
+			} {
+				var doc map[string]interface{}
+				if err := resp.Decode(&doc); err != nil {
+					t.Fatal(err)
+				}
+				tc.empty(doc)
+				spec, err := json.Marshal(doc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := checkSpecCovers(router, spec); err == nil || !strings.Contains(err.Error(), tc.at) {
+					t.Errorf("%v: got %v, want an error about %v", tc.name, err, tc.at)
+				}
+			}
+		})
+
+		t.Run("undocumented route", func(t *testing.T) {
+			router.HandleFunc("/events/{id}/copies", func(http.ResponseWriter, *http.Request) {}).Methods("POST")
+			if err := checkSpecCovers(router, resp.Body); err == nil || !strings.Contains(err.Error(), "POST /events/{id}/copies") {
+				t.Fatalf("got %v", err)
+			}
+		})
+
+		t.Run("docs", func(t *testing.T) {
+			resp := c.For(t).Do("GET", Api.DocsPath, "")
+			if resp.Status != http.StatusOK || !strings.Contains(string(resp.Body), `"`+Api.SpecPath+`"`) {
+				t.Fatalf("got %v %s", resp.Status, resp.Body)
+			}
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package Api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"s_backend/feed"
+)
+
+// Change stream
+// ----------------------->
+
+// streamHeartbeat is how often an idle stream gets a comment, so proxies
+// do not close it.
+var streamHeartbeat = 15 * time.Second
+
+// streamRetry is the reconnect delay, in milliseconds, sent to clients.
+const streamRetry = 3000
+
+// streamID is the SSE id of a change: the feed epoch and the sequence
+// number, so an id from before a restart is not taken for a new one.
+func streamID(f *Feed.Feed, seq uint64) string {
+	return f.Epoch() + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseStreamID returns the sequence number in id when id is from f.
+func parseStreamID(f *Feed.Feed, id string) (uint64, bool) {
+	epoch, seq := id, ""
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		epoch, seq = id[:i], id[i+1:]
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil && epoch == f.Epoch()
+}
+
+// writeSSE writes one server-sent event.
+func writeSSE(w http.ResponseWriter, id, event string, data interface{}) {
+	body, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(w, "id: %v\n", id)
+	}
+	fmt.Fprintf(w, "event: %v\ndata: %s\n\n", event, body)
+}
+
+// streamEvents sends every change as a server-sent event named after its
+// type. With a Last-Event-ID header, or last_event_id parameter, it first
+// replays what the client missed. When that is no longer in the log the
+// client gets a "reset" event and should reload the events.
+func (a *API) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errors.New("the connection cannot stream"))
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var backlog []Feed.Change
+	var sub *Feed.Subscription
+	resumed := true
+	switch seq, ok := parseStreamID(a.feed, lastID); {
+	case lastID == "":
+		sub = a.feed.Subscribe()
+	case ok:
+		backlog, sub, resumed = a.feed.Resume(seq)
+	default:
+		sub, resumed = a.feed.Subscribe(), false
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	if !resumed {
+		writeSSE(w, streamID(a.feed, sub.From), "reset", map[string]string{
+			"reason": "changes after " + lastID + " are no longer kept, reload the events",
+		})
+	}
+	for _, c := range backlog {
+		writeSSE(w, streamID(a.feed, c.Seq), c.Type, c)
+	}
+	flusher.Flush()
+	Logf(LogInfo, "Change stream opened for %v", r.RemoteAddr)
+	defer Logf(LogInfo, "Change stream closed for %v", r.RemoteAddr)
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case c, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, the client resumes on reconnect
+				return
+			}
+			writeSSE(w, streamID(a.feed, c.Seq), c.Type, c)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// <-----------------------
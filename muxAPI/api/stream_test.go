@@ -0,0 +1,79 @@
+package Api_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"s_backend/api"
+	"s_backend/feed"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// /events/stream sends creates, updates and deletes as they happen,
+// resumes after Last-Event-ID, and sends a reset when the client missed
+// more than the feed keeps.
+func TestStream(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		f := Feed.New(3)
+		c := ApiTest.StartWith(t, newStore(), Api.Config{Feed: f})
+
+		live := c.Stream("/events/stream")
+		var e Store.Event
+		if err := c.Do("POST", "/event", `{"Title":"streamed"}`).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		c.Do("PATCH", "/events/"+e.ID, `{"Title":"restreamed"}`)
+		c.Do("DELETE", "/events/"+e.ID, "")
+		seen := ApiTest.ExpectChanges(t, live, []string{Feed.Created, Feed.Updated, Feed.Deleted}, []string{"streamed", "restreamed", ""})
+		live.Close()
+
+		// Resuming replays what came after the given change, then carries
+		// on live. The parameter is for clients that cannot set headers.
+		after := seen[0].ID
+		for _, resume := range []struct {
+			name, param string
+			backlog     []string
+		}{
+			{"resume by header", "", []string{Feed.Updated, Feed.Deleted}},
+			{"resume by parameter", "last_event_id", nil},
+		} {
+			t.Run(resume.name, func(t *testing.T) {
+				c := c.For(t)
+				path, header := "/events/stream", []string{"Last-Event-ID", after}
+				if resume.param != "" {
+					path, header = path+"?"+resume.param+"="+after, nil
+				}
+				s := c.Stream(path, header...)
+				ApiTest.ExpectChanges(t, s, resume.backlog, []string{"restreamed", ""})
+				c.Do("POST", "/event", `{"Title":"`+resume.name+`"}`)
+				got := ApiTest.ExpectChanges(t, s, []string{Feed.Created}, []string{resume.name})
+				after = got[0].ID
+			})
+		}
+
+		// The feed keeps three changes and five happened: resuming after
+		// the first has lost the second. An id from another feed has lost
+		// all.
+		for _, lost := range []struct{ name, id string }{
+			{"resume too old", seen[0].ID},
+			{"resume from another feed", "0-1"},
+		} {
+			t.Run(lost.name, func(t *testing.T) {
+				c := c.For(t)
+				s := c.Stream("/events/stream", "Last-Event-ID", lost.id)
+				reset, err := s.Next(2 * time.Second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reset.Event != "reset" || !strings.HasSuffix(reset.ID, fmt.Sprintf("-%d", f.Last())) {
+					t.Fatalf("got %+v, want a reset at %v", reset, f.Last())
+				}
+				c.Do("POST", "/event", `{"Title":"after reset"}`)
+				ApiTest.ExpectChanges(t, s, []string{Feed.Created}, []string{"after reset"})
+			})
+		}
+	})
+}
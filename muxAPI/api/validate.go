@@ -0,0 +1,102 @@
+package Api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"s_backend/store"
+)
+
+// Field limits, in characters.
+const (
+	MaxTitle       = 100
+	MaxDescription = 2000
+)
+
+// MaxBody caps JSON request bodies, and each line of an NDJSON import, in
+// bytes.
+const MaxBody = 1 << 20
+
+// decodeJSON reads the body of r into v. Malformed JSON, unknown fields,
+// wrong types and trailing data are all a 400, a body over MaxBody a 413.
+func decodeJSON(r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBody+1))
+	if err != nil {
+		return newError(http.StatusBadRequest, CodeBadRequest, "could not read the body: "+err.Error())
+	}
+	if len(body) > MaxBody {
+		return newError(http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("body is larger than %d bytes", MaxBody))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return newError(http.StatusBadRequest, CodeBadRequest, "body is empty, send a JSON object")
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return newError(http.StatusBadRequest, CodeBadRequest, "invalid JSON: "+err.Error())
+	}
+	if dec.More() {
+		return newError(http.StatusBadRequest, CodeBadRequest, "invalid JSON: unexpected data after the object")
+	}
+	return nil
+}
+
+// validateEvent checks the fields a client sets. Title is trimmed in place.
+func validateEvent(e *Store.Event) error {
+	var details []FieldError
+	e.Title = strings.TrimSpace(e.Title)
+	if e.Title == "" {
+		details = append(details, FieldError{"Title", "is required"})
+	} else if n := utf8.RuneCountInString(e.Title); n > MaxTitle {
+		details = append(details, FieldError{"Title", fmt.Sprintf("is %d characters, at most %d allowed", n, MaxTitle)})
+	}
+	if n := utf8.RuneCountInString(e.Description); n > MaxDescription {
+		details = append(details, FieldError{"Description", fmt.Sprintf("is %d characters, at most %d allowed", n, MaxDescription)})
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	err := newError(http.StatusUnprocessableEntity, CodeValidation, "the event is not valid")
+	err.Details = details
+	return err
+}
+
+// checkServerFields rejects a body setting the fields the server owns to
+// anything but what stored holds. stored is the zero Event on create.
+func checkServerFields(e, stored Store.Event) error {
+	var details []FieldError
+	switch {
+	case e.ID == "" || e.ID == stored.ID:
+	case stored.ID == "":
+		details = append(details, FieldError{"ID", "is assigned by the server, leave it out"})
+	default:
+		details = append(details, FieldError{"ID", "cannot be changed"})
+	}
+	if e.Version != 0 && e.Version != stored.Version {
+		details = append(details, FieldError{"version", "is set by the server, leave it out"})
+	}
+	for _, f := range []struct {
+		name        string
+		got, stored time.Time
+	}{
+		{"created_at", e.CreatedAt, stored.CreatedAt},
+		{"updated_at", e.UpdatedAt, stored.UpdatedAt},
+	} {
+		if !f.got.IsZero() && !f.got.Equal(f.stored) {
+			details = append(details, FieldError{f.name, "is set by the server, leave it out"})
+		}
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	err := newError(http.StatusUnprocessableEntity, CodeValidation, "the event is not valid")
+	err.Details = details
+	return err
+}
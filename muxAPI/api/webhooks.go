@@ -0,0 +1,92 @@
+package Api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"s_backend/feed"
+)
+
+// Webhooks
+// ----------------------->
+
+// minSecret is the shortest secret a client may choose, in bytes.
+const minSecret = 16
+
+// webhookRequest is the body of POST /webhooks.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Types  []string `json:"types,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// validate checks the fields of req like validateEvent does for events.
+func (req webhookRequest) validate() error {
+	var details []FieldError
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		details = append(details, FieldError{"url", "must be an absolute http or https URL"})
+	}
+	for _, t := range req.Types {
+		known := false
+		for _, k := range Feed.Types {
+			known = known || t == k
+		}
+		if !known {
+			details = append(details, FieldError{"types", t + " is not one of created, updated or deleted"})
+		}
+	}
+	if req.Secret != "" && len(req.Secret) < minSecret {
+		details = append(details, FieldError{"secret", "must be at least 16 characters, or left out to get one"})
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	err := newError(http.StatusUnprocessableEntity, CodeValidation, "the webhook is not valid")
+	err.Details = details
+	return err
+}
+
+func (a *API) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, err)
+		return
+	}
+	hook := a.cfg.Webhooks.Add(Feed.Webhook{ID: NewID(), URL: req.URL, Types: req.Types, Secret: req.Secret})
+
+	// The secret is only ever sent back here
+	w.Header().Set("Location", "/webhooks/"+hook.ID)
+	writeJSON(w, http.StatusCreated, hook)
+	Logf(LogInfo, "Webhook # %v was added for %v", hook.ID, hook.URL)
+}
+
+func (a *API) getAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.cfg.Webhooks.List())
+}
+
+func (a *API) getOneWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := a.cfg.Webhooks.Get(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, newError(http.StatusNotFound, CodeNotFound, "webhook not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+func (a *API) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !a.cfg.Webhooks.Remove(id) {
+		writeError(w, newError(http.StatusNotFound, CodeNotFound, "webhook not found"))
+		return
+	}
+	Logf(LogInfo, "Webhook # %v was removed", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// <-----------------------
@@ -0,0 +1,147 @@
+package Api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"s_backend/api"
+	"s_backend/feed"
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// Webhooks are validated, get signed deliveries of the change types they
+// asked for, in order, retried with back-off on server errors but not
+// client errors, and stop once removed.
+func TestWebhooks(t *testing.T) {
+	ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+		f := Feed.New(Feed.DefaultSize)
+		hooks := Feed.NewWebhooks(f)
+		hooks.Attempts = 3
+		hooks.Backoff = 5 * time.Millisecond
+		hooks.MaxBackoff = 20 * time.Millisecond
+		c := ApiTest.StartWith(t, newStore(), Api.Config{Feed: f, Webhooks: hooks})
+		rv := ApiTest.NewReceiver(t)
+
+		for _, tc := range []struct{ name, body, field string }{
+			{"bad url", `{"url":"ftp://example.com/hook"}`, "url"},
+			{"relative url", `{"url":"/hook"}`, "url"},
+			{"unknown type", `{"url":"` + rv.URL + `","types":["moved"]}`, "types"},
+			{"short secret", `{"url":"` + rv.URL + `","secret":"short"}`, "secret"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				resp := c.For(t).Do("POST", "/webhooks", tc.body)
+				ApiTest.ExpectError(t, resp, 422, Api.CodeValidation)
+				ApiTest.ExpectField(t, resp, tc.field)
+			})
+		}
+
+		resp := c.Do("POST", "/webhooks", `{"url":"`+rv.URL+`","types":["created","deleted"]}`)
+		var hook Feed.Webhook
+		if resp.Status != http.StatusCreated || resp.Decode(&hook) != nil || len(hook.Secret) != 64 || resp.Header.Get("Location") != "/webhooks/"+hook.ID {
+			t.Fatalf("add webhook: got %v %s", resp.Status, resp.Body)
+		}
+		var listed []Feed.Webhook
+		if resp = c.Do("GET", "/webhooks", ""); resp.Decode(&listed) != nil || len(listed) != 1 || listed[0].Secret != "" {
+			t.Fatalf("list webhooks: got %s, want one without its secret", resp.Body)
+		}
+
+		// Two server errors before the create gets through, an update it
+		// did not ask for, then the delete.
+		rv.Fail(500, 503)
+		var e Store.Event
+		if err := c.Do("POST", "/event", `{"Title":"hooked"}`).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		c.Do("PATCH", "/events/"+e.ID, `{"Title":"not sent"}`)
+		c.Do("DELETE", "/events/"+e.ID, "")
+		got := rv.Wait(t, 4)
+		for i, want := range []struct {
+			typ    string
+			status int
+		}{{Feed.Created, 500}, {Feed.Created, 503}, {Feed.Created, 200}, {Feed.Deleted, 200}} {
+			d := got[i]
+			var c Feed.Change
+			if err := (ApiTest.Response{Body: d.Body}).Decode(&c); err != nil {
+				t.Fatal(err)
+			}
+			if c.Type != want.typ || c.EventID != e.ID || d.Header.Get(Feed.HeaderEvent) != want.typ || d.Status != want.status {
+				t.Fatalf("delivery %d: %v %v answered %v, want %v answered %v", i, c.Type, c.EventID, d.Status, want.typ, want.status)
+			}
+			if d.Header.Get(Feed.HeaderID) != hook.ID {
+				t.Fatalf("delivery %d: for webhook %q", i, d.Header.Get(Feed.HeaderID))
+			}
+			timestamp, signature := d.Header.Get(Feed.HeaderTimestamp), d.Header.Get(Feed.HeaderSignature)
+			if !Feed.Verify(hook.Secret, timestamp, d.Body, signature) {
+				t.Fatalf("delivery %d: signature %q does not verify", i, signature)
+			}
+			if Feed.Verify(hook.Secret, timestamp, append(d.Body, ' '), signature) {
+				t.Fatalf("delivery %d: signature verifies a changed body", i)
+			}
+		}
+		if got[0].Header.Get(Feed.HeaderDelivery) != got[2].Header.Get(Feed.HeaderDelivery) || got[2].Header.Get(Feed.HeaderDelivery) == got[3].Header.Get(Feed.HeaderDelivery) {
+			t.Fatalf("retries should share a delivery id and changes should not")
+		}
+
+		// A client error is not retried, running out of attempts gives up.
+		rv.Fail(400, 500, 500, 500)
+		for _, title := range []string{"refused", "failing"} {
+			c.Do("POST", "/event", `{"Title":"`+title+`"}`)
+		}
+		rv.Wait(t, 8)
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			resp = c.Do("GET", "/webhooks/"+hook.ID, "")
+			var counted Feed.Webhook
+			if err := resp.Decode(&counted); err != nil {
+				t.Fatal(err)
+			}
+			if counted.Delivered == 2 && counted.Failed == 2 && counted.Secret == "" && counted.LastError != "" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("webhook %s, want 2 delivered and 2 failed and no secret", resp.Body)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		// Removed, it gets nothing more.
+		if resp = c.Do("DELETE", "/webhooks/"+hook.ID, ""); resp.Status != http.StatusNoContent {
+			t.Fatalf("remove webhook: got %v %s", resp.Status, resp.Body)
+		}
+		ApiTest.ExpectError(t, c.Do("DELETE", "/webhooks/"+hook.ID, ""), 404, Api.CodeNotFound)
+		c.Do("POST", "/event", `{"Title":"unheard"}`)
+
+		// A webhook for everything gets a burst in order, even when it
+		// falls behind the feed and has to catch up from its log.
+		all := ApiTest.NewReceiver(t)
+		if resp = c.Do("POST", "/webhooks", `{"url":"`+all.URL+`","secret":"0123456789abcdef"}`); resp.Status != http.StatusCreated {
+			t.Fatalf("add webhook: got %v %s", resp.Status, resp.Body)
+		}
+		const burst = 150
+		for i := 0; i < burst; i++ {
+			c.Do("POST", "/event", fmt.Sprintf(`{"Title":"burst %d"}`, i))
+		}
+		got = all.Wait(t, burst)
+		for i, d := range got {
+			var ch Feed.Change
+			if err := (ApiTest.Response{Body: d.Body}).Decode(&ch); err != nil {
+				t.Fatal(err)
+			}
+			if ch.Event == nil || ch.Event.Title != fmt.Sprintf("burst %d", i) {
+				t.Fatalf("burst delivery %d is %s", i, d.Body)
+			}
+			if !Feed.Verify("0123456789abcdef", d.Header.Get(Feed.HeaderTimestamp), d.Body, d.Header.Get(Feed.HeaderSignature)) {
+				t.Fatalf("burst delivery %d: signature does not verify with the chosen secret", i)
+			}
+		}
+		if len(got) > burst {
+			t.Fatalf("burst: %d deliveries for %d changes", len(got), burst)
+		}
+		if got := rv.Wait(t, 0); len(got) != 8 {
+			t.Fatalf("removed webhook got %d requests, want 8", len(got))
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package Feed
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"s_backend/store"
+)
+
+// Change types.
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+// Types lists every change type.
+var Types = []string{Created, Updated, Deleted}
+
+// Change is one write to an event. Event is the event after the write and
+// is missing for deletes.
+type Change struct {
+	Seq     uint64       `json:"seq"`
+	Type    string       `json:"type"`
+	EventID string       `json:"event_id"`
+	Event   *Store.Event `json:"event,omitempty"`
+	Time    time.Time    `json:"time"`
+}
+
+// DefaultSize is how many changes a Feed keeps when asked for none.
+const DefaultSize = 1000
+
+// subscriberBuffer is how far a subscriber may fall behind before it is
+// dropped and has to resume from the log.
+const subscriberBuffer = 64
+
+// Feed is a bounded, in-memory log of changes that subscribers follow.
+// Sequence numbers start again with every Feed, Epoch tells them apart.
+type Feed struct {
+	epoch string
+	size  int
+
+	mu   sync.Mutex
+	seq  uint64
+	log  []Change // oldest first, at most size
+	subs map[*Subscription]struct{}
+}
+
+// New returns an empty Feed that keeps the last size changes.
+func New(size int) *Feed {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Feed{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:  size,
+		subs:  map[*Subscription]struct{}{},
+	}
+}
+
+// Epoch names this Feed, so a sequence number from an earlier one is not
+// mistaken for one of its own.
+func (f *Feed) Epoch() string {
+	return f.epoch
+}
+
+// Publish records a change and hands it to every subscriber. A subscriber
+// whose buffer is full is dropped: its channel is closed and it has to
+// resume from the log.
+func (f *Feed) Publish(typ, eventID string, e *Store.Event) Change {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	c := Change{Seq: f.seq, Type: typ, EventID: eventID, Event: e, Time: time.Now().UTC()}
+	f.log = append(f.log, c)
+	if len(f.log) > f.size {
+		f.log = append(f.log[:0:0], f.log[len(f.log)-f.size:]...)
+	}
+	for sub := range f.subs {
+		select {
+		case sub.ch <- c:
+		default:
+			delete(f.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return c
+}
+
+// Subscription receives the changes after From on C until it is closed or
+// dropped, which closes C.
+type Subscription struct {
+	C    <-chan Change
+	From uint64
+	ch   chan Change
+	feed *Feed
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	if _, ok := s.feed.subs[s]; ok {
+		delete(s.feed.subs, s)
+		close(s.ch)
+	}
+}
+
+// Subscribe follows changes from now on.
+func (f *Feed) Subscribe() *Subscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscribe()
+}
+
+// Resume returns the changes after seq still in the log and a subscription
+// to the ones that follow, with nothing missed in between. ok is false
+// when changes after seq have already left the log or seq is not from this
+// Feed; the subscription then starts from now.
+func (f *Feed) Resume(seq uint64) (backlog []Change, sub *Subscription, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub = f.subscribe()
+	if seq > f.seq {
+		return nil, sub, false
+	}
+	if seq < f.seq && f.log[0].Seq > seq+1 {
+		return nil, sub, false
+	}
+	for _, c := range f.log {
+		if c.Seq > seq {
+			backlog = append(backlog, c)
+		}
+	}
+	return backlog, sub, true
+}
+
+// Last returns the sequence number of the latest change, 0 before any.
+func (f *Feed) Last() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+func (f *Feed) subscribe() *Subscription {
+	ch := make(chan Change, subscriberBuffer)
+	sub := &Subscription{C: ch, From: f.seq, ch: ch, feed: f}
+	f.subs[sub] = struct{}{}
+	return sub
+}
@@ -0,0 +1,326 @@
+package Feed
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Webhook delivery headers. The signature covers the timestamp and the
+// body, see Sign.
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Webhook is a subscription to changes, POSTed as JSON to URL. Types
+// limits which changes are sent, empty means all. Secret signs every
+// delivery and is only shown when the webhook is added.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Types     []string  `json:"types,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Delivered int64     `json:"delivered"`
+	Failed    int64     `json:"failed"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Sign returns the signature of a delivery: "sha256=" and the hex HMAC of
+// the timestamp, a dot and the body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, timestamp+".")
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery in constant time. Receivers
+// should also refuse old timestamps to stop replays.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Webhooks delivers the changes of a Feed to each webhook in order, one
+// delivery at a time, retrying failures with exponential back-off. A
+// webhook that falls behind catches up from the Feed's log.
+type Webhooks struct {
+	feed *Feed
+
+	// Client sends deliveries, it should have a timeout.
+	Client *http.Client
+	// Attempts is how often a delivery is tried before it is dropped.
+	Attempts int
+	// Backoff is the wait after the first failure, doubled after each
+	// one up to MaxBackoff, with some jitter.
+	Backoff, MaxBackoff time.Duration
+	// Logf, when set, is told about dropped deliveries and skipped changes.
+	Logf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	hooks map[string]*hook
+	wg    sync.WaitGroup
+}
+
+// hook is a Webhook and its delivery goroutine, which ends when ctx is
+// cancelled.
+type hook struct {
+	Webhook
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewWebhooks returns Webhooks following feed, with no webhooks yet.
+func NewWebhooks(feed *Feed) *Webhooks {
+	return &Webhooks{
+		feed:       feed,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		Attempts:   5,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+		hooks:      map[string]*hook{},
+	}
+}
+
+// Add starts delivering the changes from now on to w. A Secret is made up
+// when w has none. The returned Webhook is the only one with the Secret.
+func (ws *Webhooks) Add(w Webhook) Webhook {
+	if w.Secret == "" {
+		var b [32]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		w.Secret = hex.EncodeToString(b[:])
+	}
+	w.CreatedAt = time.Now().UTC()
+	h := &hook{Webhook: w}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	ws.mu.Lock()
+	ws.hooks[w.ID] = h
+	ws.mu.Unlock()
+
+	// Subscribed before returning, so no change after Add is missed
+	sub := ws.feed.Subscribe()
+	ws.wg.Add(1)
+	go ws.run(h, sub)
+	return w
+}
+
+// List returns every webhook, without secrets, oldest first.
+func (ws *Webhooks) List() []Webhook {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	list := make([]Webhook, 0, len(ws.hooks))
+	for _, h := range ws.hooks {
+		list = append(list, h.public())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Get returns the webhook with id, without its secret.
+func (ws *Webhooks) Get(id string) (Webhook, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	h, ok := ws.hooks[id]
+	if !ok {
+		return Webhook{}, false
+	}
+	return h.public(), true
+}
+
+// Remove stops delivering to the webhook with id, a delivery in flight is
+// cancelled.
+func (ws *Webhooks) Remove(id string) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	h, ok := ws.hooks[id]
+	if ok {
+		delete(ws.hooks, id)
+		h.cancel()
+	}
+	return ok
+}
+
+// Close removes every webhook and waits for their goroutines.
+func (ws *Webhooks) Close() {
+	ws.mu.Lock()
+	for id, h := range ws.hooks {
+		delete(ws.hooks, id)
+		h.cancel()
+	}
+	ws.mu.Unlock()
+	ws.wg.Wait()
+}
+
+// public copies the Webhook of h without its secret, ws.mu held.
+func (h *hook) public() Webhook {
+	w := h.Webhook
+	w.Secret = ""
+	w.Types = append([]string(nil), w.Types...)
+	return w
+}
+
+// wants reports whether h subscribed to changes of typ.
+func (h *hook) wants(typ string) bool {
+	if len(h.Types) == 0 {
+		return true
+	}
+	for _, t := range h.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// run delivers the changes of sub to h until h is removed. When sub is
+// dropped for falling behind, it resumes from the last change handled.
+func (ws *Webhooks) run(h *hook, sub *Subscription) {
+	defer ws.wg.Done()
+	last := sub.From
+	handle := func(c Change) bool {
+		last = c.Seq
+		if h.wants(c.Type) {
+			return ws.deliver(h, c)
+		}
+		return true
+	}
+	for {
+		for open := true; open; {
+			select {
+			case c, ok := <-sub.C:
+				if open = ok; ok && !handle(c) {
+					sub.Close()
+					return
+				}
+			case <-h.ctx.Done():
+				sub.Close()
+				return
+			}
+		}
+
+		backlog, next, ok := ws.feed.Resume(last)
+		if !ok {
+			ws.logf("webhook %v missed changes after %v, they left the log", h.ID, last)
+		}
+		for _, c := range backlog {
+			if !handle(c) {
+				next.Close()
+				return
+			}
+		}
+		sub = next
+	}
+}
+
+// deliver sends c to h until it is accepted, refused for good or out of
+// attempts. It returns false when h was removed meanwhile.
+func (ws *Webhooks) deliver(h *hook, c Change) bool {
+	body, err := json.Marshal(c)
+	if err != nil {
+		ws.record(h, err)
+		return true
+	}
+	delay := ws.Backoff
+	for attempt := 1; ; attempt++ {
+		wait, err := ws.post(h, c, body)
+		if err == nil {
+			ws.record(h, nil)
+			return true
+		}
+		if h.ctx.Err() != nil {
+			return false
+		}
+		if wait < 0 || attempt >= ws.Attempts {
+			ws.logf("webhook %v dropped change %v after %d attempts: %v", h.ID, c.Seq, attempt, err)
+			ws.record(h, err)
+			return true
+		}
+		if wait < delay {
+			wait = delay
+		}
+		if wait > ws.MaxBackoff {
+			wait = ws.MaxBackoff
+		}
+		// Up to a quarter more, so failing webhooks do not retry in step
+		wait += time.Duration(mrand.Int63n(int64(wait)/4 + 1))
+		select {
+		case <-time.After(wait):
+		case <-h.ctx.Done():
+			return false
+		}
+		delay *= 2
+	}
+}
+
+// post makes one delivery attempt. On failure wait is how long the
+// receiver asked to wait, 0 when it did not say, or -1 when retrying is
+// pointless.
+func (ws *Webhooks) post(h *hook, c Change, body []byte) (wait time.Duration, err error) {
+	req, err := http.NewRequestWithContext(h.ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "muxAPI-webhooks")
+	req.Header.Set(HeaderID, h.ID)
+	req.Header.Set(HeaderDelivery, fmt.Sprintf("%v-%v", ws.feed.Epoch(), c.Seq))
+	req.Header.Set(HeaderEvent, c.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(h.Secret, timestamp, body))
+
+	resp, err := ws.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(secs) * time.Second, fmt.Errorf("receiver answered %v", resp.Status)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout:
+		return 0, fmt.Errorf("receiver answered %v", resp.Status)
+	}
+	return -1, fmt.Errorf("receiver refused it with %v", resp.Status)
+}
+
+// record counts a finished delivery of h, err is nil when it got through.
+func (ws *Webhooks) record(h *hook, err error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if err == nil {
+		h.Delivered++
+		return
+	}
+	h.Failed++
+	h.LastError = err.Error()
+}
+
+func (ws *Webhooks) logf(format string, args ...interface{}) {
+	if ws.Logf != nil {
+		ws.Logf(format, args...)
+	}
+}
@@ -2,4 +2,9 @@ module s_backend
 
 go 1.18
 
-require github.com/gorilla/mux v1.8.0
+require (
+	github.com/gorilla/mux v1.8.0
+	go.etcd.io/bbolt v1.3.9
+)
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,164 @@
+package ApiTest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"s_backend/api"
+	"s_backend/feed"
+	"s_backend/store"
+)
+
+// Helpers for the api and store tests: every test runs against each store
+// in Stores, and drives the API over HTTP with httptest. The package is
+// internal and only imported by tests.
+
+// Stores are the EventStores the tests run against. Open returns a fresh,
+// empty one.
+var Stores = []struct {
+	Name string
+	Open func(t testing.TB) Store.EventStore
+}{
+	{"memory", func(testing.TB) Store.EventStore { return Store.NewMemory() }},
+	{"bolt", func(t testing.TB) Store.EventStore {
+		s, err := Store.OpenBolt(filepath.Join(t.TempDir(), "events.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+}
+
+// EachStore runs fn as a subtest per store, newStore returning a fresh one
+// each call.
+func EachStore(t *testing.T, fn func(t *testing.T, newStore func() Store.EventStore)) {
+	for _, s := range Stores {
+		open := s.Open
+		t.Run(s.Name, func(t *testing.T) {
+			fn(t, func() Store.EventStore { return open(t) })
+		})
+	}
+}
+
+// Response is a decoded reply.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Decode unmarshals the body into v.
+func (r Response) Decode(v interface{}) error {
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		return fmt.Errorf("%v: %s", err, r.Body)
+	}
+	return nil
+}
+
+// ErrorCode returns the code of an error envelope, or "" when the body is
+// not one.
+func (r Response) ErrorCode() string {
+	var body Api.ErrorBody
+	if json.Unmarshal(r.Body, &body) != nil {
+		return ""
+	}
+	return body.Error.Code
+}
+
+// Client sends requests to a test server.
+type Client struct {
+	URL string
+	t   testing.TB
+}
+
+// For returns c failing t instead, for use in subtests.
+func (c Client) For(t testing.TB) Client {
+	c.t = t
+	return c
+}
+
+// Do sends method to path with body, when it is not empty, and header
+// pairs. It fails the test when the request cannot be sent.
+func (c Client) Do(method, path, body string, header ...string) Response {
+	c.t.Helper()
+	resp, err := c.Send(method, path, body, header...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+// Send is Do for goroutines other than the test's: it returns the error.
+func (c Client) Send(method, path, body string, header ...string) (Response, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.URL+path, reader)
+	if err != nil {
+		return Response{}, err
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return Response{resp.StatusCode, resp.Header, data}, err
+}
+
+// Start serves a router over store until the test ends, then closes store.
+func Start(t testing.TB, store Store.EventStore) Client {
+	return StartWith(t, store, Api.Config{})
+}
+
+// StartWith is Start with a Config for the router. A Feed and Webhooks
+// are made when cfg has none, and the Webhooks are closed with the server.
+func StartWith(t testing.TB, store Store.EventStore, cfg Api.Config) Client {
+	if cfg.Feed == nil {
+		cfg.Feed = Feed.New(Feed.DefaultSize)
+	}
+	if cfg.Webhooks == nil {
+		cfg.Webhooks = Feed.NewWebhooks(cfg.Feed)
+	}
+	server := httptest.NewServer(Api.NewRouter(store, cfg))
+	t.Cleanup(func() {
+		cfg.Webhooks.Close()
+		server.Close()
+		store.Close()
+	})
+	return Client{server.URL, t}
+}
+
+// ExpectError fails t unless resp is an error envelope with status and
+// code.
+func ExpectError(t testing.TB, resp Response, status int, code string) {
+	t.Helper()
+	if resp.Status != status || resp.ErrorCode() != code {
+		t.Fatalf("got %v %s, want %v with code %q", resp.Status, resp.Body, status, code)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("error sent as %q", ct)
+	}
+}
+
+// ExpectField fails t unless the first detail of the error in resp names
+// field.
+func ExpectField(t testing.TB, resp Response, field string) {
+	t.Helper()
+	var body Api.ErrorBody
+	resp.Decode(&body)
+	if len(body.Error.Details) == 0 || body.Error.Details[0].Field != field {
+		t.Fatalf("details %+v do not name %v", body.Error.Details, field)
+	}
+}
@@ -0,0 +1,140 @@
+package ApiTest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"s_backend/feed"
+)
+
+// SSE is one server-sent event.
+type SSE struct {
+	ID, Event, Data string
+}
+
+// Change decodes the data of a change event.
+func (e SSE) Change() (Feed.Change, error) {
+	var c Feed.Change
+	if err := json.Unmarshal([]byte(e.Data), &c); err != nil {
+		return c, fmt.Errorf("%v: %s", err, e.Data)
+	}
+	return c, nil
+}
+
+// EventStream reads server-sent events.
+type EventStream struct {
+	events chan SSE
+	cancel context.CancelFunc
+}
+
+// Stream opens path as an event stream, with header pairs. It is closed
+// when the test ends, before the server, which waits for open streams.
+func (c Client) Stream(path string, header ...string) *EventStream {
+	c.t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL+path, nil)
+	if err != nil {
+		cancel()
+		c.t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		c.t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		resp.Body.Close()
+		cancel()
+		c.t.Fatalf("stream %v: got %v as %q", path, resp.Status, ct)
+	}
+	s := &EventStream{make(chan SSE, 256), cancel}
+	c.t.Cleanup(s.Close)
+	go s.read(resp.Body)
+	return s
+}
+
+// read parses events from body until it ends.
+func (s *EventStream) read(body io.ReadCloser) {
+	defer close(s.events)
+	defer body.Close()
+	var e SSE
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "":
+			if line == "" && (e.Event != "" || e.Data != "") {
+				s.events <- e
+				e = SSE{}
+			}
+		case "id":
+			e.ID = value
+		case "event":
+			e.Event = value
+		case "data":
+			e.Data += value
+		}
+	}
+}
+
+// Next returns the next event, failing when none comes within timeout or
+// the stream ended.
+func (s *EventStream) Next(timeout time.Duration) (SSE, error) {
+	select {
+	case e, ok := <-s.events:
+		if !ok {
+			return e, fmt.Errorf("stream ended")
+		}
+		return e, nil
+	case <-time.After(timeout):
+		return SSE{}, fmt.Errorf("no event within %v", timeout)
+	}
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() {
+	s.cancel()
+}
+
+// ExpectChanges reads len(want) events from s, each of type want[i] for
+// an event titled titles[i], or any title when that is "", and returns
+// them. It fails t on anything else.
+func ExpectChanges(t testing.TB, s *EventStream, want []string, titles []string) []SSE {
+	t.Helper()
+	var got []SSE
+	for i, typ := range want {
+		e, err := s.Next(2 * time.Second)
+		if err != nil {
+			t.Fatalf("change %d: %v", i, err)
+		}
+		c, err := e.Change()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Event != typ || c.Type != typ || !strings.HasSuffix(e.ID, fmt.Sprintf("-%d", c.Seq)) {
+			t.Fatalf("change %d is %v %v %s, want %v", i, e.ID, e.Event, e.Data, typ)
+		}
+		if typ == Feed.Deleted && c.Event != nil || typ != Feed.Deleted && (c.Event == nil || c.Event.ID != c.EventID) {
+			t.Fatalf("change %d carries %s", i, e.Data)
+		}
+		if titles[i] != "" && (c.Event == nil || c.Event.Title != titles[i]) {
+			t.Fatalf("change %d is for %s, want %v", i, e.Data, titles[i])
+		}
+		got = append(got, e)
+	}
+	return got
+}
@@ -0,0 +1,70 @@
+package ApiTest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Delivery is one webhook request a Receiver got.
+type Delivery struct {
+	Header http.Header
+	Body   []byte
+	Status int
+}
+
+// Receiver is a local webhook endpoint. It answers with the statuses
+// queued by Fail, then 200, and keeps every request.
+type Receiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []Delivery
+}
+
+// NewReceiver starts a Receiver that stops when the test ends.
+func NewReceiver(t testing.TB) *Receiver {
+	rv := &Receiver{}
+	rv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rv.mu.Lock()
+		status := http.StatusOK
+		if len(rv.statuses) > 0 {
+			status, rv.statuses = rv.statuses[0], rv.statuses[1:]
+		}
+		rv.deliveries = append(rv.deliveries, Delivery{r.Header.Clone(), body, status})
+		rv.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rv.Close)
+	return rv
+}
+
+// Fail queues statuses for the next requests.
+func (rv *Receiver) Fail(statuses ...int) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.statuses = append(rv.statuses, statuses...)
+}
+
+// Wait returns the requests so far once there are at least n, failing t
+// after a few seconds.
+func (rv *Receiver) Wait(t testing.TB, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rv.mu.Lock()
+		got := append([]Delivery(nil), rv.deliveries...)
+		rv.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("receiver got %d requests, want %d", len(got), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,141 @@
+package Search
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"s_backend/store"
+)
+
+// BM25 parameters: k1 is how quickly repeating a term stops adding to the
+// score, b how much long events are held back.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// titleWeight is how many times a word of the title counts.
+const titleWeight = 2
+
+// Hit is an event matching a search and its score, higher is better.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// doc is what the Index keeps of an event.
+type doc struct {
+	terms  map[string]int // weighted count of each term
+	length int            // weighted count of terms
+}
+
+// Index is an inverted index of event titles and descriptions, ranked
+// with BM25. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*doc
+	postings map[string]map[string]int // term to the ID and weighted count of each event having it
+	total    int                       // sum of the doc lengths
+}
+
+// New returns an empty Index.
+func New() *Index {
+	return &Index{docs: map[string]*doc{}, postings: map[string]map[string]int{}}
+}
+
+// Put indexes e, replacing what was indexed under its ID.
+func (ix *Index) Put(e Store.Event) {
+	d := &doc{terms: map[string]int{}}
+	for _, field := range []struct {
+		text   string
+		weight int
+	}{{e.Title, titleWeight}, {e.Description, 1}} {
+		for _, t := range tokenize(field.text) {
+			d.terms[t.term] += field.weight
+			d.length += field.weight
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(e.ID)
+	ix.docs[e.ID] = d
+	ix.total += d.length
+	for term, n := range d.terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = map[string]int{}
+		}
+		ix.postings[term][e.ID] = n
+	}
+}
+
+// Remove drops the event with id from the index.
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id string) {
+	d, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for term := range d.terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	ix.total -= d.length
+	delete(ix.docs, id)
+}
+
+// Len returns how many events are indexed.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Search returns the events having any of terms, best first and by ID
+// among equals, leaving out the first offset and returning at most limit.
+// total counts every match.
+func (ix *Index) Search(terms []string, offset, limit int) (hits []Hit, total int) {
+	ix.mu.RLock()
+	scores := map[string]float64{}
+	if n := float64(len(ix.docs)); n > 0 {
+		avgLength := float64(ix.total) / n
+		for _, term := range terms {
+			postings := ix.postings[term]
+			idf := math.Log(1 + (n-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+			for id, count := range postings {
+				tf := float64(count)
+				norm := 1 - b + b*float64(ix.docs[id].length)/avgLength
+				scores[id] += idf * tf * (k1 + 1) / (tf + k1*norm)
+			}
+		}
+	}
+	ix.mu.RUnlock()
+
+	hits = make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{id, score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	total = len(hits)
+	if offset > total {
+		offset = total
+	}
+	hits = hits[offset:]
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, total
+}
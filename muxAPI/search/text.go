@@ -0,0 +1,198 @@
+package Search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a word of a text, as a term, and where it is in the text.
+type token struct {
+	term       string
+	start, end int // byte offsets
+}
+
+// stopWords are too common to search for.
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by for from has have in into is it its
+		of on or so that the their there this to was were will with`) {
+		stopWords[w] = true
+	}
+}
+
+// tokenize splits text into words, runs of letters and digits, and turns
+// each into a term: lowercased and stemmed. Stop words and single letters
+// are left out.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text + " " {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			if term := termOf(text[start:i]); term != "" {
+				tokens = append(tokens, token{term, start, i})
+			}
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// termOf returns the term of one word, "" when it is not searched for.
+func termOf(word string) string {
+	word = strings.ToLower(word)
+	if stopWords[word] {
+		return ""
+	}
+	if r, _ := utf8.DecodeRuneInString(word); utf8.RuneCountInString(word) == 1 && unicode.IsLetter(r) {
+		return ""
+	}
+	return stem(word)
+}
+
+// Terms returns the terms of a query, each once.
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, t := range tokenize(query) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+	return terms
+}
+
+// stem strips common English endings, so "launches", "launched" and
+// "launching" are all "launch". It is much simpler than Porter's, it only
+// has to map a word and its forms to the same term, not to a real word.
+func stem(w string) string {
+	if len(w) <= 3 || !isASCIILetters(w) {
+		return w
+	}
+	// Plurals
+	switch {
+	case strings.HasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(w, "ies") && len(w) > 4:
+		w = w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "ches"), strings.HasSuffix(w, "shes"), strings.HasSuffix(w, "xes"), strings.HasSuffix(w, "zes"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") && !strings.HasSuffix(w, "us") && !strings.HasSuffix(w, "is"):
+		w = w[:len(w)-1]
+	}
+	// Verb and adverb endings, when enough is left
+	for _, suffix := range []string{"ing", "ed", "ly"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 && hasVowel(w[:len(w)-len(suffix)]) {
+			w = w[:len(w)-len(suffix)]
+			// running, planned: one of a doubled consonant goes
+			if n := len(w); suffix != "ly" && w[n-1] == w[n-2] && !strings.ContainsRune("aeioulsz", rune(w[n-1])) {
+				w = w[:n-1]
+			}
+			break
+		}
+	}
+	// create and created meet at creat
+	if len(w) > 3 && strings.HasSuffix(w, "e") {
+		w = w[:len(w)-1]
+	}
+	return w
+}
+
+func isASCIILetters(w string) bool {
+	for i := 0; i < len(w); i++ {
+		if w[i] < 'a' || w[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasVowel(w string) bool {
+	return strings.ContainsAny(w, "aeiouy")
+}
+
+// Highlight returns text, HTML escaped, with the words matching terms in
+// <mark> tags. When text is longer than max runes it is cut to max
+// around the first match, with "…" where it was cut. "" when nothing
+// matches.
+func Highlight(text string, terms []string, max int) string {
+	want := map[string]bool{}
+	for _, t := range terms {
+		want[t] = true
+	}
+	var marks []token
+	for _, t := range tokenize(text) {
+		if want[t.term] {
+			marks = append(marks, t)
+		}
+	}
+	if len(marks) == 0 {
+		return ""
+	}
+
+	// The window starts a little before the first match, on a word
+	// boundary, and ends on one
+	from, to := 0, len(text)
+	if max > 0 && utf8.RuneCountInString(text) > max {
+		from = backRunes(text, marks[0].start, max/4)
+		if i := strings.IndexFunc(text[from:marks[0].start], unicode.IsSpace); from > 0 && i >= 0 {
+			from += i + 1
+		}
+		// A first match longer than the window is still shown whole
+		to = forwardRunes(text, from, max)
+		if to < marks[0].end {
+			to = marks[0].end
+		}
+		if to < len(text) {
+			if i := strings.LastIndexFunc(text[marks[0].end:to], unicode.IsSpace); i >= 0 {
+				to = marks[0].end + i
+			}
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	at := from
+	for _, m := range marks {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[at:m.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[m.start:m.end]))
+		b.WriteString("</mark>")
+		at = m.end
+	}
+	b.WriteString(html.EscapeString(text[at:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// backRunes returns the offset n runes before i in s, or 0.
+func backRunes(s string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes returns the offset n runes after i in s, or len(s).
+func forwardRunes(s string, i, n int) int {
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,165 @@
+package Store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// eventsBucket holds every event as JSON under its ID. Bolt keeps keys
+// sorted, so iterating it lists events by ID.
+var eventsBucket = []byte("events")
+
+// Bolt is an EventStore kept in a BoltDB file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens, or creates, the database at path. Only one process can
+// have it open at a time.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db}, nil
+}
+
+func (b *Bolt) List() ([]Event, error) {
+	events := []Event{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(eventsBucket).ForEach(func(_, v []byte) error {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			events = append(events, e)
+			return nil
+		})
+	})
+	return events, err
+}
+
+func (b *Bolt) Page(after string, n int) ([]Event, error) {
+	events := []Event{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		k, v := c.Seek([]byte(after))
+		if k != nil && string(k) == after {
+			k, v = c.Next()
+		}
+		for ; k != nil && len(events) < n; k, v = c.Next() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (b *Bolt) Get(id string) (Event, error) {
+	var e Event
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		e, err = getEvent(tx.Bucket(eventsBucket), id)
+		return err
+	})
+	return e, err
+}
+
+func (b *Bolt) Create(e Event) error {
+	return b.put(e, false)
+}
+
+// CreateAll writes events in one transaction, so a taken ID leaves the
+// store as it was.
+func (b *Bolt) CreateAll(events []Event) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		for _, e := range events {
+			// Earlier events of the batch are already in the bucket here
+			if _, err := getEvent(bucket, e.ID); err != ErrNotFound {
+				if err == nil {
+					err = ErrExists
+				}
+				return err
+			}
+			v, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(e.ID), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) Update(e Event) error {
+	return b.put(e, true)
+}
+
+// put writes e, which must already exist at the version before it when
+// replace is set and must not exist otherwise.
+func (b *Bolt) put(e Event, replace bool) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		stored, err := getEvent(bucket, e.ID)
+		switch {
+		case replace && err == nil && e.Version != stored.Version+1:
+			return ErrStale
+		case replace && err != nil:
+			return err
+		case !replace && err == nil:
+			return ErrExists
+		case !replace && err != ErrNotFound:
+			return err
+		}
+		return bucket.Put([]byte(e.ID), v)
+	})
+}
+
+func (b *Bolt) Delete(id string, version int64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		stored, err := getEvent(bucket, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != stored.Version {
+			return ErrStale
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// getEvent reads the event under id in bucket.
+func getEvent(bucket *bolt.Bucket, id string) (Event, error) {
+	var e Event
+	v := bucket.Get([]byte(id))
+	if v == nil {
+		return e, ErrNotFound
+	}
+	return e, json.Unmarshal(v, &e)
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,116 @@
+package Store
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory is an EventStore held in a map. Everything is lost on restart.
+type Memory struct {
+	mu     sync.RWMutex
+	events map[string]Event
+}
+
+// NewMemory returns an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{events: map[string]Event{}}
+}
+
+func (m *Memory) List() ([]Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	events := make([]Event, 0, len(m.events))
+	for _, e := range m.events {
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (m *Memory) Page(after string, n int) ([]Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ids []string
+	for id := range m.events {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	events := make([]Event, len(ids))
+	for i, id := range ids {
+		events[i] = m.events[id]
+	}
+	return events, nil
+}
+
+func (m *Memory) Get(id string) (Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.events[id]
+	if !ok {
+		return Event{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (m *Memory) Create(e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.events[e.ID]; ok {
+		return ErrExists
+	}
+	m.events[e.ID] = e
+	return nil
+}
+
+func (m *Memory) CreateAll(events []Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		if _, ok := m.events[e.ID]; ok || seen[e.ID] {
+			return ErrExists
+		}
+		seen[e.ID] = true
+	}
+	for _, e := range events {
+		m.events[e.ID] = e
+	}
+	return nil
+}
+
+func (m *Memory) Update(e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.events[e.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.Version != stored.Version+1 {
+		return ErrStale
+	}
+	m.events[e.ID] = e
+	return nil
+}
+
+func (m *Memory) Delete(id string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.events[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && version != stored.Version {
+		return ErrStale
+	}
+	delete(m.events, id)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,59 @@
+package Store
+
+import (
+	"errors"
+	"time"
+)
+
+// Event Structure
+// ----------------------->
+// CreatedAt and UpdatedAt are set by the API, stores keep them as given.
+// Version counts the writes to an event, stores use it to refuse an update
+// based on an old copy.
+type Event struct {
+	ID          string    `json:"ID"`
+	Title       string    `json:"Title"`
+	Description string    `json:"Description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int64     `json:"version"`
+}
+
+// <-----------------------
+
+// Errors returned by every EventStore.
+var (
+	ErrNotFound = errors.New("event not found")
+	ErrExists   = errors.New("event already exists")
+	ErrStale    = errors.New("event was changed since it was read")
+)
+
+// EventStore keeps events. Implementations are safe for concurrent use and
+// List and Page return events ordered by ID. Page lets callers walk every
+// event without holding them all.
+//
+// Update only succeeds when e.Version is one more than the stored version,
+// and Delete when version is the stored one or 0, so two writers working
+// from the same copy cannot both win.
+type EventStore interface {
+	List() ([]Event, error)
+	Page(after string, n int) ([]Event, error) // up to n events with IDs after after, "" for the first
+	Get(id string) (Event, error)
+	Create(e Event) error                  // ErrExists when the ID is taken
+	CreateAll(events []Event) error        // all or none, ErrExists when an ID is taken or repeated
+	Update(e Event) error                  // ErrNotFound when the ID is unknown, ErrStale on a version mismatch
+	Delete(id string, version int64) error // ErrNotFound when the ID is unknown, ErrStale on a version mismatch
+	Close() error
+}
+
+// Open returns the store named by kind: "memory", or "bolt" kept in the
+// file at path.
+func Open(kind, path string) (EventStore, error) {
+	switch kind {
+	case "memory":
+		return NewMemory(), nil
+	case "bolt":
+		return OpenBolt(path)
+	}
+	return nil, errors.New("unknown store " + kind + `, want "memory" or "bolt"`)
+}
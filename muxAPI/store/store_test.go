@@ -0,0 +1,320 @@
+package Store_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"s_backend/internal/apitest"
+	"s_backend/store"
+)
+
+// TestContract runs the rules every EventStore follows against each store,
+// a fresh one per rule.
+func TestContract(t *testing.T) {
+	for _, rule := range []struct {
+		name string
+		fn   func(t *testing.T, s Store.EventStore)
+	}{
+		{"crud", checkCRUD},
+		{"errors", checkErrors},
+		{"order", checkOrder},
+		{"batches", checkBatches},
+		{"versions", checkVersions},
+		{"concurrency", checkConcurrency},
+		{"lost updates", checkLostUpdates},
+	} {
+		fn := rule.fn
+		t.Run(rule.name, func(t *testing.T) {
+			ApiTest.EachStore(t, func(t *testing.T, newStore func() Store.EventStore) {
+				s := newStore()
+				defer s.Close()
+				fn(t, s)
+			})
+		})
+	}
+}
+
+// TestPersistence writes through a Bolt store, closes it and expects the
+// reopened file to hold the same events.
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	s, err := Store.OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	want := []Store.Event{{ID: "a", Title: "kept", Description: "across restarts", CreatedAt: at, UpdatedAt: at.Add(time.Hour), Version: 3}}
+	if err := s.Create(want[0]); err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Store.OpenBolt(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v after reopening, want %v", got, want)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, kind := range []string{"memory", "bolt"} {
+		s, err := Store.Open(kind, filepath.Join(t.TempDir(), "events.db"))
+		if err != nil {
+			t.Fatalf("%v: %v", kind, err)
+		}
+		s.Close()
+	}
+	if _, err := Store.Open("paper", ""); err == nil {
+		t.Fatal("opened an unknown store")
+	}
+}
+
+func checkCRUD(t *testing.T, s Store.EventStore) {
+	events, err := s.List()
+	if err != nil || len(events) != 0 {
+		t.Fatalf("new store lists %v, %v; want no events", events, err)
+	}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	e := Store.Event{ID: "1", Title: "Launch", Description: "first", CreatedAt: at, UpdatedAt: at, Version: 1}
+	if err := s.Create(e); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got, err := s.Get("1"); err != nil || got != e {
+		t.Fatalf("get after create: %v, %v; want %v", got, err, e)
+	}
+	e.Description = "changed"
+	e.UpdatedAt = at.Add(time.Minute)
+	e.Version++
+	if err := s.Update(e); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, err := s.Get("1"); err != nil || got != e {
+		t.Fatalf("get after update: %v, %v; want %v", got, err, e)
+	}
+	if err := s.Delete("1", 2); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Get("1"); err != Store.ErrNotFound {
+		t.Fatalf("get after delete: %v, want ErrNotFound", err)
+	}
+}
+
+func checkErrors(t *testing.T, s Store.EventStore) {
+	e := Store.Event{ID: "1", Title: "one"}
+	if err := s.Create(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(Store.Event{ID: "1", Title: "again"}); err != Store.ErrExists {
+		t.Fatalf("duplicate create: %v, want ErrExists", err)
+	}
+	if got, _ := s.Get("1"); got != e {
+		t.Fatalf("duplicate create changed the event to %v", got)
+	}
+	if _, err := s.Get("2"); err != Store.ErrNotFound {
+		t.Fatalf("get unknown: %v, want ErrNotFound", err)
+	}
+	if err := s.Update(Store.Event{ID: "2"}); err != Store.ErrNotFound {
+		t.Fatalf("update unknown: %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("2", 0); err != Store.ErrNotFound {
+		t.Fatalf("delete unknown: %v, want ErrNotFound", err)
+	}
+}
+
+func checkOrder(t *testing.T, s Store.EventStore) {
+	for _, id := range []string{"c", "a", "b"} {
+		if err := s.Create(Store.Event{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("list order %v, want [a b c]", ids)
+	}
+}
+
+// checkBatches expects CreateAll to write all or nothing and Page to walk
+// the events in ID order.
+func checkBatches(t *testing.T, s Store.EventStore) {
+	if err := s.CreateAll([]Store.Event{{ID: "b"}, {ID: "d"}, {ID: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range [][]Store.Event{
+		{{ID: "c"}, {ID: "b"}},
+		{{ID: "e"}, {ID: "f"}, {ID: "e"}},
+	} {
+		if err := s.CreateAll(batch); err != Store.ErrExists {
+			t.Fatalf("batch %v: %v, want ErrExists", batch, err)
+		}
+	}
+	if err := s.CreateAll(nil); err != nil {
+		t.Fatalf("empty batch: %v", err)
+	}
+
+	var ids []string
+	after := ""
+	for {
+		page, err := s.Page(after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		if len(page) > 2 {
+			t.Fatalf("page after %q has %d events, want at most 2", after, len(page))
+		}
+		for _, e := range page {
+			ids = append(ids, e.ID)
+		}
+		after = page[len(page)-1].ID
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "d"}) {
+		t.Fatalf("paged %v, want [a b d] and nothing from the refused batches", ids)
+	}
+	if page, err := s.Page("b", 10); err != nil || len(page) != 1 || page[0].ID != "d" {
+		t.Fatalf("page after b: %v %v, want [d]", page, err)
+	}
+}
+
+// checkVersions expects updates and deletes from an old copy to be refused
+// and to leave the event alone.
+func checkVersions(t *testing.T, s Store.EventStore) {
+	e := Store.Event{ID: "1", Title: "one", Version: 1}
+	if err := s.Create(e); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []int64{0, 1, 3} {
+		stale := e
+		stale.Title = "stale"
+		stale.Version = version
+		if err := s.Update(stale); err != Store.ErrStale {
+			t.Fatalf("update to version %v of version 1: %v, want ErrStale", version, err)
+		}
+	}
+	e.Version = 2
+	if err := s.Update(e); err != nil {
+		t.Fatalf("update to version 2: %v", err)
+	}
+	if err := s.Delete("1", 1); err != Store.ErrStale {
+		t.Fatalf("delete at version 1 of version 2: %v, want ErrStale", err)
+	}
+	if got, err := s.Get("1"); err != nil || got != e {
+		t.Fatalf("refused writes left %v, %v; want %v", got, err, e)
+	}
+	if err := s.Delete("1", 0); err != nil {
+		t.Fatalf("delete at any version: %v", err)
+	}
+}
+
+// checkConcurrency has writers and readers race on the store; run it with
+// -race to catch unguarded state.
+func checkConcurrency(t *testing.T, s Store.EventStore) {
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter*3)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				e := Store.Event{ID: fmt.Sprintf("%02d-%03d", w, i), Title: "t", Version: 1}
+				if err := s.Create(e); err != nil {
+					errs <- err
+				}
+				e.Title = "updated"
+				e.Version++
+				if err := s.Update(e); err != nil {
+					errs <- err
+				}
+				if _, err := s.List(); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	events, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != writers*perWriter {
+		t.Fatalf("%v events after concurrent writes, want %v", len(events), writers*perWriter)
+	}
+	for _, e := range events {
+		if e.Title != "updated" {
+			t.Fatalf("event %v lost its update", e.ID)
+		}
+	}
+}
+
+// checkLostUpdates has writers increment one counter by reading it and
+// writing it back, retrying on ErrStale. Every increment has to survive.
+func checkLostUpdates(t *testing.T, s Store.EventStore) {
+	const writers, perWriter = 8, 20
+	if err := s.Create(Store.Event{ID: "counter", Description: "0", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; {
+				e, err := s.Get("counter")
+				if err != nil {
+					errs <- err
+					return
+				}
+				n, _ := strconv.Atoi(e.Description)
+				e.Description = strconv.Itoa(n + 1)
+				e.Version++
+				switch err := s.Update(e); err {
+				case nil:
+					i++
+				case Store.ErrStale:
+				default:
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	e, err := s.Get("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(writers * perWriter); e.Description != want || e.Version != writers*perWriter+1 {
+		t.Fatalf("counter at %v, version %v; want %v, version %v", e.Description, e.Version, want, writers*perWriter+1)
+	}
+}